@@ -24,18 +24,36 @@ import (
 // All package paths are canonical, and thus may contain "/vendor/".
 //
 // The result may include import paths for directories that contain no
-// *.go files, such as "archive" (in $GOROOT/src).
+// *.go files, such as "archive" (in $GOROOT/src).  Each path appears
+// once, even if several source directories contain it.
 //
 // All I/O is done via the build.Context file system interface,
 // which must be concurrency-safe.
 //
 func AllPackages(ctxt *build.Context) []string {
+	return PackagesBeneath(ctxt, "")
+}
+
+// PackagesBeneath is like AllPackages, but returns only the packages
+// whose path is dir or begins with dir followed by a slash, such as
+// "golang.org/x/tools" and "golang.org/x/tools/go/loader" for the dir
+// "golang.org/x/tools".  Only the subtree of each source directory
+// that corresponds to dir, and the directories enclosing it, are
+// read.  If dir is empty, all packages are returned.
+//
+func PackagesBeneath(ctxt *build.Context, dir string) []string {
 	var list []string
-	ForEachPackage(ctxt, func(pkg string, _ error) {
+	forEachPackage(ctxt, dir, func(pkg string, _ error) {
 		list = append(list, pkg)
 	})
 	sort.Strings(list)
-	return list
+	uniq := list[:0]
+	for i, pkg := range list {
+		if i == 0 || pkg != list[i-1] {
+			uniq = append(uniq, pkg)
+		}
+	}
+	return uniq
 }
 
 // ForEachPackage calls the found function with the package path of
@@ -46,18 +64,35 @@ func AllPackages(ctxt *build.Context) []string {
 // If the package directory exists but could not be read, the second
 // argument to the found function provides the error.
 //
+// Symbolic links are resolved as by CanonicalDir, so that
+// a source directory that is an alias for an earlier one is skipped,
+// and a link to a directory's own ancestor does not cause an
+// infinite walk.
+//
 // All I/O is done via the build.Context file system interface,
 // which must be concurrency-safe.
 //
 func ForEachPackage(ctxt *build.Context, found func(importPath string, err error)) {
+	forEachPackage(ctxt, "", found)
+}
+
+// forEachPackage is like ForEachPackage but walks only the subtree dir,
+// an import path, of each source directory.
+func forEachPackage(ctxt *build.Context, dir string, found func(importPath string, err error)) {
 	ch := make(chan item)
 
 	var wg sync.WaitGroup
+	roots := make(map[string]bool) // canonical names of roots
 	for _, root := range ctxt.SrcDirs() {
+		canon := CanonicalDir(ctxt, root)
+		if roots[canon] {
+			continue // an alias for an earlier root
+		}
+		roots[canon] = true
 		root := root
 		wg.Add(1)
 		go func() {
-			allPackages(ctxt, root, ch)
+			allPackages(ctxt, root, dir, ch)
 			wg.Done()
 		}()
 	}
@@ -81,13 +116,13 @@ type item struct {
 // the number of parallel calls to ReadDir.
 var ioLimit = make(chan bool, 20)
 
-func allPackages(ctxt *build.Context, root string, ch chan<- item) {
+func allPackages(ctxt *build.Context, root, sub string, ch chan<- item) {
 	root = filepath.Clean(root) + string(os.PathSeparator)
 
 	var wg sync.WaitGroup
 
-	var walkDir func(dir string)
-	walkDir = func(dir string) {
+	var walkDir func(dir string, parent *ancestor)
+	walkDir = func(dir string, parent *ancestor) {
 		// Avoid .foo, _foo, and testdata directory trees.
 		base := filepath.Base(dir)
 		if base == "" || base[0] == '.' || base[0] == '_' || base == "testdata" {
@@ -96,6 +131,21 @@ func allPackages(ctxt *build.Context, root string, ch chan<- item) {
 
 		pkg := filepath.ToSlash(strings.TrimPrefix(dir, root))
 
+		// Visit only sub and its ancestors and descendants.
+		inside := sub == "" || pkg == sub || strings.HasPrefix(pkg, sub+"/")
+		if !inside && pkg != "" && !strings.HasPrefix(sub, pkg+"/") {
+			return
+		}
+
+		// Avoid cycles formed by symbolic links.
+		canon := CanonicalDir(ctxt, dir)
+		for a := parent; a != nil; a = a.parent {
+			if a.dir == canon {
+				return
+			}
+		}
+		self := &ancestor{canon, parent}
+
 		// Prune search if we encounter any of these import paths.
 		switch pkg {
 		case "builtin":
@@ -105,7 +155,7 @@ func allPackages(ctxt *build.Context, root string, ch chan<- item) {
 		ioLimit <- true
 		files, err := ReadDir(ctxt, dir)
 		<-ioLimit
-		if pkg != "" || err != nil {
+		if pkg != "" && inside || err != nil {
 			ch <- item{pkg, err}
 		}
 		for _, fi := range files {
@@ -113,17 +163,24 @@ func allPackages(ctxt *build.Context, root string, ch chan<- item) {
 			if fi.IsDir() {
 				wg.Add(1)
 				go func() {
-					walkDir(filepath.Join(dir, fi.Name()))
+					walkDir(filepath.Join(dir, fi.Name()), self)
 					wg.Done()
 				}()
 			}
 		}
 	}
 
-	walkDir(root)
+	walkDir(root, nil)
 	wg.Wait()
 }
 
+// An ancestor is an element of the list of canonical names of the
+// directories enclosing the one being walked.
+type ancestor struct {
+	dir    string
+	parent *ancestor
+}
+
 // ExpandPatterns returns the set of packages matched by patterns,
 // which may have the following forms:
 //
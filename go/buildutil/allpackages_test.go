@@ -42,6 +42,29 @@ func TestAllPackages(t *testing.T) {
 	}
 }
 
+func TestPackagesBeneath(t *testing.T) {
+	tree := make(map[string]map[string]string)
+	for _, pkg := range []string{"a", "a/b", "a/b/c", "ab", "x"} {
+		tree[pkg] = make(map[string]string)
+	}
+	ctxt := buildutil.FakeContext(tree)
+
+	for _, test := range []struct {
+		dir, want string
+	}{
+		{"", "a a/b a/b/c ab x"},
+		{"a", "a a/b a/b/c"},
+		{"a/b", "a/b a/b/c"},
+		{"a/b/c/d", ""},
+		{"nosuchdir", ""},
+	} {
+		got := strings.Join(buildutil.PackagesBeneath(ctxt, test.dir), " ")
+		if got != test.want {
+			t.Errorf("PackagesBeneath(%q) = %s, want %s", test.dir, got, test.want)
+		}
+	}
+}
+
 func TestExpandPatterns(t *testing.T) {
 	tree := make(map[string]map[string]string)
 	for _, pkg := range []string{
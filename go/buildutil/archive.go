@@ -0,0 +1,231 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildutil
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Limits on the size of the archives read by ZipContext and
+// TarContext, which protect a service that accepts uploaded code from
+// archives that decompress to excessive sizes.
+const (
+	MaxArchiveFileSize = 16 << 20  // maximum size of a file in an archive
+	MaxArchiveSize     = 256 << 20 // maximum total size of an archive's files
+)
+
+// ZipContext returns a build.Context like orig, except that its GOPATH
+// is the single workspace directory dir, whose contents are the files
+// of the zip archive r, of the specified size.  The archive should
+// contain a workspace tree, such as src/example.com/hello/hello.go.
+// GOROOT and other directories are accessed through orig as usual, so
+// the archived packages may import the standard library.
+//
+// The archive is read entirely into memory; nothing is written to the
+// file system.  This lets a service analyze uploaded code, for example
+// with the loader, without unpacking it to disk.  Files outside dir
+// are accessed through orig.  An error is returned if a file of the
+// archive exceeds MaxArchiveFileSize bytes, or all of them together
+// MaxArchiveSize bytes, once decompressed.
+//
+func ZipContext(orig *build.Context, dir string, r io.ReaderAt, size int64) (*build.Context, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	fs := make(archiveFS)
+	var total int64
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("reading archive file %s: %v", f.Name, err)
+		}
+		data, err := readArchiveFile(f.Name, rc, &total)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		if err := fs.add(f.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	return fs.context(orig, dir), nil
+}
+
+// TarContext is like ZipContext, but reads a tar archive, which may be
+// compressed by gzip.  Entries other than regular files, such as
+// symbolic links, are ignored, but count towards the MaxArchiveSize
+// limit on the decompressed archive.
+func TarContext(orig *build.Context, dir string, r io.Reader) (*build.Context, error) {
+	br := bufio.NewReader(r)
+	r = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	r = &archiveLimitReader{r, MaxArchiveSize}
+	fs := make(archiveFS)
+	var total int64
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+		data, err := readArchiveFile(hdr.Name, tr, &total)
+		if err != nil {
+			return nil, err
+		}
+		if err := fs.add(hdr.Name, data); err != nil {
+			return nil, err
+		}
+	}
+	return fs.context(orig, dir), nil
+}
+
+// readArchiveFile reads the contents of the named archive file from r,
+// and adds its size to *total, enforcing the limits on both.
+func readArchiveFile(name string, r io.Reader, total *int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, MaxArchiveFileSize+1)) // +1 to detect excess
+	if err != nil {
+		return nil, fmt.Errorf("reading archive file %s: %v", name, err)
+	}
+	if len(data) > MaxArchiveFileSize {
+		return nil, fmt.Errorf("archive file %s exceeds %d bytes", name, MaxArchiveFileSize)
+	}
+	*total += int64(len(data))
+	if *total > MaxArchiveSize {
+		return nil, fmt.Errorf("archive exceeds %d bytes", MaxArchiveSize)
+	}
+	return data, nil
+}
+
+// An archiveLimitReader reads from r, but fails once more than n
+// bytes have been read.
+type archiveLimitReader struct {
+	r io.Reader
+	n int64 // bytes remaining
+}
+
+func (lr *archiveLimitReader) Read(p []byte) (int, error) {
+	if lr.n < 0 {
+		return 0, fmt.Errorf("archive exceeds %d bytes", MaxArchiveSize)
+	}
+	if int64(len(p)) > lr.n+1 {
+		p = p[:lr.n+1] // +1 to detect excess
+	}
+	n, err := lr.r.Read(p)
+	lr.n -= int64(n)
+	if lr.n < 0 {
+		return n, fmt.Errorf("archive exceeds %d bytes", MaxArchiveSize)
+	}
+	return n, err
+}
+
+// An archiveFS maps the slash-separated names of the files of an
+// archive, relative to its root, to their contents.
+type archiveFS map[string][]byte
+
+func (fs archiveFS) add(name string, data []byte) error {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return fmt.Errorf("archive file name %s is outside the archive", name)
+	}
+	fs[clean] = data
+	return nil
+}
+
+// context returns a build.Context like orig whose GOPATH is dir, the
+// contents of which are those of fs.
+func (fs archiveFS) context(orig *build.Context, dir string) *build.Context {
+	// Index the directories, including the root, "."
+	dirs := map[string][]os.FileInfo{".": nil}
+	var mkdir func(d string)
+	mkdir = func(d string) {
+		if _, ok := dirs[d]; !ok {
+			dirs[d] = nil
+			parent := path.Dir(d)
+			mkdir(parent)
+			dirs[parent] = append(dirs[parent], fakeDirInfo(path.Base(d)))
+		}
+	}
+	for name := range fs {
+		d := path.Dir(name)
+		mkdir(d)
+		dirs[d] = append(dirs[d], fakeFileInfo(path.Base(name)))
+	}
+	for _, fis := range dirs {
+		sort.Sort(byName(fis))
+	}
+
+	// within returns the name of file relative to dir,
+	// if file lies within it.
+	dir = filepath.Clean(dir)
+	within := func(file string) (string, bool) {
+		rel, err := filepath.Rel(dir, filepath.Clean(file))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", false
+		}
+		return filepath.ToSlash(rel), true
+	}
+
+	copy := *orig // make a copy
+	ctxt := &copy
+	ctxt.GOPATH = dir
+	ctxt.IsDir = func(file string) bool {
+		if rel, ok := within(file); ok {
+			_, ok := dirs[rel]
+			return ok
+		}
+		return IsDir(orig, file)
+	}
+	ctxt.ReadDir = func(file string) ([]os.FileInfo, error) {
+		if rel, ok := within(file); ok {
+			fis, ok := dirs[rel]
+			if !ok {
+				return nil, fmt.Errorf("directory not found: %s", file)
+			}
+			return fis, nil
+		}
+		return ReadDir(orig, file)
+	}
+	ctxt.OpenFile = func(file string) (io.ReadCloser, error) {
+		if rel, ok := within(file); ok {
+			data, ok := fs[rel]
+			if !ok {
+				return nil, fmt.Errorf("file not found: %s", file)
+			}
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		return OpenFile(orig, file)
+	}
+	return ctxt
+}
@@ -0,0 +1,160 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package buildutil_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"go/build"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+var archiveFiles = []struct{ name, content string }{
+	{"src/a/a.go", `package a; import ("b"; "fmt"); var _ = fmt.Sprint(b.B)`},
+	{"src/a/a_test.go", `package a`},
+	{"src/b/b.go", `package b; const B = 1`},
+}
+
+func TestZipContext(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range archiveFiles {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write([]byte(f.content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ctxt, err := buildutil.ZipContext(fmtContext(), "/archive", bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkArchiveContext(t, ctxt)
+}
+
+func TestTarContext(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		var buf bytes.Buffer
+		var gw *gzip.Writer
+		tw := tar.NewWriter(&buf)
+		if compress {
+			gw = gzip.NewWriter(&buf)
+			tw = tar.NewWriter(gw)
+		}
+		tw.WriteHeader(&tar.Header{Name: "src/", Typeflag: tar.TypeDir, Mode: 0755})
+		for _, f := range archiveFiles {
+			tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f.content))})
+			tw.Write([]byte(f.content))
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if gw != nil {
+			gw.Close()
+		}
+		ctxt, err := buildutil.TarContext(fmtContext(), "/archive", &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkArchiveContext(t, ctxt)
+	}
+}
+
+func TestArchiveOutside(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "../evil.go", Typeflag: tar.TypeReg, Mode: 0644})
+	tw.Close()
+	if _, err := buildutil.TarContext(fmtContext(), "/archive", &buf); err == nil || !strings.Contains(err.Error(), "outside the archive") {
+		t.Errorf("TarContext returned error %v, want 'outside the archive'", err)
+	}
+}
+
+// fmtContext returns a fake context whose GOROOT holds package fmt.
+func fmtContext() *build.Context {
+	return buildutil.FakeContext(map[string]map[string]string{
+		"fmt": {"fmt.go": `package fmt; func Sprint(...interface{}) string`},
+	})
+}
+
+func checkArchiveContext(t *testing.T, ctxt *build.Context) {
+	bp, err := ctxt.Import("a", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bp.Dir != "/archive/src/a" || bp.Goroot {
+		t.Errorf("a: Dir = %s, Goroot = %t", bp.Dir, bp.Goroot)
+	}
+	if want := []string{"a.go"}; !reflect.DeepEqual(bp.GoFiles, want) {
+		t.Errorf("a: GoFiles = %v, want %v", bp.GoFiles, want)
+	}
+	if want := []string{"a_test.go"}; !reflect.DeepEqual(bp.TestGoFiles, want) {
+		t.Errorf("a: TestGoFiles = %v, want %v", bp.TestGoFiles, want)
+	}
+	if want := []string{"b", "fmt"}; !reflect.DeepEqual(bp.Imports, want) {
+		t.Errorf("a: Imports = %v, want %v", bp.Imports, want)
+	}
+
+	// The standard library is found through the original context.
+	if bp, err := ctxt.Import("fmt", "", 0); err != nil || !bp.Goroot {
+		t.Errorf("Import(fmt) = %v, %v; want package in GOROOT", bp, err)
+	}
+
+	if got, want := buildutil.AllPackages(ctxt), []string{"a", "b", "fmt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllPackages = %v, want %v", got, want)
+	}
+
+	f, err := buildutil.OpenFile(ctxt, "/archive/src/b/b.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(f)
+	f.Close()
+	if got, want := string(data), archiveFiles[2].content; got != want {
+		t.Errorf("b.go = %q, want %q", got, want)
+	}
+	if _, err := buildutil.OpenFile(ctxt, "/archive/src/b/c.go"); err == nil {
+		t.Errorf("OpenFile of missing file succeeded")
+	}
+}
+
+func TestArchiveTooLarge(t *testing.T) {
+	big := make([]byte, buildutil.MaxArchiveFileSize+1)
+
+	var zbuf bytes.Buffer
+	zw := zip.NewWriter(&zbuf)
+	fw, err := zw.Create("src/big/big.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(big)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := buildutil.ZipContext(fmtContext(), "/archive", bytes.NewReader(zbuf.Bytes()), int64(zbuf.Len())); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("ZipContext returned error %v, want 'exceeds'", err)
+	}
+
+	var tbuf bytes.Buffer
+	gw := gzip.NewWriter(&tbuf)
+	tw := tar.NewWriter(gw)
+	tw.WriteHeader(&tar.Header{Name: "src/big/big.go", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(big))})
+	tw.Write(big)
+	tw.Close()
+	gw.Close()
+	if _, err := buildutil.TarContext(fmtContext(), "/archive", &tbuf); err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Errorf("TarContext returned error %v, want 'exceeds'", err)
+	}
+}
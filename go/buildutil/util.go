@@ -124,6 +124,20 @@ func hasSubdir(root, dir string) (rel string, ok bool) {
 	return filepath.ToSlash(dir[len(root):]), true
 }
 
+// CanonicalDir returns the name of the directory dir with symbolic
+// links resolved, or the cleaned dir if they cannot be resolved.
+// Links are resolved only if ctxt reads files from the host's file
+// system, that is, if ctxt.OpenFile is nil; the names of a virtual
+// file system such as that of FakeContext are merely cleaned.
+func CanonicalDir(ctxt *build.Context, dir string) string {
+	if ctxt.OpenFile == nil {
+		if canon, err := filepath.EvalSymlinks(dir); err == nil {
+			return canon
+		}
+	}
+	return filepath.Clean(dir)
+}
+
 // FileExists returns true if the specified file exists,
 // using the build context's file system interface.
 func FileExists(ctxt *build.Context, path string) bool {
@@ -8,6 +8,7 @@ import (
 	"go/build"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 
@@ -83,3 +84,36 @@ func gopathContainingTools(t *testing.T) string {
 	}
 	return p.Root
 }
+
+func TestCanonicalDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	tmp, err := ioutil.TempDir("", "buildutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	tmp, err = filepath.EvalSymlinks(tmp) // e.g. /tmp may be a link
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(tmp, "dir")
+	link := filepath.Join(tmp, "link")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(dir, link); err != nil {
+		t.Fatal(err)
+	}
+
+	// The host file system resolves links...
+	if got := buildutil.CanonicalDir(&build.Default, link+"/"); got != dir {
+		t.Errorf("CanonicalDir(%s) = %s, want %s", link, got, dir)
+	}
+	// ...but a virtual one does not consult the host.
+	ctxt := buildutil.FakeContext(nil)
+	if got := buildutil.CanonicalDir(ctxt, link+"/"); got != link {
+		t.Errorf("CanonicalDir(FakeContext, %s) = %s, want %s", link, got, link)
+	}
+}
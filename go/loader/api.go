@@ -0,0 +1,101 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the extraction of the exported API of a package.
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// An APIEntry describes one exported member of the API of a package.
+type APIEntry struct {
+	Kind  string    // "const", "var", "func", "type", or "method"
+	Name  string    // e.g. "Reader", or "Reader.Read" for a method
+	Type  string    // type, underlying type, or signature, qualified relative to the package
+	Value string    // value of a constant, or "" for other kinds
+	Pos   token.Pos // position of the declaration
+}
+
+// API returns a description of the exported API of the package:
+// its exported constants, variables, functions, and types, and the
+// exported methods of its exported types, including methods promoted
+// from embedded fields.  Entries are ordered by name.
+//
+// The Type of a type entry is the type's underlying type, or for an
+// alias, "= " followed by the aliased type.  The methods of a type T
+// are those of *T, unless T is an interface.
+//
+func (info *PackageInfo) API() []APIEntry {
+	qual := types.RelativeTo(info.Pkg)
+	typeString := func(t types.Type) string { return types.TypeString(t, qual) }
+
+	var api []APIEntry
+	scope := info.Pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
+			continue
+		}
+		e := APIEntry{Name: name, Type: typeString(obj.Type()), Pos: obj.Pos()}
+		switch obj := obj.(type) {
+		case *types.Const:
+			e.Kind = "const"
+			e.Value = obj.Val().String()
+		case *types.Var:
+			e.Kind = "var"
+		case *types.Func:
+			e.Kind = "func"
+		case *types.TypeName:
+			e.Kind = "type"
+			if obj.IsAlias() {
+				e.Type = "= " + typeString(info.aliasedType(obj))
+			} else {
+				e.Type = typeString(obj.Type().Underlying())
+			}
+			for _, sel := range typeutil.IntuitiveMethodSet(obj.Type(), nil) {
+				m := sel.Obj()
+				if m.Exported() {
+					api = append(api, APIEntry{
+						Kind: "method",
+						Name: name + "." + m.Name(),
+						Type: typeString(m.Type()),
+						Pos:  m.Pos(),
+					})
+				}
+			}
+		default:
+			continue
+		}
+		api = append(api, e)
+	}
+	sort.Slice(api, func(i, j int) bool { return api[i].Name < api[j].Name })
+	return api
+}
+
+// aliasedType returns the type denoted by the declaration of the alias
+// tname, as recorded for the syntax of its type spec.
+func (info *PackageInfo) aliasedType(tname *types.TypeName) types.Type {
+	for _, f := range info.Files {
+		for _, decl := range f.Decls {
+			decl, ok := decl.(*ast.GenDecl)
+			if !ok || decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				if info.Defs[spec.Name] == tname {
+					return info.TypeOf(spec.Type)
+				}
+			}
+		}
+	}
+	return tname.Type() // not from source
+}
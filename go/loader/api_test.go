@@ -0,0 +1,67 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestAPI(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import "b"
+const C, c = 1 << 3, 2
+var V, v b.T
+func F(x int) error { return nil }
+func f() {}
+type T struct{ b.T; x int }
+func (T) M(b.T) {}
+func (*T) N() {}
+func (T) m() {}
+type A = b.T
+type I interface{ M(b.T) }
+type t struct{}
+func (t) M() {}`,
+		"b": `package b
+type T int
+func (T) P() {}`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var got []string
+	for _, e := range prog.Imported["a"].API() {
+		if !e.Pos.IsValid() {
+			t.Errorf("%s %s has no position", e.Kind, e.Name)
+		}
+		s := fmt.Sprintf("%s %s %s", e.Kind, e.Name, e.Type)
+		if e.Value != "" {
+			s += " = " + e.Value
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"type A = b.T",
+		"method A.P func()",
+		"const C untyped int = 8",
+		"func F func(x int) error",
+		"type I interface{M(b.T)}",
+		"method I.M func(b.T)",
+		"type T struct{b.T; x int}",
+		"method T.M func(b.T)",
+		"method T.N func()",
+		"method T.P func()",
+		"var V b.T",
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		t.Errorf("API() =\n%s\nwant:\n%s", g, w)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the registry of argument prefixes understood by
+// FromArgs.
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An ArgHandler interprets the FromArgs arguments that begin with
+// a particular prefix, such as "notest:fmt" or "tags=netgo".
+type ArgHandler struct {
+	Prefix string // e.g. "notest:"
+	Value  string // description of the value, for usage messages
+	Usage  string // one-line description, for usage messages
+
+	// Handle updates conf to reflect an argument, whose prefix has
+	// been removed.  The xtest parameter is that of FromArgs.
+	Handle func(conf *Config, value string, xtest bool) error
+}
+
+var argHandlers struct {
+	sync.Mutex
+	m map[string]*ArgHandler // keyed by Prefix
+}
+
+// RegisterArgHandler adds h to the registry of argument prefixes
+// understood by FromArgs, replacing any handler with the same prefix.
+// It is typically called from the init function of a tool that wishes
+// to extend the command-line syntax of its initial packages.
+//
+// The handlers for these prefixes are predefined:
+//
+//      notest:path     import path without its tests
+//      test:path       import path with its tests
+//      file=name       create a package from the single named file
+//      tags=list       add the comma-separated build tags to the build context
+//
+func RegisterArgHandler(h *ArgHandler) {
+	if h.Prefix == "" || h.Handle == nil {
+		panic("RegisterArgHandler: empty prefix or nil Handle")
+	}
+	argHandlers.Lock()
+	if argHandlers.m == nil {
+		argHandlers.m = make(map[string]*ArgHandler)
+	}
+	argHandlers.m[h.Prefix] = h
+	argHandlers.Unlock()
+}
+
+// UnregisterArgHandler removes the handler registered for prefix, if
+// any, including a predefined one.
+func UnregisterArgHandler(prefix string) {
+	argHandlers.Lock()
+	delete(argHandlers.m, prefix)
+	argHandlers.Unlock()
+}
+
+// lookupArgHandler returns the handler whose prefix is the longest
+// prefix of arg, or nil if there is none.
+func lookupArgHandler(arg string) *ArgHandler {
+	argHandlers.Lock()
+	defer argHandlers.Unlock()
+	var best *ArgHandler
+	for prefix, h := range argHandlers.m {
+		if strings.HasPrefix(arg, prefix) && (best == nil || len(prefix) > len(best.Prefix)) {
+			best = h
+		}
+	}
+	return best
+}
+
+// ArgsUsage returns FromArgsUsage followed by a description of each
+// registered argument prefix, suitable for a tool's -help output.
+func ArgsUsage() string {
+	argHandlers.Lock()
+	var handlers []*ArgHandler
+	for _, h := range argHandlers.m {
+		handlers = append(handlers, h)
+	}
+	argHandlers.Unlock()
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].Prefix < handlers[j].Prefix })
+
+	var buf bytes.Buffer
+	buf.WriteString(FromArgsUsage)
+	if handlers != nil {
+		buf.WriteString("\nIn addition, an argument may have one of these prefixes:\n\n")
+		for _, h := range handlers {
+			fmt.Fprintf(&buf, "   %-20s %s\n", h.Prefix+h.Value, h.Usage)
+		}
+	}
+	return buf.String()
+}
+
+func init() {
+	RegisterArgHandler(&ArgHandler{
+		Prefix: "notest:",
+		Value:  "path",
+		Usage:  "load the package without its tests",
+		Handle: func(conf *Config, path string, xtest bool) error {
+			conf.Import(path)
+			return nil
+		},
+	})
+	RegisterArgHandler(&ArgHandler{
+		Prefix: "test:",
+		Value:  "path",
+		Usage:  "load the package and its tests",
+		Handle: func(conf *Config, path string, xtest bool) error {
+			conf.ImportWithTests(path)
+			return nil
+		},
+	})
+	RegisterArgHandler(&ArgHandler{
+		Prefix: "file=",
+		Value:  "name",
+		Usage:  "create a package from the single named file",
+		Handle: func(conf *Config, filename string, xtest bool) error {
+			if !strings.HasSuffix(filename, ".go") {
+				return fmt.Errorf("not a .go file: %s", filename)
+			}
+			conf.CreateFromFilenames("", filename)
+			return nil
+		},
+	})
+	RegisterArgHandler(&ArgHandler{
+		Prefix: "tags=",
+		Value:  "list",
+		Usage:  "add the comma-separated build tags to the build context",
+		Handle: func(conf *Config, tags string, xtest bool) error {
+			ctxt := *conf.build() // copy
+			ctxt.BuildTags = append(append([]string(nil), ctxt.BuildTags...), strings.Split(tags, ",")...)
+			conf.Build = &ctxt
+			return nil
+		},
+	})
+}
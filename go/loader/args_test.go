@@ -0,0 +1,88 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestArgHandlers(t *testing.T) {
+	loader.RegisterArgHandler(&loader.ArgHandler{
+		Prefix: "xtest:",
+		Value:  "path",
+		Usage:  "test handler",
+		Handle: func(conf *loader.Config, path string, xtest bool) error {
+			if path == "" {
+				return fmt.Errorf("empty path")
+			}
+			conf.ImportWithTests(path + "_x")
+			return nil
+		},
+	})
+	defer loader.UnregisterArgHandler("xtest:")
+
+	var conf loader.Config
+	rest, err := conf.FromArgs([]string{"a", "notest:b", "test:c", "xtest:d", "tags=foo,bar", "--", "notest:e"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"notest:e"}; !reflect.DeepEqual(rest, want) {
+		t.Errorf("rest = %q, want %q", rest, want)
+	}
+	if want := map[string]bool{"a": true, "b": false, "c": true, "d_x": true}; !reflect.DeepEqual(conf.ImportPkgs, want) {
+		t.Errorf("ImportPkgs = %v, want %v", conf.ImportPkgs, want)
+	}
+	if got := conf.Build.BuildTags; len(got) < 2 || got[len(got)-2] != "foo" || got[len(got)-1] != "bar" {
+		t.Errorf("BuildTags = %q, want suffix [foo bar]", got)
+	}
+
+	// Files named by prefixed arguments create separate packages.
+	conf = loader.Config{}
+	if _, err := conf.FromArgs([]string{"file=a.go", "file=b.go", "notest:c"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.CreatePkgs) != 2 || len(conf.ImportPkgs) != 1 {
+		t.Errorf("got CreatePkgs=%v ImportPkgs=%v", conf.CreatePkgs, conf.ImportPkgs)
+	}
+
+	// Handler errors are reported with the argument.
+	if _, err := conf.FromArgs([]string{"xtest:"}, false); err == nil || err.Error() != "xtest:: empty path" {
+		t.Errorf("FromArgs error = %v, want %q", err, "xtest:: empty path")
+	}
+
+	usage := loader.ArgsUsage()
+	if !strings.HasPrefix(usage, loader.FromArgsUsage) {
+		t.Errorf("ArgsUsage does not begin with FromArgsUsage")
+	}
+	for _, want := range []string{"notest:path", "tags=list", "xtest:path           test handler"} {
+		if !strings.Contains(usage, want) {
+			t.Errorf("ArgsUsage does not mention %q:\n%s", want, usage)
+		}
+	}
+}
+
+func TestUnregisterArgHandler(t *testing.T) {
+	loader.RegisterArgHandler(&loader.ArgHandler{
+		Prefix: "gone:",
+		Handle: func(conf *loader.Config, path string, xtest bool) error { return nil },
+	})
+	loader.UnregisterArgHandler("gone:")
+
+	var conf loader.Config
+	if _, err := conf.FromArgs([]string{"gone:a"}, false); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"gone:a": false}; !reflect.DeepEqual(conf.ImportPkgs, want) {
+		t.Errorf("ImportPkgs = %v, want %v", conf.ImportPkgs, want)
+	}
+	if strings.Contains(loader.ArgsUsage(), "gone:") {
+		t.Errorf("ArgsUsage mentions unregistered prefix gone:")
+	}
+}
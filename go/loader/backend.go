@@ -0,0 +1,82 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the registry of import backends.
+
+import (
+	"go/build"
+	"strings"
+	"sync"
+)
+
+// A Backend finds the packages of a synthetic namespace of import
+// paths, such as one for generated or protocol buffer packages, in
+// place of go/build.  Its signature and obligations are those of
+// Config.FindPackage.
+type Backend func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = make(map[string]Backend) // by prefix
+)
+
+// RegisterBackend registers the backend that finds the packages whose
+// import paths are prefix, or begin with prefix followed by a slash.
+// A trailing "/..." in prefix is ignored, so "proto/..." and "proto"
+// are equivalent.  Load consults the registered backends, before
+// go/build, using the one with the longest matching prefix, in every
+// Config whose FindPackage is nil; an explicit FindPackage hook is
+// never overridden.
+//
+// RegisterBackend is typically called from an init function.  It
+// panics if a backend is already registered for prefix.
+//
+func RegisterBackend(prefix string, backend Backend) {
+	prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, "..."), "/")
+	if prefix == "" || backend == nil {
+		panic("loader: RegisterBackend: empty prefix or nil backend")
+	}
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	if _, dup := backends[prefix]; dup {
+		panic("loader: RegisterBackend called twice for " + prefix)
+	}
+	backends[prefix] = backend
+}
+
+// UnregisterBackend removes the backend registered for prefix, if any.
+func UnregisterBackend(prefix string) {
+	prefix = strings.TrimSuffix(strings.TrimSuffix(prefix, "..."), "/")
+	backendsMu.Lock()
+	delete(backends, prefix)
+	backendsMu.Unlock()
+}
+
+// defaultFindPackage is the FindPackage hook of a Config that has
+// none: it uses the registered backend for importPath, if any, or
+// go/build.
+func defaultFindPackage(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+	if b := backendFor(importPath); b != nil {
+		return b(ctxt, importPath, fromDir, mode)
+	}
+	return ctxt.Import(importPath, fromDir, mode)
+}
+
+// backendFor returns the registered backend for importPath, or nil.
+func backendFor(importPath string) Backend {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	for prefix := importPath; ; {
+		if b, ok := backends[prefix]; ok {
+			return b
+		}
+		i := strings.LastIndex(prefix, "/")
+		if i < 0 {
+			return nil
+		}
+		prefix = prefix[:i]
+	}
+}
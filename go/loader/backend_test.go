@@ -0,0 +1,94 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/build"
+	"go/types"
+	"path"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestBackends(t *testing.T) {
+	// Each backend serves its packages from a directory of the
+	// fake file tree, named by the last element of the import path.
+	backend := func(name string) loader.Backend {
+		return func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+			return &build.Package{
+				ImportPath: importPath,
+				Dir:        "/go/src/" + name + "/" + path.Base(importPath),
+				GoFiles:    []string{"x.go"},
+			}, nil
+		}
+	}
+	loader.RegisterBackend("backendtest/gen/...", backend("gen"))
+	loader.RegisterBackend("backendtest/gen/special", backend("special"))
+	defer loader.UnregisterBackend("backendtest/gen/...")
+	defer loader.UnregisterBackend("backendtest/gen/special")
+
+	conf := loader.Config{
+		Build: fakeContext(map[string]string{
+			"main":            `package main; import ("backendtest/gen/foo"; "backendtest/gen/special"); var _, _ = foo.Gen, special.Special`,
+			"gen/foo":         `package foo; const Gen = 1`,
+			"special/special": `package special; const Special = 1`,
+		}),
+	}
+	conf.Import("main")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"backendtest/gen/foo", "backendtest/gen/special"} {
+		if prog.Package(path) == nil {
+			t.Errorf("package %s was not loaded", path)
+		}
+	}
+
+	// Only whole path segments match.
+	conf = loader.Config{
+		Build:       fakeContext(map[string]string{"main": `package main; import _ "backendtest/generated"`}),
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+	}
+	conf.Import("main")
+	prog, err = conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasError(prog.Package("main").Errors, `cannot find package "backendtest/generated"`) {
+		t.Errorf("errors = %v, want 'cannot find package'", prog.Package("main").Errors)
+	}
+
+	// An explicit FindPackage hook takes precedence.
+	conf = loader.Config{
+		Build: fakeContext(map[string]string{
+			"main":    `package main; import _ "backendtest/gen/foo"`,
+			"gen/bar": `package foo; const Bar = 1`,
+		}),
+		FindPackage: func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+			if importPath == "backendtest/gen/foo" {
+				return &build.Package{ImportPath: importPath, Dir: "/go/src/gen/bar", GoFiles: []string{"x.go"}}, nil
+			}
+			return ctxt.Import(importPath, fromDir, mode)
+		},
+	}
+	conf.Import("main")
+	prog, err = conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := prog.Package("backendtest/gen/foo"); info == nil || info.Pkg.Scope().Lookup("Bar") == nil {
+		t.Errorf("package backendtest/gen/foo was not found by FindPackage")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("duplicate RegisterBackend did not panic")
+		}
+	}()
+	loader.RegisterBackend("backendtest/gen", backend("gen"))
+}
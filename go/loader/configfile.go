@@ -0,0 +1,156 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the JSON encoding of a Config.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// jsonConfig is the JSON encoding of the declarative parts of a Config.
+type jsonConfig struct {
+	ImportPkgs       map[string]bool `json:",omitempty"`
+	CreatePkgs       []jsonPkgSpec   `json:",omitempty"`
+	BuildTags        []string        `json:",omitempty"`
+	GOOS             string          `json:",omitempty"`
+	GOARCH           string          `json:",omitempty"`
+	GOROOT           string          `json:",omitempty"`
+	GOPATH           string          `json:",omitempty"`
+	Cwd              string          `json:",omitempty"`
+	Compiler         string          `json:",omitempty"`
+	InstallSuffix    string          `json:",omitempty"`
+	PkgDirs          []string        `json:",omitempty"`
+	ImportFromBinary bool            `json:",omitempty"`
+	AllowErrors      bool            `json:",omitempty"`
+	Parallelism      int             `json:",omitempty"`
+	SplitCreatePkgs  bool            `json:",omitempty"`
+}
+
+type jsonPkgSpec struct {
+	Path      string `json:",omitempty"`
+	Filenames []string
+}
+
+// MarshalJSON encodes the declarative parts of the configuration:
+// the initial packages, the build tags, GOOS and GOARCH of the
+// effective build context, and the scalar options.
+//
+// Hooks and other function-valued fields are not encoded, except that
+// a non-nil ImportFromBinary is recorded as if it held for every
+// package.  It is an error if CreatePkgs contains already-parsed files.
+func (conf *Config) MarshalJSON() ([]byte, error) {
+	ctxt := conf.build()
+	jc := jsonConfig{
+		ImportPkgs:       conf.ImportPkgs,
+		BuildTags:        ctxt.BuildTags,
+		GOOS:             ctxt.GOOS,
+		GOARCH:           ctxt.GOARCH,
+		GOROOT:           conf.GOROOT,
+		GOPATH:           conf.GOPATH,
+		Cwd:              conf.Cwd,
+		Compiler:         conf.Compiler,
+		InstallSuffix:    conf.InstallSuffix,
+		PkgDirs:          conf.PkgDirs,
+		ImportFromBinary: conf.ImportFromBinary != nil,
+		AllowErrors:      conf.AllowErrors,
+		Parallelism:      conf.Parallelism,
+		SplitCreatePkgs:  conf.SplitCreatePkgs,
+	}
+	for _, cp := range conf.CreatePkgs {
+		if cp.Files != nil {
+			return nil, fmt.Errorf("can't encode package %q: it contains parsed files", cp.Path)
+		}
+		jc.CreatePkgs = append(jc.CreatePkgs, jsonPkgSpec{cp.Path, cp.Filenames})
+	}
+	return json.Marshal(jc)
+}
+
+// UnmarshalJSON updates the configuration from the encoding produced
+// by MarshalJSON.  If the encoding specifies build tags, GOOS or
+// GOARCH, conf.Build is replaced by a modified copy of the effective
+// build context.
+func (conf *Config) UnmarshalJSON(data []byte) error {
+	var jc jsonConfig
+	if err := json.Unmarshal(data, &jc); err != nil {
+		return err
+	}
+	for path, tests := range jc.ImportPkgs {
+		conf.addImport(path, tests)
+	}
+	for _, cp := range jc.CreatePkgs {
+		conf.CreateFromFilenames(cp.Path, cp.Filenames...)
+	}
+	if jc.BuildTags != nil || jc.GOOS != "" || jc.GOARCH != "" {
+		ctxt := *conf.build() // copy
+		if jc.BuildTags != nil {
+			ctxt.BuildTags = jc.BuildTags
+		}
+		if jc.GOOS != "" {
+			ctxt.GOOS = jc.GOOS
+		}
+		if jc.GOARCH != "" {
+			ctxt.GOARCH = jc.GOARCH
+		}
+		conf.Build = &ctxt
+	}
+	if jc.GOROOT != "" {
+		conf.GOROOT = jc.GOROOT
+	}
+	if jc.GOPATH != "" {
+		conf.GOPATH = jc.GOPATH
+	}
+	if jc.Cwd != "" {
+		conf.Cwd = jc.Cwd
+	}
+	if jc.Compiler != "" {
+		conf.Compiler = jc.Compiler
+	}
+	if jc.InstallSuffix != "" {
+		conf.InstallSuffix = jc.InstallSuffix
+	}
+	conf.PkgDirs = append(conf.PkgDirs, jc.PkgDirs...)
+	if jc.ImportFromBinary {
+		conf.ImportFromBinary = func(string) bool { return true }
+	}
+	if jc.AllowErrors {
+		conf.AllowErrors = true
+	}
+	if jc.Parallelism > 0 {
+		conf.Parallelism = jc.Parallelism
+	}
+	if jc.SplitCreatePkgs {
+		conf.SplitCreatePkgs = true
+	}
+	return nil
+}
+
+// LoadConfigFile returns a new Config decoded from the named JSON
+// file, as described at MarshalJSON.  A relative Cwd in the file is
+// interpreted relative to the directory containing the file; if Cwd
+// is absent, that directory is used.  The relative file names and
+// import paths of the initial packages are thus independent of the
+// directory in which the tool runs.
+func LoadConfigFile(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	conf := new(Config)
+	if err := conf.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(conf.Cwd) {
+		conf.Cwd = filepath.Join(dir, conf.Cwd)
+	}
+	return conf, nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"encoding/json"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestConfigJSON(t *testing.T) {
+	ctxt := build.Default // copy
+	ctxt.GOOS = "plan9"
+	ctxt.GOARCH = "386"
+	ctxt.BuildTags = []string{"foo"}
+	conf := loader.Config{
+		Build:       &ctxt,
+		Cwd:         "/home/user",
+		AllowErrors: true,
+		PkgDirs:     []string{"/objs"},
+	}
+	conf.ImportWithTests("fmt")
+	conf.Import("./...")
+	conf.CreateFromFilenames("main", "a.go", "b.go")
+
+	data, err := json.Marshal(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conf2 loader.Config
+	if err := json.Unmarshal(data, &conf2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(conf2.ImportPkgs, conf.ImportPkgs) {
+		t.Errorf("ImportPkgs = %v, want %v", conf2.ImportPkgs, conf.ImportPkgs)
+	}
+	if !reflect.DeepEqual(conf2.CreatePkgs, conf.CreatePkgs) {
+		t.Errorf("CreatePkgs = %v, want %v", conf2.CreatePkgs, conf.CreatePkgs)
+	}
+	if b := conf2.Build; b == nil || b.GOOS != "plan9" || b.GOARCH != "386" || !reflect.DeepEqual(b.BuildTags, ctxt.BuildTags) {
+		t.Errorf("Build = %+v, want GOOS=plan9 GOARCH=386 BuildTags=[foo]", b)
+	}
+	if conf2.Cwd != conf.Cwd || !conf2.AllowErrors || !reflect.DeepEqual(conf2.PkgDirs, conf.PkgDirs) {
+		t.Errorf("got Cwd=%q AllowErrors=%t PkgDirs=%q", conf2.Cwd, conf2.AllowErrors, conf2.PkgDirs)
+	}
+
+	// Parsed files cannot be encoded.
+	conf.CreateFromFiles("p", nil)
+	if _, err := json.Marshal(&conf); err == nil {
+		t.Errorf("Marshal of parsed files succeeded unexpectedly")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for name, content := range map[string]string{
+		"config.json": `{"CreatePkgs": [{"Filenames": ["src/a.go"]}], "ImportPkgs": {"errors": false}}`,
+		"src/a.go":    `package a; import _ "errors"`,
+	} {
+		filename := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf, err := loader.LoadConfigFile(filepath.Join(tmp, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir, _ := filepath.EvalSymlinks(tmp); conf.Cwd != tmp && conf.Cwd != dir {
+		t.Errorf("Cwd = %s, want %s", conf.Cwd, tmp)
+	}
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := created(prog), "a"; got != want {
+		t.Errorf("Created = %s, want %s", got, want)
+	}
+	if got, want := imported(prog), "errors"; got != want {
+		t.Errorf("Imported = %s, want %s", got, want)
+	}
+}
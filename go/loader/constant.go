@@ -0,0 +1,133 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines conveniences for querying constant values.
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"math"
+)
+
+// A Constant is the value of a constant expression or named constant,
+// together with its type, which may be untyped.
+//
+// Its accessors convert the value to a Go type and report whether the
+// conversion is possible without overflow; if not, they return zero.
+// Integer accessors accept floating-point and complex values that are
+// exact integers.  The zero Constant, which has no value, is of
+// unknown kind.
+type Constant struct {
+	Value constant.Value
+	Type  types.Type
+}
+
+// ConstantOf returns the value of e, and whether e is a constant
+// expression of the package.
+func (info *PackageInfo) ConstantOf(e ast.Expr) (Constant, bool) {
+	tv, ok := info.Types[e]
+	if !ok || tv.Value == nil {
+		return Constant{}, false
+	}
+	return Constant{tv.Value, tv.Type}, true
+}
+
+// ConstantOfObject returns the value of obj, and whether it is a named
+// constant.
+func ConstantOfObject(obj types.Object) (Constant, bool) {
+	c, ok := obj.(*types.Const)
+	if !ok {
+		return Constant{}, false
+	}
+	return Constant{c.Val(), c.Type()}, true
+}
+
+// Kind returns the kind of the constant's value, or constant.Unknown
+// if it has none.
+func (c Constant) Kind() constant.Kind {
+	if c.Value == nil {
+		return constant.Unknown
+	}
+	return c.Value.Kind()
+}
+
+func (c Constant) String() string {
+	if c.Value == nil {
+		return constant.MakeUnknown().String()
+	}
+	return c.Value.String()
+}
+
+// Int64 returns the value as an int64, if it is an integer in range.
+func (c Constant) Int64() (int64, bool) {
+	v := constant.ToInt(c.Value)
+	if v.Kind() != constant.Int {
+		return 0, false
+	}
+	if x, ok := constant.Int64Val(v); ok {
+		return x, true
+	}
+	return 0, false
+}
+
+// Uint64 returns the value as a uint64, if it is an integer in range.
+func (c Constant) Uint64() (uint64, bool) {
+	v := constant.ToInt(c.Value)
+	if v.Kind() != constant.Int {
+		return 0, false
+	}
+	if x, ok := constant.Uint64Val(v); ok {
+		return x, true
+	}
+	return 0, false
+}
+
+// Float64 returns the value as a float64, rounded to the nearest
+// float64, if it is a real number whose magnitude does not overflow.
+func (c Constant) Float64() (float64, bool) {
+	v := constant.ToFloat(c.Value)
+	if v.Kind() != constant.Float && v.Kind() != constant.Int {
+		return 0, false
+	}
+	f, _ := constant.Float64Val(v)
+	if math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+// Complex128 returns the value as a complex128, if it is a number
+// whose parts do not overflow a float64.
+func (c Constant) Complex128() (complex128, bool) {
+	v := constant.ToComplex(c.Value)
+	if v.Kind() != constant.Complex {
+		return 0, false
+	}
+	re, _ := constant.Float64Val(constant.Real(v))
+	im, _ := constant.Float64Val(constant.Imag(v))
+	if math.IsInf(re, 0) || math.IsInf(im, 0) {
+		return 0, false
+	}
+	return complex(re, im), true
+}
+
+// Bool returns the value as a bool, if it is a boolean.
+func (c Constant) Bool() (bool, bool) {
+	if c.Kind() != constant.Bool {
+		return false, false
+	}
+	return constant.BoolVal(c.Value), true
+}
+
+// StringVal returns the value as a string, if it is a string.  The
+// result is unquoted, unlike that of String.
+func (c Constant) StringVal() (string, bool) {
+	if c.Kind() != constant.String {
+		return "", false
+	}
+	return constant.StringVal(c.Value), true
+}
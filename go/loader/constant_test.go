@@ -0,0 +1,106 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestConstant(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a
+const (
+	Small   = 42
+	Neg     = -1
+	Big     = 1 << 70
+	MaxU    = 1<<64 - 1
+	Integral = 3.0
+	Half    = 0.5
+	Huge    = 1e400
+	Cplx    = 1 + 2i
+	True    = true
+	Str     = "a\tb"
+	Typed   int8 = -128
+)
+var v = Small + 1
+var w = len("abc") + len([]int{})
+`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	info := prog.Imported["a"]
+	scope := info.Pkg.Scope()
+
+	describe := func(c loader.Constant) string {
+		i, iok := c.Int64()
+		u, uok := c.Uint64()
+		f, fok := c.Float64()
+		z, zok := c.Complex128()
+		b, bok := c.Bool()
+		s, sok := c.StringVal()
+		return fmt.Sprintf("%s %s: %d/%t %d/%t %g/%t %g/%t %t/%t %q/%t",
+			c.Type, c, i, iok, u, uok, f, fok, z, zok, b, bok, s, sok)
+	}
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"Small", "untyped int 42: 42/true 42/true 42/true (42+0i)/true false/false \"\"/false"},
+		{"Neg", "untyped int -1: -1/true 0/false -1/true (-1+0i)/true false/false \"\"/false"},
+		{"Big", "untyped int 1180591620717411303424: 0/false 0/false 1.1805916207174113e+21/true (1.1805916207174113e+21+0i)/true false/false \"\"/false"},
+		{"MaxU", "untyped int 18446744073709551615: 0/false 18446744073709551615/true 1.8446744073709552e+19/true (1.8446744073709552e+19+0i)/true false/false \"\"/false"},
+		{"Integral", "untyped float 3: 3/true 3/true 3/true (3+0i)/true false/false \"\"/false"},
+		{"Half", "untyped float 0.5: 0/false 0/false 0.5/true (0.5+0i)/true false/false \"\"/false"},
+		{"Huge", "untyped float 1e+400: 0/false 0/false 0/false (0+0i)/false false/false \"\"/false"},
+		{"Cplx", "untyped complex (1 + 2i): 0/false 0/false 0/false (1+2i)/true false/false \"\"/false"},
+		{"True", "untyped bool true: 0/false 0/false 0/false (0+0i)/false true/true \"\"/false"},
+		{"Str", "untyped string \"a\\tb\": 0/false 0/false 0/false (0+0i)/false false/false \"a\\tb\"/true"},
+		{"Typed", "int8 -128: -128/true 0/false -128/true (-128+0i)/true false/false \"\"/false"},
+	} {
+		c, ok := loader.ConstantOfObject(scope.Lookup(test.name))
+		if !ok {
+			t.Errorf("ConstantOfObject(%s) failed", test.name)
+			continue
+		}
+		if got := describe(c); got != test.want {
+			t.Errorf("%s: got  %s\nwant %s", test.name, got, test.want)
+		}
+	}
+	if c, ok := loader.ConstantOfObject(scope.Lookup("v")); ok {
+		t.Errorf("ConstantOfObject(v) succeeded")
+	} else if got, want := describe(c), "%!s(<nil>) unknown: 0/false 0/false 0/false (0+0i)/false false/false \"\"/false"; got != want {
+		t.Errorf("zero Constant: got  %s\nwant %s", got, want)
+	} else if c.Kind() != constant.Unknown {
+		t.Errorf("zero Constant: Kind = %v", c.Kind())
+	}
+
+	// Expressions.
+	var got []string
+	ast.Inspect(info.Files[0], func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok {
+			if c, ok := info.ConstantOf(call); ok {
+				got = append(got, c.String())
+			} else {
+				got = append(got, "-")
+			}
+		}
+		if bin, ok := n.(*ast.BinaryExpr); ok && fmt.Sprint(bin.X) == "Small" {
+			c, _ := info.ConstantOf(bin)
+			got = append(got, c.String())
+		}
+		return true
+	})
+	if s := fmt.Sprint(got); s != "[43 3 -]" {
+		t.Errorf("ConstantOf(expressions) = %s", s)
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines a stable representation of the errors of a
+// Program, for editor integrations and other tools.
+
+import (
+	"encoding/json"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"strings"
+)
+
+// DiagnosticsVersion is the version of the diagnostics schema: the
+// Diagnostic type and those it refers to.  It changes whenever the
+// schema changes incompatibly.
+const DiagnosticsVersion = 1
+
+// A DiagnosticPosition is a location in a file.  Line and Column are
+// 1-based; Column and Offset are measured in bytes.  A position with
+// an empty Filename is unknown.
+type DiagnosticPosition struct {
+	Filename string
+	Line     int
+	Column   int
+	Offset   int
+}
+
+// A DiagnosticRange is the source interval [Start, End).  When only a
+// point is known, End equals Start.
+type DiagnosticRange struct {
+	Start, End DiagnosticPosition
+}
+
+// A Severity classifies a diagnostic.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// A RelatedInformation is a secondary location relevant to a
+// diagnostic, such as the other declaration of a redeclared name.
+type RelatedInformation struct {
+	Range   DiagnosticRange
+	Message string
+}
+
+// A Diagnostic is a message about a location of a Program.
+type Diagnostic struct {
+	Package  string // path of the package in which it was reported
+	Range    DiagnosticRange
+	Severity Severity
+	Source   string // "parser", "typechecker", or "loader"
+	Message  string
+	Related  []RelatedInformation `json:",omitempty"`
+}
+
+// DiagnosticsReport is the schema of the JSON document written by
+// WriteDiagnostics.
+type DiagnosticsReport struct {
+	Version     int // DiagnosticsVersion
+	Diagnostics []Diagnostic
+}
+
+// Diagnostics returns the errors of all packages of the program as
+// diagnostics, ordered by package as by SortedPackages, and then in
+// the order reported.  Positions are those of prog.Position.
+//
+// The type checker reports some errors as a primary error followed
+// by continuation errors whose messages begin with a tab, such as
+// "\tother declaration of x".  These become the related information
+// of the primary diagnostic.
+//
+func (prog *Program) Diagnostics() []Diagnostic {
+	var diags []Diagnostic
+	for _, info := range prog.SortedPackages() {
+		for _, err := range info.Errors {
+			d := Diagnostic{
+				Package:  info.Pkg.Path(),
+				Severity: SeverityError,
+				Source:   "loader",
+				Message:  err.Error(),
+			}
+			switch err := err.(type) {
+			case types.Error:
+				d.Source = "typechecker"
+				d.Range = prog.pointRange(err.Pos)
+				d.Message = err.Msg
+				if strings.HasPrefix(err.Msg, "\t") && len(diags) > 0 && diags[len(diags)-1].Package == d.Package {
+					prev := &diags[len(diags)-1]
+					prev.Related = append(prev.Related, RelatedInformation{d.Range, strings.TrimSpace(err.Msg)})
+					continue
+				}
+			case scanner.ErrorList:
+				for _, e := range err {
+					diags = append(diags, Diagnostic{
+						Package:  d.Package,
+						Range:    positionRange(e.Pos),
+						Severity: SeverityError,
+						Source:   "parser",
+						Message:  e.Msg,
+					})
+				}
+				continue
+			case *scanner.Error:
+				d.Source = "parser"
+				d.Range = positionRange(err.Pos)
+				d.Message = err.Msg
+			}
+			diags = append(diags, d)
+		}
+	}
+	return diags
+}
+
+// WriteDiagnostics writes the diagnostics of the program to w as a
+// JSON document of the form described by DiagnosticsReport.
+func (prog *Program) WriteDiagnostics(w io.Writer) error {
+	report := DiagnosticsReport{
+		Version:     DiagnosticsVersion,
+		Diagnostics: prog.Diagnostics(),
+	}
+	if report.Diagnostics == nil {
+		report.Diagnostics = []Diagnostic{}
+	}
+	data, err := json.MarshalIndent(&report, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// pointRange returns the empty range at pos.
+func (prog *Program) pointRange(pos token.Pos) DiagnosticRange {
+	if !pos.IsValid() {
+		return DiagnosticRange{}
+	}
+	return positionRange(prog.Position(pos))
+}
+
+// positionRange returns the empty range at posn.
+func positionRange(posn token.Position) DiagnosticRange {
+	p := DiagnosticPosition{posn.Filename, posn.Line, posn.Column, posn.Offset}
+	return DiagnosticRange{p, p}
+}
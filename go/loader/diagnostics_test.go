@@ -0,0 +1,62 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestDiagnostics(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import _ "b"; import _ "c"; var x int; var x int; var y int = ""`,
+		"b": `package b; func (`,
+	})
+	conf := loader.Config{Build: ctxt, AllowErrors: true}
+	conf.TypeChecker.Error = func(error) {}
+	conf.Import("a")
+	conf.CreateFromFilenames("c", "/go/src/c/nonesuch.go")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := prog.WriteDiagnostics(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var report loader.DiagnosticsReport
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.Bytes())
+	}
+	if report.Version != loader.DiagnosticsVersion {
+		t.Errorf("Version = %d", report.Version)
+	}
+	var got []string
+	for _, d := range report.Diagnostics {
+		s := fmt.Sprintf("%s %s %s %s:%d:%d", d.Package, d.Severity, d.Source,
+			d.Range.Start.Filename, d.Range.Start.Line, d.Range.Start.Column)
+		for _, r := range d.Related {
+			s += fmt.Sprintf(" [%s at %d:%d]", r.Message, r.Range.Start.Line, r.Range.Start.Column)
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		"a error typechecker /go/src/a/x.go:1:35", // missing package c
+		"a error typechecker /go/src/a/x.go:1:55 [other declaration of x at 1:44]",
+		"a error typechecker /go/src/a/x.go:1:74",
+		"b error parser /go/src/b/x.go:1:18",
+		"b error typechecker /go/src/b/x.go:1:17",
+		"c error loader :0:0", // missing file
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		t.Errorf("Diagnostics:\n%s\nwant:\n%s", g, w)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the index of compiler directives.
+
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// A Directive is a compiler directive: a line comment of the form
+// "//go:name args", with no space after the slashes, such as
+// //go:noinline or "//go:linkname local remote".
+type Directive struct {
+	Name string    // directive name, without "go:", e.g. "linkname"
+	Args string    // remainder of the comment, with spaces trimmed
+	Pos  token.Pos // position of the comment
+	File *ast.File // file containing the comment
+
+	// Decl is the declaration to which the directive is attached,
+	// that is, whose doc comment contains it, or nil.
+	Decl ast.Decl
+}
+
+// fileDirectives returns the compiler directives of f, in order.
+func fileDirectives(f *ast.File) []Directive {
+	// Map each doc comment group to its declaration.
+	docs := make(map[*ast.CommentGroup]ast.Decl)
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Doc != nil {
+				docs[decl.Doc] = decl
+			}
+		case *ast.GenDecl:
+			if decl.Doc != nil {
+				docs[decl.Doc] = decl
+			}
+		}
+	}
+
+	var directives []Directive
+	for _, group := range f.Comments {
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, "//go:") {
+				continue
+			}
+			text := c.Text[len("//go:"):]
+			name, args := text, ""
+			if i := strings.IndexAny(text, " \t"); i >= 0 {
+				name, args = text[:i], strings.TrimSpace(text[i:])
+			}
+			if name == "" {
+				continue
+			}
+			directives = append(directives, Directive{
+				Name: name,
+				Args: args,
+				Pos:  c.Pos(),
+				File: f,
+				Decl: docs[group],
+			})
+		}
+	}
+	return directives
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestDirectives(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a
+
+//go:generate stringer -type=T
+
+// f is not inlined.
+//go:noinline
+func f() {}
+
+//go:linkname   g runtime.g
+var g int
+
+// go:nosplit is not a directive.
+/*go:nosplit neither is this */
+//go:
+func h() {}
+
+type T int // go:T is not attached
+`,
+	})
+	load := func(index bool) *loader.PackageInfo {
+		conf := loader.Config{Build: ctxt, ParserMode: parser.ParseComments, IndexDirectives: index}
+		conf.Import("a")
+		prog, err := conf.Load()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		return prog.Imported["a"]
+	}
+
+	if info := load(false); info.Directives != nil {
+		t.Errorf("Directives = %v without IndexDirectives", info.Directives)
+	}
+
+	info := load(true)
+	var got []string
+	for _, d := range info.Directives {
+		if d.File != info.Files[0] || !d.Pos.IsValid() {
+			t.Errorf("directive %s has wrong file or position", d.Name)
+		}
+		decl := "nil"
+		switch n := d.Decl.(type) {
+		case *ast.FuncDecl:
+			decl = n.Name.Name
+		case *ast.GenDecl:
+			decl = n.Specs[0].(*ast.ValueSpec).Names[0].Name
+		}
+		got = append(got, fmt.Sprintf("%s(%s)->%s", d.Name, d.Args, decl))
+	}
+	want := "generate(stringer -type=T)->nil noinline()->f linkname(g runtime.g)->g"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("Directives = %s, want %s", s, want)
+	}
+}
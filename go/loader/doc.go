@@ -45,6 +45,11 @@
 //      // Finally, load all the packages specified by the configuration.
 //      prog, err := conf.Load()
 //
+// Alternatively, New creates a Config from a list of Options, which
+// may be given in any order:
+//
+//      conf := loader.New(loader.WithImports("fmt"), loader.WithTests())
+//
 // See examples_test.go for examples of API usage.
 //
 //
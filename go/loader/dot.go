@@ -0,0 +1,111 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the Graphviz rendering of the import graph.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DOTOptions controls the output of WriteDOT.
+type DOTOptions struct {
+	// CollapseStd causes all the packages of the standard library
+	// to be represented by a single node, "std".  A package is
+	// assumed to belong to the standard library if the first
+	// element of its path contains no dot.
+	CollapseStd bool
+
+	// HighlightTests causes test packages, that is, external test
+	// packages and packages augmented by their tests, to be drawn
+	// in a distinct color.
+	HighlightTests bool
+
+	// Pattern, if non-empty, restricts the graph to packages whose
+	// paths match it.  Patterns are as for Config.Import, but must
+	// not be relative, for example "golang.org/x/tools/...".
+	Pattern string
+}
+
+// WriteDOT writes the import graph of the program to w in the DOT
+// language of Graphviz, whose dot command can render it as a diagram.
+//
+// Nodes and edges appear in a deterministic order.  A nil opts is
+// equivalent to a pointer to the zero DOTOptions.
+//
+func (prog *Program) WriteDOT(w io.Writer, opts *DOTOptions) error {
+	if opts == nil {
+		opts = new(DOTOptions)
+	}
+	include := func(*PackageInfo) bool { return true }
+	if opts.Pattern != "" {
+		match := matchPattern(opts.Pattern)
+		include = func(info *PackageInfo) bool { return match(info.Pkg.Path()) }
+	}
+	name := func(info *PackageInfo) string {
+		if opts.CollapseStd && info.Importable && isStandardPath(info.Pkg.Path()) {
+			return "std"
+		}
+		return info.Pkg.Path()
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph program {")
+	g := prog.ImportGraph()
+	nodes := make(map[string]bool)
+	edges := make(map[[2]string]bool)
+	for _, info := range prog.SortedPackages() {
+		if !include(info) {
+			continue
+		}
+		from := name(info)
+		if !nodes[from] {
+			nodes[from] = true
+			fmt.Fprintf(out, "\t%s", strconv.Quote(from))
+			if opts.HighlightTests && prog.isTestPackage(info) {
+				fmt.Fprint(out, " [style=filled, fillcolor=lightblue]")
+			}
+			fmt.Fprintln(out, ";")
+		}
+		for _, dep := range g.Imports[info] {
+			to := name(dep)
+			if !include(dep) || to == from || edges[[2]string{from, to}] {
+				continue
+			}
+			edges[[2]string{from, to}] = true
+			fmt.Fprintf(out, "\t%s -> %s;\n", strconv.Quote(from), strconv.Quote(to))
+		}
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// isStandardPath reports whether path is likely to denote a package
+// of the standard library, that is, whether its first element
+// contains no dot.
+func isStandardPath(path string) bool {
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	return !strings.Contains(path, ".")
+}
+
+// isTestPackage reports whether info is an external test package or
+// a package augmented by its in-package tests.
+func (prog *Program) isTestPackage(info *PackageInfo) bool {
+	if info.Origin != nil && info.Origin.Spec < 0 {
+		return true
+	}
+	for _, f := range info.Files {
+		if isTestFile(prog.Fset, f) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestWriteDOT(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"example.com/a": {
+			"a.go":      `package a; import (_ "errors"; _ "example.com/b")`,
+			"a_test.go": `package a_test; import (_ "example.com/a"; _ "io")`,
+		},
+		"example.com/b": {"b.go": `package b; import _ "io"`},
+		"errors":        {"errors.go": `package errors`},
+		"io":            {"io.go": `package io; import _ "errors"`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.ImportWithTests("example.com/a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, test := range []struct {
+		opts *loader.DOTOptions
+		want string
+	}{
+		{nil, `digraph program {
+	"errors";
+	"example.com/a";
+	"example.com/a" -> "errors";
+	"example.com/a" -> "example.com/b";
+	"example.com/a_test";
+	"example.com/a_test" -> "example.com/a";
+	"example.com/a_test" -> "io";
+	"example.com/b";
+	"example.com/b" -> "io";
+	"io";
+	"io" -> "errors";
+}
+`},
+		{&loader.DOTOptions{CollapseStd: true, HighlightTests: true}, `digraph program {
+	"std";
+	"example.com/a";
+	"example.com/a" -> "std";
+	"example.com/a" -> "example.com/b";
+	"example.com/a_test" [style=filled, fillcolor=lightblue];
+	"example.com/a_test" -> "example.com/a";
+	"example.com/a_test" -> "std";
+	"example.com/b";
+	"example.com/b" -> "std";
+}
+`},
+		{&loader.DOTOptions{Pattern: "example.com/..."}, `digraph program {
+	"example.com/a";
+	"example.com/a" -> "example.com/b";
+	"example.com/a_test";
+	"example.com/a_test" -> "example.com/a";
+	"example.com/b";
+}
+`},
+	} {
+		var buf bytes.Buffer
+		if err := prog.WriteDOT(&buf, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("WriteDOT(%+v) =\n%s\nwant:\n%s", test.opts, got, test.want)
+		}
+	}
+}
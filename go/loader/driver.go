@@ -0,0 +1,107 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the protocol by which an external build system
+// supplies package metadata to the loader.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"os/exec"
+	"strings"
+)
+
+// A DriverRequest is the JSON request sent to the standard input of an
+// external driver program, once for each package to find.
+type DriverRequest struct {
+	ImportPath string   // import path, as written in an import declaration
+	FromDir    string   // directory of the importing package, for relative and vendored imports
+	GOOS       string   // target operating system
+	GOARCH     string   // target architecture
+	BuildTags  []string // additional build tags
+}
+
+// A DriverResponse is the JSON response written by an external driver
+// program to its standard output.  File names may be relative to Dir
+// or absolute, so a package's files need not share a directory.
+type DriverResponse struct {
+	ImportPath   string   // canonical import path of the package
+	Name         string   // package name
+	Dir          string   // directory of the package, for resolving its imports
+	GoFiles      []string // Go source files, including generated ones
+	CgoFiles     []string // Go source files that import "C"
+	TestGoFiles  []string // in-package test files
+	XTestGoFiles []string // external test files
+	Imports      []string // imports of GoFiles and CgoFiles
+	TestImports  []string // imports of TestGoFiles
+	XTestImports []string // imports of XTestGoFiles
+	ExportFile   string   // file containing the export data of the package, if any
+	Goroot       bool     // package is in the standard library
+
+	// Error, if non-empty, reports that the package could not be
+	// found or is invalid.
+	Error string
+}
+
+// DriverFindPackage returns a Config.FindPackage hook that runs the
+// external driver program command, with the specified arguments, once
+// for each package to find, following the protocol of DriverRequest
+// and DriverResponse.  A failure of the program, including a non-zero
+// exit status, is reported as an error for the package.
+//
+// This lets users of build systems such as Bazel, Buck, or Pants make
+// the loader see the packages as their build system does, including
+// generated files and synthetic packages that go/build cannot find.
+// The loader never runs a driver unless a client installs this hook
+// explicitly:
+//
+//	conf.FindPackage = loader.DriverFindPackage("/path/to/driver", "-flag")
+//
+func DriverFindPackage(command string, args ...string) func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+	return func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+		req, err := json.Marshal(DriverRequest{
+			ImportPath: importPath,
+			FromDir:    fromDir,
+			GOOS:       ctxt.GOOS,
+			GOARCH:     ctxt.GOARCH,
+			BuildTags:  ctxt.BuildTags,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(command, args...)
+		cmd.Stdin = bytes.NewReader(req)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("driver %s: %v: %s", command, err, strings.TrimSpace(stderr.String()))
+		}
+		var resp DriverResponse
+		if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+			return nil, fmt.Errorf("driver %s: invalid response for %s: %v", command, importPath, err)
+		}
+		if resp.Error != "" {
+			return nil, fmt.Errorf("driver %s: %s: %s", command, importPath, resp.Error)
+		}
+		return &build.Package{
+			ImportPath:   resp.ImportPath,
+			Name:         resp.Name,
+			Dir:          resp.Dir,
+			GoFiles:      resp.GoFiles,
+			CgoFiles:     resp.CgoFiles,
+			TestGoFiles:  resp.TestGoFiles,
+			XTestGoFiles: resp.XTestGoFiles,
+			Imports:      resp.Imports,
+			TestImports:  resp.TestImports,
+			XTestImports: resp.XTestImports,
+			PkgObj:       resp.ExportFile,
+			Goroot:       resp.Goroot,
+		}, nil
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// TestDriverHelperProcess is not a real test: it is the external
+// driver program run by TestDriver.
+func TestDriverHelperProcess(t *testing.T) {
+	if os.Getenv("GO_LOADER_TEST_DRIVER") != "1" {
+		return
+	}
+	var req loader.DriverRequest
+	if err := json.NewDecoder(os.Stdin).Decode(&req); err != nil {
+		os.Exit(2)
+	}
+	dir := os.Getenv("GO_LOADER_TEST_DIR")
+	resp := loader.DriverResponse{Error: "no such package"}
+	if req.ImportPath == "p" {
+		resp = loader.DriverResponse{
+			ImportPath: "example.com/p",
+			Name:       "p",
+			Dir:        filepath.Join(dir, "src"),
+			GoFiles:    []string{"p.go", filepath.Join(dir, "gen", "p_gen.go")},
+		}
+	}
+	json.NewEncoder(os.Stdout).Encode(resp)
+	os.Exit(0)
+}
+
+func TestDriver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "driver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"src/p.go":     "package p; const X = Y",
+		"gen/p_gen.go": "package p; const Y = 1",
+	} {
+		filename := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, value := range map[string]string{
+		"GO_LOADER_TEST_DRIVER": "1",
+		"GO_LOADER_TEST_DIR":    dir,
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+	driver := loader.DriverFindPackage(os.Args[0], "-test.run=^TestDriverHelperProcess$")
+
+	conf := loader.Config{FindPackage: driver}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	info := prog.Imported["example.com/p"]
+	if info == nil || len(info.Files) != 2 || info.Pkg.Scope().Lookup("X") == nil {
+		t.Fatalf("Load via driver: package p = %v", info)
+	}
+
+	conf = loader.Config{FindPackage: driver}
+	conf.Import("q")
+	if _, err := conf.Load(); err == nil {
+		t.Errorf("Load of unknown package via driver succeeded")
+	}
+}
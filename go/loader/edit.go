@@ -0,0 +1,209 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the re-checking of a package after an edit.
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"path/filepath"
+	"strconv"
+)
+
+// CheckFileEdit parses newSrc, the new contents of the file of the
+// program named filename, and type-checks the file's package anew,
+// with the new file in place of the old.  It returns a new PackageInfo
+// for the package, whose Errors report any parse and type errors,
+// which are also reported to the Config's TypeChecker.Error function,
+// as by Load.  The other files of the package are not parsed again,
+// and their syntax trees are shared with the original PackageInfo;
+// they include generated files excluded from Files by
+// Config.ExcludeGenerated.
+//
+// The new file is subject to the Config's Preprocess, MutateAST and
+// InstrumentStmt hooks, as it would be when loaded.  MutateAST is
+// called with the new file alone, and must return a single file.
+//
+// The dependencies of the package are those of the program, so the
+// cost is that of checking a single package; this makes it suitable
+// for computing diagnostics in an editor as the user types.  An import
+// of a package not in the program is reported as an error.
+//
+// The program is not modified: its PackageInfo for the package, and
+// the packages that import it, are unchanged.  The new file is added
+// to the program's FileSet.
+//
+// CheckFileEdit returns an error if the program has no such file or
+// newSrc could not be parsed at all.
+//
+func (prog *Program) CheckFileEdit(filename string, newSrc []byte) (*PackageInfo, error) {
+	fi, ok := prog.files[filepath.Clean(filename)]
+	if !ok {
+		return nil, fmt.Errorf("file %s is not in the program", filename)
+	}
+	old := fi.info
+	name := prog.Fset.File(fi.file.Pos()).Name()
+
+	info := &PackageInfo{
+		Pkg:        types.NewPackage(old.Pkg.Path(), ""),
+		Importable: old.Importable,
+		Info: types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Scopes:     make(map[ast.Node]*types.Scope),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		},
+		Origin:       old.Origin,
+		dir:          old.dir,
+		errorFunc:    prog.typeChecker.Error,
+		byName:       make(map[string]*ast.File),
+		instrumented: old.instrumented,
+	}
+
+	src := newSrc
+	if prog.preprocess != nil {
+		out, lines, err := prog.preprocess(name, newSrc)
+		if err != nil {
+			return nil, fmt.Errorf("preprocessing %s: %v", name, err)
+		}
+		src = lineDirectives(name, out, lines)
+	}
+	f, err := parser.ParseFile(prog.Fset, name, src, prog.parserMode)
+	if f == nil {
+		return nil, err
+	}
+	if err != nil {
+		info.appendError(err)
+	}
+	parsed := f
+	if prog.mutateAST != nil {
+		if mutated, err := prog.mutateAST(old.Pkg.Path(), []*ast.File{f}); err != nil {
+			info.appendError(err)
+		} else if len(mutated) != 1 {
+			return nil, fmt.Errorf("MutateAST returned %d files for edited file %s", len(mutated), name)
+		} else {
+			f = mutated[0]
+		}
+	}
+	if old.instrumented {
+		if instrumented, _, err := instrumentFile(prog.Fset, prog.parserMode, prog.instrumentStmt, old.Pkg.Path(), f); err != nil {
+			info.appendError(err)
+		} else {
+			f = instrumented
+		}
+	}
+
+	// Check the new file with all the files checked by Load,
+	// including generated files excluded from Files.
+	checked := old.checked
+	if checked == nil {
+		checked = old.Files // a package restored by LoadSaved
+	}
+	for _, g := range checked {
+		if g == fi.file {
+			g = f
+		}
+		info.checked = append(info.checked, g)
+	}
+
+	// Derive the per-file facts of the new file; copy the others.
+	for _, g := range info.checked {
+		if g == f {
+			if constraints := buildConstraints(newSrc); constraints != nil {
+				if info.Constraints == nil {
+					info.Constraints = make(map[*ast.File][]string)
+				}
+				info.Constraints[f] = constraints
+			}
+			if isGeneratedSource(newSrc) || isGenerated(parsed) {
+				if info.Generated == nil {
+					info.Generated = make(map[*ast.File]bool)
+				}
+				info.Generated[f] = true
+			}
+			continue
+		}
+		if constraints, ok := old.Constraints[g]; ok {
+			if info.Constraints == nil {
+				info.Constraints = make(map[*ast.File][]string)
+			}
+			info.Constraints[g] = constraints
+		}
+		if old.Generated[g] {
+			if info.Generated == nil {
+				info.Generated = make(map[*ast.File]bool)
+			}
+			info.Generated[g] = true
+		}
+	}
+	for _, g := range info.checked {
+		if prog.excludeGenerated && info.Generated[g] {
+			continue
+		}
+		info.Files = append(info.Files, g)
+		info.byName[filepath.Clean(prog.Fset.File(g.Pos()).Name())] = g
+	}
+	if old.CommentMaps != nil {
+		info.CommentMaps = make(map[*ast.File]ast.CommentMap)
+		for _, g := range info.Files {
+			if cmap, ok := old.CommentMaps[g]; ok {
+				info.CommentMaps[g] = cmap
+			} else {
+				info.CommentMaps[g] = ast.NewCommentMap(prog.Fset, g, g.Comments)
+			}
+		}
+	}
+	if old.Directives != nil {
+		for _, g := range info.Files {
+			info.Directives = append(info.Directives, fileDirectives(g)...)
+		}
+	}
+
+	tc := prog.typeChecker
+	tc.IgnoreFuncBodies = false
+	tc.Importer = editImporter(prog, old)
+	tc.Error = info.appendError
+	types.NewChecker(&tc, prog.Fset, info.Pkg, &info.Info).Files(info.checked)
+
+	return info, nil
+}
+
+// editImporter returns an importer that resolves the imports of the
+// files of a new version of package old to the packages to which
+// those of old were resolved, or, for other imports, to the packages
+// of the program.
+func editImporter(prog *Program, old *PackageInfo) types.Importer {
+	files := old.checked
+	if files == nil {
+		files = old.Files
+	}
+	imports := make(map[string]*types.Package)
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil {
+				continue
+			}
+			if pkgname := importedPkgName(old, spec); pkgname != nil {
+				imports[path] = pkgname.Imported()
+			}
+		}
+	}
+	return importerFunc(func(path string) (*types.Package, error) {
+		if pkg, ok := imports[path]; ok {
+			return pkg, nil
+		}
+		return prog.Importer().Import(path)
+	})
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) { return f(path) }
@@ -0,0 +1,118 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/types"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestCheckFileEdit(t *testing.T) {
+	conf := loader.Config{
+		TypeChecker: types.Config{Error: func(error) {}},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {
+				"a.go": `package p; import "q"; var A q.T`,
+				"b.go": `package p; var B = A`,
+			},
+			"q": {"q.go": `package q; type T int`},
+		}),
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := prog.Package("p")
+
+	// A valid edit that imports q in another file.
+	info, err := prog.CheckFileEdit("/go/src/p/b.go", []byte(`package p; import "q"; var B q.T = A + 1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Errors != nil {
+		t.Errorf("unexpected errors: %v", info.Errors)
+	}
+	if info.Files[0] != old.Files[0] || info.Files[1] == old.Files[1] {
+		t.Errorf("the edited file was not replaced, or another was")
+	}
+	if obj := info.Pkg.Scope().Lookup("B"); obj == nil || obj.Type() != prog.Package("q").Pkg.Scope().Lookup("T").Type() {
+		t.Errorf("B has type %v, want q.T", obj)
+	}
+	if info.File("b.go") != info.Files[1] {
+		t.Errorf("File(b.go) is not the edited file")
+	}
+	if prog.Package("p") != old || old.Pkg.Scope().Lookup("B") == info.Pkg.Scope().Lookup("B") {
+		t.Errorf("the program was modified")
+	}
+
+	// An edit with a type error.
+	info, err = prog.CheckFileEdit("/go/src/p/b.go", []byte("package p\n\nvar B string = A"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Errors) != 1 {
+		t.Fatalf("got errors %v, want 1", info.Errors)
+	}
+	if posn := prog.Position(info.Errors[0].(types.Error).Pos); posn.Filename != "/go/src/p/b.go" || posn.Line != 3 {
+		t.Errorf("error %v at %s, want b.go:3", info.Errors[0], posn)
+	}
+
+	// A file not in the program.
+	if _, err := prog.CheckFileEdit("/go/src/p/c.go", nil); err == nil {
+		t.Errorf("CheckFileEdit of a file not in the program succeeded")
+	}
+}
+
+func TestCheckFileEditHooks(t *testing.T) {
+	var mutated []string
+	conf := loader.Config{
+		TypeChecker: types.Config{Error: func(error) {}},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {
+				"a.go": `package p; var A = G + Macro`,
+				"g.go": "// Code generated by hand. DO NOT EDIT.\n\npackage p; const G = 1",
+			},
+		}),
+		ExcludeGenerated: true,
+		Preprocess: func(filename string, src []byte) ([]byte, []int, error) {
+			return bytes.Replace(src, []byte("Macro"), []byte("2"), -1), nil, nil
+		},
+		MutateAST: func(path string, files []*ast.File) ([]*ast.File, error) {
+			for _, f := range files {
+				mutated = append(mutated, f.Name.Name)
+			}
+			return files, nil
+		},
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := prog.Package("p").Errors; errs != nil {
+		t.Fatalf("Load: unexpected errors: %v", errs)
+	}
+
+	mutated = nil
+	info, err := prog.CheckFileEdit("/go/src/p/a.go", []byte(`package p; var A = G * Macro`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Errors != nil {
+		t.Errorf("unexpected errors: %v", info.Errors)
+	}
+	if len(info.Files) != 1 || len(info.Generated) != 1 {
+		t.Errorf("got %d files and %d generated files, want 1 and 1", len(info.Files), len(info.Generated))
+	}
+	if len(mutated) != 1 {
+		t.Errorf("MutateAST was called with %d files, want 1", len(mutated))
+	}
+}
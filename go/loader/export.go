@@ -0,0 +1,34 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the writing of export data.
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/tools/go/gcexportdata"
+)
+
+// WriteExportData writes to w the type information of info, a package
+// of the Program type-checked from source, in the export data format
+// of the gc compiler, as by gcexportdata.Write.  The result may be
+// read by gcexportdata.Read, for example by a Config.FindPackage hook
+// or another tool, avoiding the cost of type-checking the package
+// again.
+//
+// WriteExportData fails if the package has no syntax or had errors,
+// since the export data of an erroneous package would be incomplete.
+//
+func (prog *Program) WriteExportData(w io.Writer, info *PackageInfo) error {
+	if info.Files == nil {
+		return fmt.Errorf("package %s was not loaded from source", info)
+	}
+	if len(info.Errors) > 0 {
+		return fmt.Errorf("package %s has errors", info)
+	}
+	return gcexportdata.Write(w, prog.Fset, info.Pkg)
+}
@@ -0,0 +1,55 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/tools/go/gcexportdata"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestWriteExportData(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import "b"; type T struct{ b.U }; func F() T { return T{} }`,
+		"b": `package b; type U int; func (U) M() {}`,
+		"c": `package c; var x int = ""`,
+	})
+	conf := loader.Config{Build: ctxt, AllowErrors: true}
+	conf.TypeChecker.Error = func(error) {}
+	conf.Import("a")
+	conf.Import("c")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := prog.WriteExportData(&buf, prog.Imported["a"]); err != nil {
+		t.Fatalf("WriteExportData(a): %v", err)
+	}
+	imports := make(map[string]*types.Package)
+	pkg, err := gcexportdata.Read(&buf, token.NewFileSet(), imports, "a")
+	if err != nil {
+		t.Fatalf("reading export data: %v", err)
+	}
+	F := pkg.Scope().Lookup("F")
+	if F == nil || F.Type().String() != "func() a.T" {
+		t.Errorf("imported a.F = %v", F)
+	}
+	if T := pkg.Scope().Lookup("T"); T == nil {
+		t.Errorf("imported package lacks a.T")
+	} else if obj, _, _ := types.LookupFieldOrMethod(T.Type(), false, pkg, "M"); obj == nil {
+		t.Errorf("imported a.T lacks promoted method M")
+	}
+
+	if err := prog.WriteExportData(ioutil.Discard, prog.Imported["c"]); err == nil {
+		t.Errorf("WriteExportData(c) succeeded despite errors")
+	}
+}
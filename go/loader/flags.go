@@ -0,0 +1,66 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the standard command-line flags of loader-based tools.
+
+import (
+	"flag"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+// Flags holds the values of the standard command-line flags of tools
+// built on the loader.  Use RegisterFlags to declare them and Apply
+// to update a Config after the flags have been parsed:
+//
+//      flags := loader.RegisterFlags(flag.CommandLine)
+//      flag.Parse()
+//
+//      var conf loader.Config
+//      flags.Apply(&conf)
+//      rest, err := conf.FromArgs(flag.Args(), flags.Tests)
+//
+type Flags struct {
+	Tags        []string // -tags: build tags to consider satisfied
+	Tests       bool     // -test: also load the tests of the initial packages
+	Binary      bool     // -binary: import dependencies from export data
+	AllowErrors bool     // -allowerrors: load packages despite errors
+	Parallelism int      // -parallelism: maximum number of packages type-checked at once
+}
+
+// RegisterFlags declares the standard loader flags in fs and returns
+// the Flags that will hold their values once fs is parsed.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := new(Flags)
+	fs.Var((*buildutil.TagsFlag)(&f.Tags), "tags", buildutil.TagsFlagDoc)
+	fs.BoolVar(&f.Tests, "test", false, "also load the tests of each package")
+	fs.BoolVar(&f.Binary, "binary", false, "import dependencies from compiler export data instead of source")
+	fs.BoolVar(&f.AllowErrors, "allowerrors", false, "load packages even if they contain errors")
+	fs.IntVar(&f.Parallelism, "parallelism", 0, "maximum `number` of packages type-checked in parallel (0 means no limit)")
+	return f
+}
+
+// Apply updates conf to reflect the flag values.
+//
+// The build context is copied before the build tags are set,
+// so that conf.Build, which may be shared, is not modified.
+// The Tests flag has no effect on conf; pass it to FromArgs.
+func (f *Flags) Apply(conf *Config) {
+	if f.Tags != nil {
+		ctxt := *conf.build() // copy
+		ctxt.BuildTags = f.Tags
+		conf.Build = &ctxt
+	}
+	if f.Binary {
+		conf.ImportFromBinary = func(string) bool { return true }
+	}
+	if f.AllowErrors {
+		conf.AllowErrors = true
+	}
+	if f.Parallelism > 0 {
+		conf.Parallelism = f.Parallelism
+	}
+}
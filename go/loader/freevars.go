@@ -0,0 +1,134 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the free-variable analysis of a range of source,
+// as needed by "extract function" refactorings.
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// A FreeVar is a local variable referenced but not declared within a
+// range of source.
+type FreeVar struct {
+	Var *types.Var
+
+	// Assigned reports whether the range may modify the variable:
+	// by assigning to it, or to one of its fields or array elements,
+	// by incrementing or decrementing it, or by taking its address,
+	// explicitly or to call a method with a pointer receiver.
+	Assigned bool
+}
+
+// FreeVars returns the free variables of the syntax within the source
+// interval [start, end) of a single file of the Program, for example a
+// selected block of statements: the local variables and parameters
+// referenced within the interval but declared outside it, in order of
+// first reference.  Package-level variables, which a function
+// extracted from the interval could refer to directly, are excluded.
+// FreeVars returns nil if no file contains the interval.
+//
+func (prog *Program) FreeVars(start, end token.Pos) []FreeVar {
+	fr := prog.fileRangeAt(start)
+	if fr == nil || end > fr.end {
+		return nil
+	}
+	info := fr.info
+	inRange := func(pos token.Pos) bool { return start <= pos && pos < end }
+
+	var vars []FreeVar
+	index := make(map[*types.Var]int) // index in vars
+	free := func(id *ast.Ident) int {
+		v, ok := info.Uses[id].(*types.Var)
+		if !ok || v.IsField() || inRange(v.Pos()) || v.Parent() == v.Pkg().Scope() {
+			return -1
+		}
+		i, ok := index[v]
+		if !ok {
+			i = len(vars)
+			index[v] = i
+			vars = append(vars, FreeVar{Var: v})
+		}
+		return i
+	}
+	// modify marks as Assigned the free variable, if any, that is
+	// modified when e is assigned to or its address taken.
+	modify := func(e ast.Expr) {
+		for {
+			switch x := e.(type) {
+			case *ast.ParenExpr:
+				e = x.X
+				continue
+			case *ast.SelectorExpr:
+				// Assigning to a field of a struct variable.
+				if sel := info.Selections[x]; sel != nil && sel.Kind() == types.FieldVal && !sel.Indirect() {
+					if _, ok := info.TypeOf(x.X).Underlying().(*types.Pointer); !ok {
+						e = x.X
+						continue
+					}
+				}
+			case *ast.IndexExpr:
+				// Assigning to an element of an array variable.
+				if _, ok := info.TypeOf(x.X).Underlying().(*types.Array); ok {
+					e = x.X
+					continue
+				}
+			case *ast.Ident:
+				if i := free(x); i >= 0 {
+					vars[i].Assigned = true
+				}
+			}
+			return
+		}
+	}
+
+	ast.Inspect(fr.file, func(n ast.Node) bool {
+		if n == nil || n.End() <= start || n.Pos() >= end {
+			return false // disjoint from the range
+		}
+		if !inRange(n.Pos()) || n.End() > end {
+			return true // partially overlaps the range
+		}
+		switch n := n.(type) {
+		case *ast.Ident:
+			free(n)
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				modify(lhs)
+			}
+		case *ast.IncDecStmt:
+			modify(n.X)
+		case *ast.RangeStmt:
+			if n.Tok == token.ASSIGN {
+				if n.Key != nil {
+					modify(n.Key)
+				}
+				if n.Value != nil {
+					modify(n.Value)
+				}
+			}
+		case *ast.UnaryExpr:
+			if n.Op == token.AND {
+				modify(n.X)
+			}
+		case *ast.SelectorExpr:
+			// A call x.M() of a method with a pointer receiver
+			// on an addressable x takes its address.
+			if sel := info.Selections[n]; sel != nil && sel.Kind() == types.MethodVal {
+				recv := sel.Obj().Type().(*types.Signature).Recv().Type()
+				if _, ok := recv.(*types.Pointer); ok {
+					if _, ok := info.TypeOf(n.X).Underlying().(*types.Pointer); !ok {
+						modify(n.X)
+					}
+				}
+			}
+		}
+		return true
+	})
+	return vars
+}
@@ -0,0 +1,79 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+const freeVarsSrc = `package a
+
+var global int
+
+type T struct{ f int }
+
+func (*T) M() {}
+
+func f(p int, q []int, r *T) {
+	var s T
+	var arr [2]int
+	var u, v, w int
+	// begin
+	x := p + global
+	q[0] = x
+	r.f = x
+	s.f = x
+	arr[1] = u
+	s.M()
+	v++
+	for w = range q {
+	}
+	fmt := &x
+	_ = fmt
+	// end
+	_, _, _ = s, v, w
+}
+`
+
+func TestFreeVars(t *testing.T) {
+	conf := loader.Config{Build: buildutil.FakeContext(map[string]map[string]string{
+		"a": {"a.go": freeVarsSrc},
+	})}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	tf := prog.Fset.File(prog.Imported["a"].Files[0].Pos())
+	start := tf.Pos(strings.Index(freeVarsSrc, "// begin"))
+	end := tf.Pos(strings.Index(freeVarsSrc, "// end"))
+
+	var got []string
+	for _, fv := range prog.FreeVars(start, end) {
+		got = append(got, fmt.Sprintf("%s %s %t", fv.Var.Name(), fv.Var.Type(), fv.Assigned))
+	}
+	want := []string{
+		"p int false",
+		"q []int false",
+		"r *a.T false",
+		"s a.T true",
+		"arr [2]int true",
+		"u int false",
+		"v int true",
+		"w int true",
+	}
+	if g, w := strings.Join(got, "\n"), strings.Join(want, "\n"); g != w {
+		t.Errorf("FreeVars =\n%s\nwant:\n%s", g, w)
+	}
+
+	if fvs := prog.FreeVars(start, tf.Pos(tf.Size())+1); fvs != nil {
+		t.Errorf("FreeVars of interval beyond file = %v, want nil", fvs)
+	}
+}
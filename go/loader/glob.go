@@ -0,0 +1,183 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the expansion of shell-style file name patterns
+// and directory names in the Filenames of a PkgSpec.
+
+import (
+	"fmt"
+	"go/build"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+// isGlob reports whether the file name contains any of the special
+// characters of a shell-style pattern.
+func isGlob(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// expandFilenames returns the list of file names denoted by
+// filenames, in which each pattern has been replaced by the sorted
+// list of files it matches, and each directory by its buildable
+// non-test Go files, as determined by ctxt.ImportDir.  Relative names
+// are interpreted relative to dir, and the file system is accessed
+// through ctxt.
+//
+// A pattern is a slash-separated list of elements, each matched as by
+// filepath.Match against a single file name, except that the element
+// "**" matches zero or more directories, not including those whose
+// names begin with ".".
+//
+// It is an error for a pattern to be malformed or to match no files,
+// or for a directory to contain no buildable Go files.
+func expandFilenames(ctxt *build.Context, dir string, filenames []string) ([]string, []error) {
+	var names []string
+	var errors []error
+	for _, name := range filenames {
+		if !isGlob(name) {
+			abs := name
+			if !buildutil.IsAbsPath(ctxt, abs) {
+				abs = buildutil.JoinPath(ctxt, dir, abs)
+			}
+			if !buildutil.IsDir(ctxt, abs) {
+				names = append(names, name)
+				continue
+			}
+			bp, err := ctxt.ImportDir(abs, 0)
+			if err == nil && len(bp.GoFiles) == 0 {
+				err = fmt.Errorf("no buildable Go source files in %s", abs)
+			}
+			if err != nil {
+				errors = append(errors, err)
+				continue
+			}
+			for _, file := range bp.GoFiles {
+				names = append(names, buildutil.JoinPath(ctxt, name, file))
+			}
+			continue
+		}
+		matches, err := glob(ctxt, dir, name)
+		if err == nil && matches == nil {
+			err = fmt.Errorf("no files match %q", name)
+		}
+		if err != nil {
+			errors = append(errors, err)
+			continue
+		}
+		names = append(names, matches...)
+	}
+	return names, errors
+}
+
+// dedupFilenames returns filenames without the names that denote,
+// after conversion to a clean absolute name relative to dir, the same
+// file as an earlier one, and the list of such duplicates.  A file
+// may be listed twice by mistake, or matched by overlapping patterns.
+func dedupFilenames(ctxt *build.Context, dir string, filenames []string) (uniq, dups []string) {
+	seen := make(map[string]bool)
+	for _, name := range filenames {
+		abs := name
+		if !buildutil.IsAbsPath(ctxt, abs) {
+			abs = buildutil.JoinPath(ctxt, dir, abs)
+		}
+		abs = filepath.Clean(abs)
+		if seen[abs] {
+			dups = append(dups, name)
+			continue
+		}
+		seen[abs] = true
+		uniq = append(uniq, name)
+	}
+	return uniq, dups
+}
+
+// glob returns the sorted list of files that match pattern.
+func glob(ctxt *build.Context, dir, pattern string) ([]string, error) {
+	elems := strings.Split(filepath.ToSlash(pattern), "/")
+	for _, elem := range elems {
+		if elem == "**" {
+			continue
+		}
+		if _, err := filepath.Match(elem, ""); err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %v", pattern, err)
+		}
+	}
+
+	// Start from the longest prefix of literal directory names.
+	i := 0
+	for i < len(elems)-1 && !isGlob(elems[i]) {
+		i++
+	}
+	prefix := strings.Join(elems[:i], "/")
+	if prefix == "" && i > 0 {
+		prefix = "/" // e.g. "/*.go"
+	}
+
+	var matches []string
+	globDir(ctxt, dir, filepath.FromSlash(prefix), elems[i:], &matches)
+
+	// "**" may match a file in several ways.
+	sort.Strings(matches)
+	uniq := matches[:0]
+	for j, name := range matches {
+		if j == 0 || name != matches[j-1] {
+			uniq = append(uniq, name)
+		}
+	}
+	if len(uniq) == 0 {
+		return nil, nil
+	}
+	return uniq, nil
+}
+
+// globDir appends to *matches the names of the files below the
+// directory prefix that match the pattern elements elems.
+// Unreadable directories match nothing.
+func globDir(ctxt *build.Context, dir, prefix string, elems []string, matches *[]string) {
+	elem, rest := elems[0], elems[1:]
+	if elem == "**" {
+		if len(rest) == 0 {
+			elem = "*" // a trailing "**" is treated as "*"
+		} else {
+			globDir(ctxt, dir, prefix, rest, matches) // zero directories
+		}
+	}
+
+	path := prefix
+	if !buildutil.IsAbsPath(ctxt, path) {
+		path = buildutil.JoinPath(ctxt, dir, prefix)
+	}
+	fis, err := buildutil.ReadDir(ctxt, path)
+	if err != nil {
+		return
+	}
+	for _, fi := range fis {
+		name := fi.Name()
+		if prefix != "" {
+			name = buildutil.JoinPath(ctxt, prefix, name)
+		}
+		if elem == "**" {
+			if fi.IsDir() && !strings.HasPrefix(fi.Name(), ".") {
+				globDir(ctxt, dir, name, elems, matches)
+			}
+			continue
+		}
+		if ok, _ := filepath.Match(elem, fi.Name()); !ok {
+			continue
+		}
+		if len(rest) == 0 {
+			if !fi.IsDir() {
+				*matches = append(*matches, name)
+			}
+		} else if fi.IsDir() {
+			globDir(ctxt, dir, name, rest, matches)
+		}
+	}
+}
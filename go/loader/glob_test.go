@@ -0,0 +1,80 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestCreateFromPatternsAndDirs(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"gen":       {"a.go": `package gen`, "b_gen.go": `package gen`, "c.txt": ``},
+		"gen/sub":   {"d_gen.go": `package gen`, "e_test.go": `package gen`, "f_windows.go": `package gen`},
+		"gen/tests": {"a_test.go": `package gen`},
+	})
+	for _, test := range []struct {
+		filenames []string
+		want      string // sorted file names, or error substring
+	}{
+		{[]string{"gen/*.go"}, "/go/src/gen/a.go /go/src/gen/b_gen.go"},
+		{[]string{"**/*_gen.go"}, "/go/src/gen/b_gen.go /go/src/gen/sub/d_gen.go"},
+		{[]string{"/go/src/gen/sub/?_gen.go", "gen/a.go"}, "/go/src/gen/a.go /go/src/gen/sub/d_gen.go"},
+		{[]string{"gen/*.c"}, `no files match "gen/*.c"`},
+		{[]string{"gen/[.go"}, `bad pattern "gen/[.go"`},
+		{[]string{"gen"}, "/go/src/gen/a.go /go/src/gen/b_gen.go"},
+		{[]string{"/go/src/gen/sub", "gen/a.go"}, "/go/src/gen/a.go /go/src/gen/sub/d_gen.go"},
+		{[]string{"gen/tests"}, "no buildable Go source files"},
+	} {
+		conf := loader.Config{Build: ctxt, Cwd: "/go/src", AllowErrors: true}
+		conf.TypeChecker.Error = func(error) {}
+		conf.CreateFromFilenames("gen", test.filenames...)
+		prog, err := conf.Load()
+		if err != nil {
+			t.Errorf("%s: Load failed: %v", test.filenames, err)
+			continue
+		}
+		info := prog.Created[0]
+		var got []string
+		for _, f := range info.Files {
+			got = append(got, prog.Fset.File(f.Pos()).Name())
+		}
+		for _, err := range info.Errors {
+			got = append(got, err.Error())
+		}
+		sort.Strings(got)
+		if s := strings.Join(got, " "); !strings.Contains(s, test.want) {
+			t.Errorf("%s: got %s, want %s", test.filenames, s, test.want)
+		}
+	}
+}
+
+func TestCreateDuplicateFiles(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"gen": {"a.go": `package gen; var A int`, "b.go": `package gen; var B int`},
+	})
+	var warnings []string
+	conf := loader.Config{Build: ctxt, Cwd: "/go/src"}
+	conf.TypeChecker.Error = func(err error) { warnings = append(warnings, err.Error()) }
+	conf.CreateFromFilenames("gen", "gen/*.go", "gen/a.go", "/go/src/gen/./b.go")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v (%s)", err, warnings)
+	}
+	if n := len(prog.Created[0].Files); n != 2 {
+		t.Errorf("got %d files, want 2", n)
+	}
+	want := []string{
+		"warning: CreatePkgs[0]: ignoring duplicate file gen/a.go",
+		"warning: CreatePkgs[0]: ignoring duplicate file /go/src/gen/./b.go",
+	}
+	if got := strings.Join(warnings, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("got warnings:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
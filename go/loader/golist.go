@@ -0,0 +1,314 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines a FindPackage hook based on 'go list', and the
+// converse, the output of 'go list' obtained from a Program.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// GoListFindPackage returns a Config.FindPackage hook that obtains
+// package metadata by running 'go list -e -json' instead of using
+// go/build, so that the loader's view of each package, its files, and
+// its imports matches that of the go tool exactly, including the
+// corner cases that go/build gets wrong.
+//
+// The command runs in fromDir, or in the current directory if fromDir
+// is empty, in GOPATH mode (GO111MODULE=off, with GOFLAGS cleared and
+// GOPROXY=off, so it never consults a module proxy), with the GOROOT,
+// GOPATH, GOOS, GOARCH, and CGO_ENABLED settings and build tags of
+// ctxt.  The go command must be found in $PATH.  Other fields of ctxt,
+// such as its file system hooks, are ignored, as is mode, since 'go
+// list' always reports all metadata.
+//
+// Queries are batched: each command lists a package together with all
+// its dependencies (-deps), and the hook retains the results, so that
+// a load typically starts one process for each initial package rather
+// than one for every package.  The hook assumes that ctxt is the same
+// in every call.
+//
+func GoListFindPackage() func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+	var (
+		mu    sync.Mutex
+		found = make(map[goListKey]goListResult)
+	)
+	return func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+		key := goListKey{importPath, fromDir}
+		mu.Lock()
+		r, ok := found[key]
+		mu.Unlock()
+		if ok {
+			return r.bp, r.err
+		}
+
+		pkgs, err := goList(ctxt, importPath, fromDir)
+		if err != nil {
+			return nil, err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, p := range pkgs {
+			r := p.result()
+			// Record p as the result of each import that denotes it.
+			for _, k := range p.importers {
+				found[k] = r
+			}
+			if !p.DepOnly {
+				found[key] = r // the package requested
+			}
+		}
+		r = found[key]
+		return r.bp, r.err
+	}
+}
+
+// A goListKey identifies a query of the hook returned by
+// GoListFindPackage.
+type goListKey struct {
+	importPath, fromDir string
+}
+
+// A goListResult is the result of a query of the hook returned by
+// GoListFindPackage.
+type goListResult struct {
+	bp  *build.Package
+	err error
+}
+
+// A goListOutput is a package in the output of 'go list -json'.  The
+// JSON fields of 'go list' are those of build.Package, plus a few
+// others.
+type goListOutput struct {
+	build.Package
+	Target    string
+	DepOnly   bool
+	ImportMap map[string]string
+	Error     *struct{ Err string }
+
+	// importers lists the imports, as written in the source of the
+	// other listed packages, that denote this package.
+	importers []goListKey
+}
+
+// result returns the build.Package described by p, and its error.
+func (p *goListOutput) result() goListResult {
+	bp := &p.Package
+	bp.PkgObj = p.Target
+	if p.Error != nil {
+		if bp.Dir != "" && len(bp.GoFiles)+len(bp.CgoFiles)+len(bp.TestGoFiles)+len(bp.XTestGoFiles) == 0 {
+			return goListResult{bp, &build.NoGoError{Dir: bp.Dir}}
+		}
+		return goListResult{bp, fmt.Errorf("go list %s: %s", p.ImportPath, p.Error.Err)}
+	}
+	return goListResult{bp, nil}
+}
+
+// goList runs 'go list -e -json -deps' for the package importPath,
+// imported from fromDir, and returns the listed packages.  Each
+// package records the import paths by which the other listed packages
+// import it.
+func goList(ctxt *build.Context, importPath, fromDir string) ([]*goListOutput, error) {
+	args := []string{"list", "-e", "-json", "-deps"}
+	if len(ctxt.BuildTags) > 0 {
+		args = append(args, "-tags", strings.Join(ctxt.BuildTags, " "))
+	}
+	if ctxt.InstallSuffix != "" {
+		args = append(args, "-installsuffix", ctxt.InstallSuffix)
+	}
+	args = append(args, "--", importPath)
+
+	cmd := exec.Command("go", args...)
+	cmd.Dir = fromDir
+	cgo := "0"
+	if ctxt.CgoEnabled {
+		cgo = "1"
+	}
+	cmd.Env = append(os.Environ(),
+		"GO111MODULE=off",
+		"GOFLAGS=",
+		"GOPROXY=off",
+		"GOROOT="+ctxt.GOROOT,
+		"GOPATH="+ctxt.GOPATH,
+		"GOOS="+ctxt.GOOS,
+		"GOARCH="+ctxt.GOARCH,
+		"CGO_ENABLED="+cgo,
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list %s: %v: %s", importPath, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var pkgs []*goListOutput
+	byPath := make(map[string]*goListOutput)
+	for dec := json.NewDecoder(&stdout); dec.More(); {
+		p := new(goListOutput)
+		if err := dec.Decode(p); err != nil {
+			return nil, fmt.Errorf("go list %s: %v", importPath, err)
+		}
+		pkgs = append(pkgs, p)
+		byPath[p.ImportPath] = p
+	}
+
+	// Invert the imports of each package, as written in its
+	// source (the keys of ImportMap, or else Imports), so that
+	// each dependency is found for the importer's directory.
+	for _, p := range pkgs {
+		canon := make(map[string]string)
+		for _, path := range p.Imports {
+			canon[path] = path
+		}
+		for src, path := range p.ImportMap {
+			delete(canon, path)
+			canon[src] = path
+		}
+		for src, path := range canon {
+			if q := byPath[path]; q != nil && p.Dir != "" {
+				q.importers = append(q.importers, goListKey{src, p.Dir})
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// A GoListPackage is the metadata of a package in the form of the
+// output of 'go list -json', as written by WriteGoList.  Only the
+// fields that a Program can supply are present.
+type GoListPackage struct {
+	Dir        string `json:",omitempty"` // directory containing package sources
+	ImportPath string `json:",omitempty"` // import path of package in dir
+	Name       string `json:",omitempty"` // package name
+	Incomplete bool   `json:",omitempty"` // this package or a dependency has an error
+
+	GoFiles      []string `json:",omitempty"` // .go source files, excluding tests
+	TestGoFiles  []string `json:",omitempty"` // _test.go files in package
+	XTestGoFiles []string `json:",omitempty"` // _test.go files outside package
+
+	Imports      []string `json:",omitempty"` // import paths used by this package
+	TestImports  []string `json:",omitempty"` // imports from TestGoFiles
+	XTestImports []string `json:",omitempty"` // imports from XTestGoFiles
+
+	Error *GoListError `json:",omitempty"` // error loading package
+}
+
+// A GoListError is an error loading a package, as reported by 'go list'.
+type GoListError struct {
+	Pos string // position of error, if present
+	Err string // the error itself
+}
+
+// WriteGoList writes to w the metadata of each package of the program,
+// in the order of SortedPackages, as a sequence of JSON objects of the
+// form written by 'go list -json', so that consumers of that output
+// can be fed from the Program instead.
+//
+// As in the output of 'go list', the files and imports of an external
+// test package are those of the package it tests, and file names are
+// relative to Dir.  Packages loaded from export data have no files.
+// Imports are listed by canonical path, after vendoring.
+//
+func (prog *Program) WriteGoList(w io.Writer) error {
+	xtests := make(map[string]*PackageInfo)
+	for _, info := range prog.Created {
+		if info.Origin != nil && info.Origin.XTestOf != "" {
+			xtests[info.Origin.XTestOf] = info
+		}
+	}
+	for _, info := range prog.SortedPackages() {
+		if info.Origin != nil && info.Origin.XTestOf != "" {
+			continue // reported with the package under test
+		}
+		p := GoListPackage{
+			Dir:        info.dir,
+			ImportPath: info.Pkg.Path(),
+			Name:       info.Pkg.Name(),
+			Incomplete: !info.TransitivelyErrorFree,
+		}
+		var imports, testImports, xtestImports []*ast.File
+		for _, f := range info.Files {
+			if isTestFile(prog.Fset, f) {
+				p.TestGoFiles = append(p.TestGoFiles, prog.goListFile(info, f))
+				testImports = append(testImports, f)
+			} else {
+				p.GoFiles = append(p.GoFiles, prog.goListFile(info, f))
+				imports = append(imports, f)
+			}
+		}
+		p.Imports = goListImports(info, imports)
+		p.TestImports = goListImports(info, testImports)
+		if xtest := xtests[info.Pkg.Path()]; xtest != nil {
+			for _, f := range xtest.Files {
+				p.XTestGoFiles = append(p.XTestGoFiles, prog.goListFile(info, f))
+				xtestImports = append(xtestImports, f)
+			}
+			p.XTestImports = goListImports(xtest, xtestImports)
+		}
+		if len(info.Errors) > 0 {
+			p.Error = &GoListError{Err: info.Errors[0].Error()}
+			if err, ok := info.Errors[0].(types.Error); ok {
+				p.Error.Pos = prog.Position(err.Pos).String()
+				p.Error.Err = err.Msg
+			}
+		}
+
+		data, err := json.MarshalIndent(&p, "", "\t")
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// goListFile returns the name of file f relative to the directory of
+// package info, if possible.
+func (prog *Program) goListFile(info *PackageInfo, f *ast.File) string {
+	name := prog.Fset.File(f.Pos()).Name()
+	if rel, err := filepath.Rel(info.dir, name); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return name
+}
+
+// goListImports returns the sorted, canonical paths of the packages
+// imported by files, which belong to package info.
+func goListImports(info *PackageInfo, files []*ast.File) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			var path string
+			if pkgname := importedPkgName(info, spec); pkgname != nil {
+				path = pkgname.Imported().Path()
+			} else if p, err := strconv.Unquote(spec.Path.Value); err == nil {
+				path = p
+			}
+			if path != "" && !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
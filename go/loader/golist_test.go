@@ -0,0 +1,143 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/build"
+	"go/types"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestGoListFindPackage(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skipf("go command not found: %v", err)
+	}
+	ctxt := build.Default
+	find := loader.GoListFindPackage()
+	got, err := find(&ctxt, "errors", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ctxt.Import("errors", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ImportPath != want.ImportPath || got.Name != want.Name || got.Dir != want.Dir || !got.Goroot ||
+		!reflect.DeepEqual(got.GoFiles, want.GoFiles) || !reflect.DeepEqual(got.XTestGoFiles, want.XTestGoFiles) {
+		t.Errorf("GoListFindPackage(errors) = %+v, want %+v", got, want)
+	}
+
+	// The dependencies of errors were listed with it,
+	// so finding them does not run the go command again.
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	for _, dep := range want.Imports {
+		if bp, err := find(&ctxt, dep, want.Dir, 0); err != nil || bp.ImportPath != dep {
+			t.Errorf("GoListFindPackage(%s) = %v, %v", dep, bp, err)
+		}
+	}
+	os.Setenv("PATH", path)
+
+	if _, err := find(&ctxt, "nonesuch.example/x", "", 0); err == nil {
+		t.Errorf("GoListFindPackage(nonesuch) succeeded")
+	}
+
+	if testing.Short() {
+		return
+	}
+	conf := loader.Config{FindPackage: loader.GoListFindPackage()}
+	conf.Import("errors")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load with GoListFindPackage failed: %v", err)
+	}
+	if info := prog.Imported["errors"]; info == nil || len(info.Files) != len(want.GoFiles) {
+		t.Errorf("Load with GoListFindPackage: errors package = %v", info)
+	}
+}
+
+func TestWriteGoList(t *testing.T) {
+	conf := loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"a": {
+				"a.go":      `package a; import "b"; var A = b.B`,
+				"a_test.go": `package a; import "testing"; func TestA(*testing.T) {}`,
+				"x_test.go": `package a_test; import ("a"; "b"); var _, _ = a.A, b.B`,
+			},
+			"b":       {"b.go": `package b; var B int = "b"`},
+			"testing": {"testing.go": `package testing; type T int`},
+		}),
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+	}
+	conf.ImportWithTests("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := prog.WriteGoList(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]loader.GoListPackage)
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var p loader.GoListPackage
+		if err := dec.Decode(&p); err != nil {
+			t.Fatal(err)
+		}
+		got[p.ImportPath] = p
+	}
+	want := map[string]loader.GoListPackage{
+		"a": {
+			Dir:          "/go/src/a",
+			ImportPath:   "a",
+			Name:         "a",
+			Incomplete:   true,
+			GoFiles:      []string{"a.go"},
+			TestGoFiles:  []string{"a_test.go"},
+			XTestGoFiles: []string{"x_test.go"},
+			Imports:      []string{"b"},
+			TestImports:  []string{"testing"},
+			XTestImports: []string{"a", "b"},
+		},
+		"b": {
+			Dir:        "/go/src/b",
+			ImportPath: "b",
+			Name:       "b",
+			Incomplete: true,
+			GoFiles:    []string{"b.go"},
+			Error: &loader.GoListError{
+				Pos: "/go/src/b/b.go:1:24",
+				Err: `cannot use "b"`,
+			},
+		},
+		"testing": {
+			Dir:        "/go/src/testing",
+			ImportPath: "testing",
+			Name:       "testing",
+			GoFiles:    []string{"testing.go"},
+		},
+	}
+	// The rest of the message varies across Go releases.
+	if e := got["b"].Error; e != nil && strings.HasPrefix(e.Err, `cannot use "b"`) {
+		e.Err = `cannot use "b"`
+	}
+	if !reflect.DeepEqual(got, want) {
+		for path, p := range got {
+			t.Errorf("got %s: %+v (error %+v)", path, p, p.Error)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the import graph of a Program.
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// An ImportGraph is the graph of import dependencies among the
+// packages of a Program.  Each edge list is ordered as by
+// Program.SortedPackages.
+type ImportGraph struct {
+	Imports    map[*PackageInfo][]*PackageInfo // forward edges: imported packages
+	ImportedBy map[*PackageInfo][]*PackageInfo // reverse edges: importing packages
+}
+
+// ImportGraph returns the import graph of all the packages in
+// AllPackages, including Created packages.
+//
+// The edges of a package loaded from source are derived from the
+// import declarations of its files, and thus include those of the
+// in-package test files of an augmented package, even though they
+// are not visible through types.Package.Imports of a package
+// augmented by its tests.  The edges of a package without syntax,
+// such as one imported from export data, are derived from
+// types.Package.Imports.  The edges of a Program restored by
+// LoadSaved are those of the saved Program.
+//
+// Each call returns a new graph, which the caller may modify.
+//
+func (prog *Program) ImportGraph() *ImportGraph {
+	g := &ImportGraph{
+		Imports:    make(map[*PackageInfo][]*PackageInfo),
+		ImportedBy: make(map[*PackageInfo][]*PackageInfo),
+	}
+	sorted := prog.SortedPackages()
+	index := sortedIndex(sorted)
+	for _, info := range sorted {
+		g.Imports[info] = prog.imports(info, index, true)
+		for _, to := range g.Imports[info] {
+			g.ImportedBy[to] = append(g.ImportedBy[to], info)
+		}
+	}
+	return g
+}
+
+// Deps returns the packages on which info transitively depends,
+// not including info itself, in the order of SortedPackages.
+// Dependencies due to test files are included.
+func (prog *Program) Deps(info *PackageInfo) []*PackageInfo {
+	return prog.closure(info, prog.sharedImportGraph().Imports)
+}
+
+// Dependents returns the packages that transitively depend on info,
+// not including info itself, in the order of SortedPackages.  These
+// are the packages that may be affected by a change to info, and
+// include the test packages that depend on it.
+func (prog *Program) Dependents(info *PackageInfo) []*PackageInfo {
+	return prog.closure(info, prog.sharedImportGraph().ImportedBy)
+}
+
+// sharedImportGraph returns the import graph of the program, building
+// it if necessary.  The caller must not modify it.
+func (prog *Program) sharedImportGraph() *ImportGraph {
+	prog.importGraphOnce.Do(func() {
+		prog.importGraph = prog.ImportGraph()
+	})
+	return prog.importGraph
+}
+
+// closure returns the packages reachable from info by edges,
+// excluding info, in the order of SortedPackages.
+func (prog *Program) closure(info *PackageInfo, edges map[*PackageInfo][]*PackageInfo) []*PackageInfo {
+	seen := map[*PackageInfo]bool{info: true}
+	var visit func(info *PackageInfo)
+	visit = func(info *PackageInfo) {
+		for _, to := range edges[info] {
+			if !seen[to] {
+				seen[to] = true
+				visit(to)
+			}
+		}
+	}
+	visit(info)
+
+	var res []*PackageInfo
+	for _, p := range prog.SortedPackages() {
+		if seen[p] && p != info {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// TopoSort returns the packages of AllPackages in topological order:
+// each package follows the packages it imports.  Packages unordered
+// by the import graph appear in the order of SortedPackages.
+//
+// The in-package test files (*_test.go) of a package augmented by its
+// tests may import packages that import the package itself, forming
+// a cycle.  TopoSort ignores the edges due to such files, so an
+// augmented package precedes the packages that only its tests import.
+// TopoSort returns an error if any other cycle remains, which is
+// possible only in an erroneous program.
+//
+func (prog *Program) TopoSort() ([]*PackageInfo, error) {
+	sorted := prog.SortedPackages()
+	index := sortedIndex(sorted)
+	order := make([]*PackageInfo, 0, len(sorted))
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[*PackageInfo]int)
+	var stack []*PackageInfo
+	var visit func(info *PackageInfo) error
+	visit = func(info *PackageInfo) error {
+		switch state[info] {
+		case visited:
+			return nil
+		case visiting:
+			var cycle []string
+			for i := len(stack) - 1; i >= 0; i-- {
+				cycle = append(cycle, stack[i].Pkg.Path())
+				if stack[i] == info {
+					break
+				}
+			}
+			return fmt.Errorf("import cycle: %s", strings.Join(cycle, " <- "))
+		}
+		state[info] = visiting
+		stack = append(stack, info)
+		for _, to := range prog.imports(info, index, false) {
+			if err := visit(to); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[info] = visited
+		order = append(order, info)
+		return nil
+	}
+	for _, info := range sorted {
+		if err := visit(info); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// SCCs returns the strongly connected components of the import graph
+// of the Program, including the edges due to the in-package test files
+// of augmented packages, as reported by ImportGraph.  Each component is
+// a set of packages that must be processed together, such as a package
+// augmented by its tests and the packages that both import it and are
+// imported by its tests.
+//
+// Each component follows the components it imports, and its packages
+// are ordered as by SortedPackages.  In a program without errors, a
+// component has more than one member only because of test files.
+//
+func (prog *Program) SCCs() [][]*PackageInfo {
+	sorted := prog.SortedPackages()
+	index := sortedIndex(sorted)
+
+	// Tarjan's algorithm.
+	var (
+		sccs    [][]*PackageInfo
+		stack   []*PackageInfo
+		onStack = make(map[*PackageInfo]bool)
+		num     = make(map[*PackageInfo]int) // visitation number, from 1
+		low     = make(map[*PackageInfo]int)
+	)
+	var visit func(info *PackageInfo)
+	visit = func(info *PackageInfo) {
+		num[info] = len(num) + 1
+		low[info] = num[info]
+		stack = append(stack, info)
+		onStack[info] = true
+		for _, to := range prog.imports(info, index, true) {
+			if num[to] == 0 {
+				visit(to)
+				if low[to] < low[info] {
+					low[info] = low[to]
+				}
+			} else if onStack[to] && num[to] < low[info] {
+				low[info] = num[to]
+			}
+		}
+		if low[info] == num[info] {
+			var scc []*PackageInfo
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				scc = append(scc, top)
+				if top == info {
+					break
+				}
+			}
+			sort.Slice(scc, func(i, j int) bool { return index[scc[i]] < index[scc[j]] })
+			sccs = append(sccs, scc)
+		}
+	}
+	for _, info := range sorted {
+		if num[info] == 0 {
+			visit(info)
+		}
+	}
+	return sccs
+}
+
+// sortedIndex returns the inverse of the permutation sorted.
+func sortedIndex(sorted []*PackageInfo) map[*PackageInfo]int {
+	index := make(map[*PackageInfo]int, len(sorted))
+	for i, info := range sorted {
+		index[info] = i
+	}
+	return index
+}
+
+// imports returns the packages directly imported by info, ordered by
+// index, as described at ImportGraph.  Unless tests is set, imports
+// from the *_test.go files of importable packages are ignored.
+func (prog *Program) imports(info *PackageInfo, index map[*PackageInfo]int, tests bool) []*PackageInfo {
+	if edges, ok := prog.savedImports[info]; ok {
+		if tests {
+			return append([]*PackageInfo(nil), edges.all...)
+		}
+		return append([]*PackageInfo(nil), edges.nonTest...)
+	}
+	seen := make(map[*PackageInfo]bool)
+	var imports []*PackageInfo
+	add := func(pkg *types.Package) {
+		if to := prog.AllPackages[pkg]; to != nil && to != info && !seen[to] {
+			seen[to] = true
+			imports = append(imports, to)
+		}
+	}
+	if info.Files != nil {
+		for _, f := range info.Files {
+			if !tests && info.Importable && isTestFile(prog.Fset, f) {
+				continue
+			}
+			for _, spec := range f.Imports {
+				if pkgname := importedPkgName(info, spec); pkgname != nil {
+					add(pkgname.Imported())
+				}
+			}
+		}
+	} else {
+		for _, pkg := range info.Pkg.Imports() {
+			add(pkg)
+		}
+	}
+	sort.Slice(imports, func(i, j int) bool { return index[imports[i]] < index[imports[j]] })
+	return imports
+}
+
+// isTestFile reports whether f is a *_test.go file.
+func isTestFile(fset *token.FileSet, f *ast.File) bool {
+	tf := fset.File(f.Pos())
+	return tf != nil && strings.HasSuffix(tf.Name(), "_test.go")
+}
+
+// importedPkgName returns the PkgName object declared by an import
+// spec, or nil if there is none (for example, in the presence of
+// errors).
+func importedPkgName(info *PackageInfo, spec *ast.ImportSpec) *types.PkgName {
+	var obj types.Object
+	if spec.Name != nil {
+		obj = info.Defs[spec.Name]
+	} else {
+		obj = info.Implicits[spec]
+	}
+	pkgname, _ := obj.(*types.PkgName)
+	return pkgname
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+// graphProgram loads a program with an in-package test that
+// imports a package that imports the package under test, and an
+// external test package.
+func graphProgram(t *testing.T) *loader.Program {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {
+			"a.go":      `package a; import _ "c"`,
+			"a_test.go": `package a; import _ "b"`,
+			"x_test.go": `package a_test; import (_ "a"; . "d"); const _ = D`,
+		},
+		"b": {"b.go": `package b; import _ "a"`},
+		"c": {"c.go": `package c; import _ "d"`},
+		"d": {"d.go": `package d; const D = 0`},
+	})
+	conf := loader.Config{Build: ctxt, KeepSource: true}
+	conf.ImportWithTests("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return prog
+}
+
+func TestImportGraph(t *testing.T) {
+	prog := graphProgram(t)
+	g := prog.ImportGraph()
+	var buf bytes.Buffer
+	for _, info := range prog.SortedPackages() {
+		fmt.Fprintf(&buf, "%s: imports %s, imported by %s\n", info, g.Imports[info], g.ImportedBy[info])
+	}
+	want := `a: imports [b c], imported by [a_test b]
+a_test: imports [a d], imported by []
+b: imports [a], imported by [a]
+c: imports [d], imported by [a]
+d: imports [], imported by [a_test c]
+`
+	if got := buf.String(); got != want {
+		t.Errorf("ImportGraph:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTopoSort(t *testing.T) {
+	prog := graphProgram(t)
+	order, err := prog.TopoSort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(order), "[d c a a_test b]"; got != want {
+		t.Errorf("TopoSort = %s, want %s", got, want)
+	}
+}
+
+func TestSCCs(t *testing.T) {
+	prog := graphProgram(t)
+	if got, want := fmt.Sprint(prog.SCCs()), "[[d] [c] [a b] [a_test]]"; got != want {
+		t.Errorf("SCCs = %s, want %s", got, want)
+	}
+}
+
+func TestDepsAndDependents(t *testing.T) {
+	prog := graphProgram(t)
+	for i := 0; i < 2; i++ {
+		testDepsAndDependents(t, prog)
+
+		// A graph returned by ImportGraph is the caller's to modify.
+		g := prog.ImportGraph()
+		for info := range g.Imports {
+			g.Imports[info] = nil
+			g.ImportedBy[info] = nil
+		}
+	}
+}
+
+func testDepsAndDependents(t *testing.T, prog *loader.Program) {
+	for _, test := range []struct {
+		path             string
+		deps, dependents string
+	}{
+		{"a", "[b c d]", "[a_test b]"},
+		{"b", "[a c d]", "[a a_test]"},
+		{"c", "[d]", "[a a_test b]"},
+		{"d", "[]", "[a a_test b c]"},
+		{"a_test", "[a b c d]", "[]"},
+	} {
+		info := prog.Package(test.path)
+		if got := fmt.Sprint(prog.Deps(info)); got != test.deps {
+			t.Errorf("Deps(%s) = %s, want %s", test.path, got, test.deps)
+		}
+		if got := fmt.Sprint(prog.Dependents(info)); got != test.dependents {
+			t.Errorf("Dependents(%s) = %s, want %s", test.path, got, test.dependents)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the interface-implementation relation over the
+// named types of a Program.
+
+import (
+	"go/types"
+	"sort"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// ImplementsOptions controls the computation of Program.Implements.
+type ImplementsOptions struct {
+	ExportedOnly bool // consider only exported named types
+}
+
+// Implementations holds the interface-implementation relation among
+// the package-level named types of a Program.
+type Implementations struct {
+	// Implementors maps each non-empty named interface type to the
+	// concrete types that satisfy it.  A concrete type is a named
+	// type T, or a pointer *T if only *T satisfies the interface.
+	Implementors map[*types.Named][]types.Type
+
+	// Interfaces maps each named concrete type T to the named
+	// interfaces satisfied by T or *T.
+	Interfaces map[*types.Named][]*types.Named
+}
+
+// Implements computes, for each package-level named interface type
+// of the program (other than empty ones, which every type satisfies),
+// the package-level named concrete types that satisfy it, and vice
+// versa.  The lists are ordered by package path and type name.  A nil
+// opts is equivalent to a pointer to the zero ImplementsOptions.
+//
+// The computation takes time proportional to the product of the
+// numbers of interface and concrete types.  It uses prog.MethodSets
+// to discard quickly the types with too few methods.
+//
+func (prog *Program) Implements(opts *ImplementsOptions) *Implementations {
+	if opts == nil {
+		opts = new(ImplementsOptions)
+	}
+
+	// Gather the named types of all packages.
+	var ifaces, concretes []*types.Named
+	seen := make(map[*types.Package]bool)
+	for _, info := range prog.SortedPackages() {
+		if seen[info.Pkg] {
+			continue
+		}
+		seen[info.Pkg] = true
+		scope := info.Pkg.Scope()
+		for _, name := range scope.Names() {
+			tname, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || opts.ExportedOnly && !tname.Exported() {
+				continue
+			}
+			named, ok := tname.Type().(*types.Named)
+			if !ok || named.Obj() != tname {
+				continue // alias
+			}
+			if iface, ok := named.Underlying().(*types.Interface); ok {
+				if iface.NumMethods() > 0 {
+					ifaces = append(ifaces, named)
+				}
+			} else {
+				concretes = append(concretes, named)
+			}
+		}
+	}
+	less := func(x, y *types.Named) bool {
+		if x.Obj().Pkg().Path() != y.Obj().Pkg().Path() {
+			return x.Obj().Pkg().Path() < y.Obj().Pkg().Path()
+		}
+		return x.Obj().Name() < y.Obj().Name()
+	}
+	sort.SliceStable(ifaces, func(i, j int) bool { return less(ifaces[i], ifaces[j]) })
+	sort.SliceStable(concretes, func(i, j int) bool { return less(concretes[i], concretes[j]) })
+
+	impls := &Implementations{
+		Implementors: make(map[*types.Named][]types.Type),
+		Interfaces:   make(map[*types.Named][]*types.Named),
+	}
+	msets := prog.MethodSets
+	if msets == nil {
+		msets = new(typeutil.MethodSetCache)
+	}
+	for _, I := range ifaces {
+		iface := I.Underlying().(*types.Interface)
+		for _, T := range concretes {
+			ptr := types.NewPointer(T)
+			if msets.MethodSet(ptr).Len() < iface.NumMethods() {
+				continue // too few methods
+			}
+			var impl types.Type
+			if types.Implements(T, iface) {
+				impl = T
+			} else if types.Implements(ptr, iface) {
+				impl = ptr
+			} else {
+				continue
+			}
+			impls.Implementors[I] = append(impls.Implementors[I], impl)
+			impls.Interfaces[T] = append(impls.Interfaces[T], I)
+		}
+	}
+	return impls
+}
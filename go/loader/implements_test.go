@@ -0,0 +1,77 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestImplements(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import "b"
+type Reader interface { Read() }
+type file struct{}
+func (*file) Read() {}
+type Buffer struct{}
+func (Buffer) Read() {}
+func (Buffer) Write() {}
+type Empty interface{}
+type Alias = Buffer
+var _ b.Writer = Buffer{}`,
+		"b": `package b
+type Writer interface { Write() }
+type ReadWriter interface { Read(); Write() }`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if prog.MethodSets == nil {
+		t.Fatal("Program.MethodSets is nil")
+	}
+
+	describe := func(impls *loader.Implementations) string {
+		var buf bytes.Buffer
+		var lines []string
+		for I, Ts := range impls.Implementors {
+			lines = append(lines, fmt.Sprintf("%s <- %s", I, Ts))
+		}
+		for T, Is := range impls.Interfaces {
+			lines = append(lines, fmt.Sprintf("%s -> %s", T, Is))
+		}
+		sort.Strings(lines)
+		for _, line := range lines {
+			fmt.Fprintln(&buf, line)
+		}
+		return buf.String()
+	}
+	for _, test := range []struct {
+		opts *loader.ImplementsOptions
+		want string
+	}{
+		{nil, `a.Buffer -> [a.Reader b.ReadWriter b.Writer]
+a.Reader <- [a.Buffer *a.file]
+a.file -> [a.Reader]
+b.ReadWriter <- [a.Buffer]
+b.Writer <- [a.Buffer]
+`},
+		{&loader.ImplementsOptions{ExportedOnly: true}, `a.Buffer -> [a.Reader b.ReadWriter b.Writer]
+a.Reader <- [a.Buffer]
+b.ReadWriter <- [a.Buffer]
+b.Writer <- [a.Buffer]
+`},
+	} {
+		if got := describe(prog.Implements(test.opts)); got != test.want {
+			t.Errorf("Implements(%+v) =\n%s\nwant:\n%s", test.opts, got, test.want)
+		}
+	}
+}
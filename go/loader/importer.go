@@ -0,0 +1,117 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines importers backed by the loader.
+
+import (
+	"fmt"
+	"go/types"
+	"sync"
+)
+
+// Importer returns a types.Importer that serves the packages of the
+// program, so that additional code, such as generated snippets, may
+// be type-checked against it by types.Config.Check without loading
+// anything again.  Only importable packages are served, by import
+// path; other paths cause an error.  The "unsafe" package is always
+// available.
+//
+// The packages are shared with the program, not copied, so the
+// objects of the newly checked code refer to those of the program.
+//
+func (prog *Program) Importer() types.Importer {
+	return programImporter{prog}
+}
+
+type programImporter struct{ prog *Program }
+
+func (imp programImporter) Import(path string) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	if pkg, ok := imp.prog.importMap[path]; ok {
+		return pkg, nil
+	}
+	return nil, fmt.Errorf("package %q is not in the program", path)
+}
+
+// An Importer is a types.ImporterFrom that loads each imported package,
+// and its dependencies, as Config.Load does: from source or export
+// data, according to the Config, using its build context, FindPackage
+// hook, and other options, and caching each package so that it is
+// loaded at most once.  It lets tools such as gotype type-check code
+// of their own against packages found by the loader.
+//
+// An Importer reports the errors of the packages it loads as Load does,
+// through Config.TypeChecker.Error, and the import of a package that
+// has errors fails, with the first of them.
+//
+// An Importer is safe for concurrent use.
+//
+type Importer struct {
+	imp *importer
+
+	mu     sync.Mutex              // guards direct
+	direct map[string]*PackageInfo // packages imported by ImportFrom
+}
+
+// NewImporter returns a new Importer for the specified configuration,
+// or an error if the configuration is invalid.  Config fields
+// describing the initial packages, such as ImportPkgs, are ignored.
+// The Config must not be modified while the Importer is in use.
+func NewImporter(conf *Config) (*Importer, error) {
+	imp, err := conf.newImporter()
+	if err != nil {
+		return nil, err
+	}
+	return &Importer{imp: imp, direct: make(map[string]*PackageInfo)}, nil
+}
+
+// Import is equivalent to ImportFrom(path, conf.Cwd, 0).
+func (i *Importer) Import(path string) (*types.Package, error) {
+	return i.ImportFrom(path, i.imp.conf.Cwd, 0)
+}
+
+// ImportFrom returns the package for the specified import path, as
+// imported from a file in directory dir, so that vendored and local
+// imports are resolved as by the go tool.  The mode must be zero.
+func (i *Importer) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	if mode != 0 {
+		panic(fmt.Sprintf("invalid ImportMode %d", mode))
+	}
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	infos, errs := i.imp.importAll("", dir, map[string]bool{path: false}, 0)
+	if len(errs) > 0 {
+		return nil, errs[0].err
+	}
+	info := infos[0]
+	i.mu.Lock()
+	i.direct[info.Pkg.Path()] = info
+	i.mu.Unlock()
+	if len(info.Errors) > 0 {
+		return nil, fmt.Errorf("could not import %s: %v", path, info.Errors[0])
+	}
+	return info.Pkg, nil
+}
+
+// Program returns the Program of all the packages loaded so far.  Its
+// Imported packages are those imported directly by Import or
+// ImportFrom, and it has no Created packages.  Each call returns the
+// same Program, updated, so the caller must not use it concurrently
+// with calls to Import.
+func (i *Importer) Program() *Program {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for path, info := range i.direct {
+		i.imp.prog.Imported[path] = info
+	}
+	i.imp.addIndirect()
+	i.imp.finish()
+	return i.imp.prog
+}
@@ -0,0 +1,125 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestProgramImporter(t *testing.T) {
+	conf := loader.Config{Build: fakeContext(map[string]string{
+		"a": `package a; type T struct{ X int }`,
+		"b": `package b; import "a"; func F() a.T { return a.T{} }`,
+	})}
+	conf.Import("b")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := parser.ParseFile(prog.Fset, "snippet.go", `package snippet
+
+import (
+	"a"
+	"b"
+	"unsafe"
+)
+
+var x a.T = b.F()
+var _ = unsafe.Sizeof(x)
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := types.Config{Importer: prog.Importer()}
+	pkg, err := tc.Check("snippet", prog.Fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The type of x is the very type of the program.
+	if got, want := pkg.Scope().Lookup("x").Type(), prog.Package("a").Pkg.Scope().Lookup("T").Type(); got != want {
+		t.Errorf("type of x is %v (%p), want the program's a.T (%p)", got, got, want)
+	}
+
+	if _, err := prog.Importer().Import("c"); err == nil || !strings.Contains(err.Error(), "not in the program") {
+		t.Errorf("Import(c) returned error %v, want 'not in the program'", err)
+	}
+}
+
+func TestImporter(t *testing.T) {
+	var errs []error
+	conf := loader.Config{
+		Build: fakeContext(map[string]string{
+			"a":   `package a; type T int`,
+			"b":   `package b; import "a"; var X a.T`,
+			"bad": `package bad; var Y int = "y"`,
+			"c":   `package c; var Z int`,
+		}),
+		TypeChecker: types.Config{Error: func(err error) { errs = append(errs, err) }},
+	}
+	imp, err := loader.NewImporter(&conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ types.ImporterFrom = imp
+
+	b, err := imp.Import("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := imp.Import("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Packages are loaded once.
+	if got := b.Imports(); len(got) != 1 || got[0] != a {
+		t.Errorf("b.Imports() = %v, want [a] (%p)", got, a)
+	}
+
+	if _, err := imp.Import("bad"); err == nil || !strings.Contains(err.Error(), "could not import bad") {
+		t.Errorf("Import(bad) returned error %v, want 'could not import bad'", err)
+	}
+	if len(errs) != 1 {
+		t.Errorf("got errors %v, want one", errs)
+	}
+	if _, err := imp.Import("missing"); err == nil {
+		t.Errorf("Import(missing) succeeded")
+	}
+
+	prog := imp.Program()
+	var imported []string
+	for path := range prog.Imported {
+		imported = append(imported, path)
+	}
+	sort.Strings(imported)
+	if got, want := strings.Join(imported, " "), "a b bad"; got != want {
+		t.Errorf("Program().Imported = %s, want %s", got, want)
+	}
+	if prog.Package("a").Pkg != a || !prog.Package("b").TransitivelyErrorFree || prog.Package("bad").TransitivelyErrorFree {
+		t.Errorf("Program() is inconsistent with the imported packages")
+	}
+
+	// The position index of the Program, once built, is updated
+	// as it grows.
+	f := prog.Package("a").Files[0]
+	if info, _, _ := prog.PathEnclosingInterval(f.Pos(), f.Pos()); info != prog.Package("a") {
+		t.Errorf("PathEnclosingInterval in a found %v, want a", info)
+	}
+	if _, err := imp.Import("c"); err != nil {
+		t.Fatal(err)
+	}
+	prog = imp.Program()
+	c := prog.Package("c")
+	if info, _, _ := prog.PathEnclosingInterval(c.Files[0].Pos(), c.Files[0].Pos()); info != c {
+		t.Errorf("PathEnclosingInterval in c found %v, want c", info)
+	}
+}
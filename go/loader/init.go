@@ -0,0 +1,58 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file exposes the order of package initialization.
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// A PackageInit describes the initialization of a package loaded
+// from source: its package-level variables are initialized, in the
+// order computed by the type checker, and then its init functions are
+// called, in the order of their appearance in its files.
+type PackageInit struct {
+	Package *PackageInfo
+	Files   []*ast.File          // files, in the order presented to the type checker
+	Vars    []*types.Initializer // variable initializers, in order (see types.Info.InitOrder)
+	Inits   []*ast.FuncDecl      // init functions, in order of execution
+}
+
+// Init returns a description of the initialization of the package.
+// It is empty for a package without syntax.
+func (info *PackageInfo) Init() *PackageInit {
+	init := &PackageInit{
+		Package: info,
+		Files:   info.Files,
+		Vars:    info.InitOrder,
+	}
+	for _, f := range info.Files {
+		for _, decl := range f.Decls {
+			if decl, ok := decl.(*ast.FuncDecl); ok && decl.Recv == nil && decl.Name.Name == "init" {
+				init.Inits = append(init.Inits, decl)
+			}
+		}
+	}
+	return init
+}
+
+// InitOrder returns the initialization of every package of the
+// Program, in an order in which each package is initialized after
+// those it imports, as required by the Go specification.  The order is
+// that of TopoSort, whose errors it reports.
+//
+func (prog *Program) InitOrder() ([]*PackageInit, error) {
+	order, err := prog.TopoSort()
+	if err != nil {
+		return nil, err
+	}
+	inits := make([]*PackageInit, len(order))
+	for i, info := range order {
+		inits[i] = info.Init()
+	}
+	return inits, nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestInitOrder(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {
+			"a1.go": `package a; import "b"; var x = y + b.B; func init() {}`,
+			"a2.go": `package a; var y = f(); func f() int { return 1 }; func init() {}; func (T) init() {}; type T int`,
+		},
+		"b": {"b.go": `package b; var B = 1`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	inits, err := prog.InitOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, init := range inits {
+		fmt.Fprintf(&buf, "%s: %d files, vars %v, inits", init.Package, len(init.Files), init.Vars)
+		for _, decl := range init.Inits {
+			fmt.Fprintf(&buf, " %s", prog.Fset.Position(decl.Pos()))
+		}
+		fmt.Fprintln(&buf)
+	}
+	want := `b: 1 files, vars [B = 1], inits
+a: 2 files, vars [y = f() x = y + b.B], inits /go/src/a/a1.go:1:41 /go/src/a/a2.go:1:52
+`
+	if got := buf.String(); got != want {
+		t.Errorf("InitOrder:\n%s\nwant:\n%s", got, want)
+	}
+}
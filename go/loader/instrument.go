@@ -0,0 +1,109 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the statement-level instrumentation of packages.
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+)
+
+// instrumented reports whether the package info should be
+// instrumented, according to Config.InstrumentPkgs.
+func (imp *importer) instrumented(info *PackageInfo) bool {
+	if imp.conf.InstrumentPkgs != nil {
+		return imp.conf.InstrumentPkgs(info.Pkg.Path())
+	}
+	return !info.Importable || imp.roots[info.Pkg.Path()]
+}
+
+// instrument applies Config.InstrumentStmt to the statements of each
+// of files, which belong to the package of the specified path, and
+// returns the instrumented files, as by instrumentFile.  If a file
+// cannot be reparsed, the error is returned and the original file is
+// used.
+func (imp *importer) instrument(path string, files []*ast.File) ([]*ast.File, []error) {
+	var errs []error
+	res := make([]*ast.File, len(files))
+	for i, f := range files {
+		res[i] = f
+		instrumented, src, err := instrumentFile(imp.conf.fset(), imp.conf.ParserMode, imp.conf.InstrumentStmt, path, f)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res[i] = instrumented
+		if src != nil {
+			imp.keepSource(instrumented, src)
+		}
+
+		imp.constraintsMu.Lock()
+		if constraints, ok := imp.constraints[f]; ok {
+			imp.constraints[instrumented] = constraints
+		}
+		if imp.generated[f] {
+			imp.generated[instrumented] = true
+		}
+		imp.constraintsMu.Unlock()
+	}
+	return res, errs
+}
+
+// instrumentFile applies instrumentStmt to the statements of f, a file
+// of the package of the specified path, and returns the instrumented
+// file, printed and parsed anew with //line directives that map its
+// positions back to those of the original, so that positions within
+// it are consistent, and diagnostics refer to the original source,
+// and the printed source.  A file that is not in fset is returned
+// unchanged, with no source.
+func instrumentFile(fset *token.FileSet, mode parser.Mode, instrumentStmt func(string, ast.Stmt) []ast.Stmt, path string, f *ast.File) (*ast.File, []byte, error) {
+	tf := fset.File(f.Pos())
+	if tf == nil {
+		return f, nil, nil
+	}
+
+	// Rewrite the statement lists bottom-up, so that the
+	// rewriter sees each statement after its nested
+	// statements, and never sees its own insertions.
+	var stack []ast.Node
+	ast.Inspect(f, func(n ast.Node) bool {
+		if n != nil {
+			stack = append(stack, n)
+			return true
+		}
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		switch n := n.(type) {
+		case *ast.BlockStmt:
+			n.List = instrumentStmts(instrumentStmt, path, n.List)
+		case *ast.CaseClause:
+			n.Body = instrumentStmts(instrumentStmt, path, n.Body)
+		case *ast.CommClause:
+			n.Body = instrumentStmts(instrumentStmt, path, n.Body)
+		}
+		return true
+	})
+
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.SourcePos, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, f); err != nil {
+		return nil, nil, err
+	}
+	instrumented, err := parser.ParseFile(fset, tf.Name(), buf.Bytes(), mode)
+	return instrumented, buf.Bytes(), err
+}
+
+// instrumentStmts returns the list of statements that replaces list.
+func instrumentStmts(instrumentStmt func(string, ast.Stmt) []ast.Stmt, path string, list []ast.Stmt) []ast.Stmt {
+	var res []ast.Stmt
+	for _, stmt := range list {
+		res = append(res, instrumentStmt(path, stmt)...)
+	}
+	return res
+}
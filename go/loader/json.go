@@ -0,0 +1,76 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the JSON encoding of a Program's metadata.
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// ProgramJSON is the schema of the JSON document written by WriteJSON.
+type ProgramJSON struct {
+	Packages []PackageJSON // packages, in the order of SortedPackages
+	Errors   int           // total number of errors
+}
+
+// PackageJSON is the schema of a package in the output of WriteJSON.
+type PackageJSON struct {
+	Path                  string   // package path
+	Name                  string   // package name
+	Initial               bool     `json:",omitempty"` // named by Config.ImportPkgs or Config.CreatePkgs
+	Created               bool     `json:",omitempty"` // in Program.Created
+	Importable            bool     `json:",omitempty"` // as PackageInfo.Importable
+	Test                  bool     `json:",omitempty"` // external test package or package augmented by its tests
+	TransitivelyErrorFree bool     `json:",omitempty"` // as PackageInfo.TransitivelyErrorFree
+	Files                 []string `json:",omitempty"` // names of files with syntax, as in the Program's FileSet
+	Imports               []string `json:",omitempty"` // paths of imported packages, as by ImportGraph
+	Errors                []string `json:",omitempty"` // error messages
+}
+
+// WriteJSON writes to w a JSON document, of the form described by
+// ProgramJSON, that summarizes the packages of the program, their
+// files, their imports, and their errors, for consumption by tools not
+// written in Go.
+//
+func (prog *Program) WriteJSON(w io.Writer) error {
+	created := make(map[*PackageInfo]bool)
+	for _, info := range prog.Created {
+		created[info] = true
+	}
+	g := prog.ImportGraph()
+	var doc ProgramJSON
+	for _, info := range prog.SortedPackages() {
+		p := PackageJSON{
+			Path:                  info.Pkg.Path(),
+			Name:                  info.Pkg.Name(),
+			Initial:               created[info] || prog.Imported[info.Pkg.Path()] == info,
+			Created:               created[info],
+			Importable:            info.Importable,
+			Test:                  prog.isTestPackage(info),
+			TransitivelyErrorFree: info.TransitivelyErrorFree,
+		}
+		for _, f := range info.Files {
+			if tf := prog.Fset.File(f.Pos()); tf != nil {
+				p.Files = append(p.Files, tf.Name())
+			}
+		}
+		for _, to := range g.Imports[info] {
+			p.Imports = append(p.Imports, to.Pkg.Path())
+		}
+		for _, err := range info.Errors {
+			p.Errors = append(p.Errors, err.Error())
+		}
+		doc.Errors += len(info.Errors)
+		doc.Packages = append(doc.Packages, p)
+	}
+	data, err := json.MarshalIndent(&doc, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
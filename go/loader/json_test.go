@@ -0,0 +1,43 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestWriteJSON(t *testing.T) {
+	prog := graphProgram(t)
+	var buf bytes.Buffer
+	if err := prog.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc loader.ProgramJSON
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.Bytes())
+	}
+	var got bytes.Buffer
+	for _, p := range doc.Packages {
+		fmt.Fprintf(&got, "%s %s initial=%t created=%t importable=%t test=%t ok=%t files=%s imports=%s errors=%d\n",
+			p.Path, p.Name, p.Initial, p.Created, p.Importable, p.Test, p.TransitivelyErrorFree, p.Files, p.Imports, len(p.Errors))
+	}
+	want := `a a initial=true created=false importable=true test=true ok=true files=[/go/src/a/a.go /go/src/a/a_test.go] imports=[b c] errors=0
+a_test a_test initial=true created=true importable=false test=true ok=true files=[/go/src/a/x_test.go] imports=[a d] errors=0
+b b initial=false created=false importable=true test=false ok=true files=[/go/src/b/b.go] imports=[a] errors=0
+c c initial=false created=false importable=true test=false ok=true files=[/go/src/c/c.go] imports=[d] errors=0
+d d initial=false created=false importable=true test=false ok=true files=[/go/src/d/d.go] imports=[] errors=0
+`
+	if got.String() != want {
+		t.Errorf("WriteJSON:\n%s\nwant:\n%s", got.String(), want)
+	}
+	if doc.Errors != 0 {
+		t.Errorf("Errors = %d, want 0", doc.Errors)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the Limits on the resources spent loading each
+// package, and the checks that enforce them.
+
+import (
+	"fmt"
+	"go/build"
+	"go/scanner"
+	"go/token"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+// Limits bounds the resources that Load spends on each package, so
+// that a program that loads untrusted source trees cannot be made to
+// exhaust its memory or stack by a crafted input.  A zero field
+// imposes no limit.
+//
+// A package that exceeds a limit is not loaded in full: the offending
+// file, or in the case of MaxPackageFiles, the entire package, is
+// omitted, and an error is reported in PackageInfo.Errors.
+type Limits struct {
+	// MaxFileSize is the maximum size in bytes of a source file.
+	// Larger files are not read beyond the limit.
+	MaxFileSize int64
+
+	// MaxPackageFiles is the maximum number of source files that
+	// Load reads for a package, its in-package tests, or its
+	// external tests, including cgo files.  Files supplied already
+	// parsed, or as source in the Config, are not counted.
+	MaxPackageFiles int
+
+	// MaxNestingDepth is the maximum depth to which parentheses,
+	// brackets, and braces may be nested in a source file, where
+	// each operator of a chain of unary operators such as "^^x" or
+	// "**T", and each "[]" of a slice type such as "[][]T", counts
+	// as a further level.  The depth is checked before the file is
+	// parsed, as the parser recurses at each level.
+	MaxNestingDepth int
+
+	// MaxFileSetSize is the maximum total size in bytes of the
+	// files in the FileSet, beyond which Load reports an error for
+	// each further file instead of parsing it.  The FileSet's own
+	// capacity, which is bounded by the range of token.Pos, is
+	// always enforced; beyond it, positions would be meaningless.
+	// Because files are parsed concurrently, the size may exceed
+	// the limit by that of the files being parsed.
+	//
+	// A load too large for one FileSet may be divided among
+	// several by LoadPartitioned.
+	MaxFileSetSize int
+}
+
+// maxFileSetBase is the capacity of a token.FileSet: each file of a
+// FileSet occupies the range of Pos values from its base, a
+// nonnegative int, to its base plus its size.
+const maxFileSetBase = int(^uint(0) >> 1)
+
+// checkFiles reports an error if n files exceed MaxPackageFiles.
+func (l *Limits) checkFiles(path string, n int) error {
+	if l.MaxPackageFiles > 0 && n > l.MaxPackageFiles {
+		return fmt.Errorf("package %s has %d files, exceeding the limit of %d", path, n, l.MaxPackageFiles)
+	}
+	return nil
+}
+
+// checkSource reports an error if the contents of the named file
+// exceed MaxFileSize or MaxNestingDepth.
+func (l *Limits) checkSource(name string, src []byte) error {
+	if l.MaxFileSize > 0 && int64(len(src)) > l.MaxFileSize {
+		return fmt.Errorf("%s: file exceeds the size limit of %d bytes", name, l.MaxFileSize)
+	}
+	if l.MaxNestingDepth > 0 {
+		if pos, ok := nestingDepth(name, src, l.MaxNestingDepth); !ok {
+			return fmt.Errorf("%s: nesting depth exceeds the limit of %d", pos, l.MaxNestingDepth)
+		}
+	}
+	return nil
+}
+
+// checkCgoFiles reports an error if the contents of any of the
+// CgoFiles of bp exceed MaxFileSize or MaxNestingDepth.
+func (imp *importer) checkCgoFiles(bp *build.Package) error {
+	l := &imp.conf.Limits
+	if l.MaxFileSize <= 0 && l.MaxNestingDepth <= 0 {
+		return nil
+	}
+	ctxt := imp.conf.build()
+	for _, name := range bp.CgoFiles {
+		file := buildutil.JoinPath(ctxt, bp.Dir, name)
+		src, err := readSource(ctxt, file, l)
+		if err != nil {
+			return err
+		}
+		if imp.conf.DisplayPath != nil {
+			file = imp.conf.DisplayPath(file)
+		}
+		if err := l.checkSource(file, src); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFileSet reports an error if adding the named file, of the
+// specified size, to fset would exceed MaxFileSetSize or the capacity
+// of fset.
+func (l *Limits) checkFileSet(fset *token.FileSet, name string, size int) error {
+	max := maxFileSetBase
+	if l.MaxFileSetSize > 0 && l.MaxFileSetSize < max {
+		max = l.MaxFileSetSize
+	}
+	if base := fset.Base(); base > max-size-1 {
+		return fmt.Errorf("%s: FileSet exhausted: adding %d bytes to %d exceeds the limit of %d; use LoadPartitioned to divide the load", name, size, base, max)
+	}
+	return nil
+}
+
+// nestingDepth scans src and reports whether its parentheses,
+// brackets, and braces, together with any chains of unary operators
+// and slice type constructors, are nested no deeper than max.  If
+// not, it returns the position of the first token beyond the limit.
+// Scanning errors are ignored; the parser reports them.
+func nestingDepth(name string, src []byte, max int) (token.Position, bool) {
+	fset := token.NewFileSet()
+	file := fset.AddFile(name, -1, len(src))
+	var s scanner.Scanner
+	s.Init(file, src, nil, 0)
+	depth := 0 // of enclosing parens, brackets, and braces
+	chain := 0 // length of the current chain of unary operators and "[]"s
+	prev := token.ILLEGAL
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return token.Position{}, true
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RBRACK:
+			if depth > 0 {
+				depth-- // unmatched closers do not grant depth
+			}
+			if prev == token.LBRACK {
+				chain++ // a slice type
+			} else {
+				chain = 0
+			}
+		case token.RPAREN, token.RBRACE:
+			if depth > 0 {
+				depth--
+			}
+			chain = 0
+		case token.ADD, token.SUB, token.XOR, token.NOT, token.MUL, token.AND, token.ARROW:
+			chain++
+		default:
+			chain = 0
+		}
+		if depth+chain > max {
+			return fset.Position(pos), false
+		}
+		prev = tok
+	}
+}
@@ -7,6 +7,8 @@ package loader
 // See doc.go for package documentation and implementation notes.
 
 import (
+	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"go/ast"
@@ -14,15 +16,23 @@ import (
 	"go/parser"
 	"go/token"
 	"go/types"
+	"io"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/gccgoexportdata"
+	"golang.org/x/tools/go/gcexportdata"
 	"golang.org/x/tools/go/internal/cgo"
+	"golang.org/x/tools/go/types/typeutil"
 )
 
 var ignoreVendor build.ImportMode
@@ -38,10 +48,52 @@ type Config struct {
 	// method of Config.
 	Fset *token.FileSet
 
+	// Shared, if non-nil, holds the state that Load shares with
+	// other Loads, possibly concurrent, that use the same
+	// SharedState: its FileSet, which becomes Fset, and its cache
+	// of packages imported from export data.  Fset must be nil or
+	// the FileSet of Shared, and Checked must be nil.
+	Shared *SharedState
+
 	// ParserMode specifies the mode to be used by the parser when
 	// loading source packages.
 	ParserMode parser.Mode
 
+	// If CommentMaps is true, Load builds an ast.CommentMap for each
+	// file it loads from source, associating its comments with
+	// syntax nodes, and records it in PackageInfo.CommentMaps.
+	// ParserMode must include parser.ParseComments, or the maps will
+	// be empty.
+	CommentMaps bool
+
+	// If IndexDirectives is true, Load records the compiler
+	// directives, such as //go:noinline and //go:linkname, of each
+	// file it loads from source in PackageInfo.Directives.  As with
+	// CommentMaps, ParserMode must include parser.ParseComments.
+	IndexDirectives bool
+
+	// If KeepSource is true, Load retains the source from which it
+	// parsed each file, so that Program.Save can save it.
+	KeepSource bool
+
+	// PhysicalPositions selects which positions the Program reports
+	// for files containing //line directives, such as generated
+	// files.  By default, positions are logical: they are adjusted by
+	// the directives, as by Fset.Position.  If PhysicalPositions is
+	// true, they are the positions within the files as read.
+	//
+	// The choice affects Program.Position, the line and column
+	// arguments of Program.PosOf, and the positions of type errors
+	// printed in the absence of a TypeChecker.Error function.
+	PhysicalPositions bool
+
+	// If IndexReferences is true, Load builds an index from each
+	// object to the identifiers that define or refer to it, as each
+	// package is type-checked, so that Program.ReferencesTo need not
+	// search the entire program.  The index consumes memory
+	// proportional to the number of identifiers in the program.
+	IndexReferences bool
+
 	// TypeChecker contains options relating to the type checker.
 	//
 	// The supplied IgnoreFuncBodies is not used; the effective
@@ -57,8 +109,84 @@ type Config struct {
 	// checked.
 	TypeCheckFuncBodies func(path string) bool
 
+	// ImportFromBinary is a predicate over package paths.  A
+	// dependency for which the predicate is true is imported from
+	// the export data in the object file installed for it by the
+	// compiler, instead of being loaded from source.  This is much
+	// faster, but the resulting PackageInfo has no syntax trees and
+	// no type-checker facts.  Initial packages are always loaded
+	// from source.
+	//
+	// Export data refers to the package's own dependencies, which
+	// are consequently imported from export data too, so the
+	// predicate should also hold for them.  If nil, all packages
+	// are loaded from source.
+	//
+	// A binary-only package, whose source files contain only a
+	// "//go:binary-only-package" comment and a package clause, is
+	// imported from export data regardless of the predicate, even
+	// if it is an initial package, since it has no source to load.
+	ImportFromBinary func(path string) bool
+
+	// Compiler selects the compiler, "gc" or "gccgo", whose object
+	// files are read by ImportFromBinary.  It determines both the
+	// installation directory and the format of the export data.
+	// If empty, the Compiler of the effective build context is used.
+	Compiler string
+
+	// InstallSuffix, if non-empty, overrides the InstallSuffix of
+	// the effective build context, which selects the directory of
+	// installed packages as for "go build -installsuffix".
+	InstallSuffix string
+
+	// PkgDirs is a list of directories in which ImportFromBinary
+	// looks for object files before the standard installation
+	// directory.  Each directory has the same layout as
+	// $GOPATH/pkg/$GOOS_$GOARCH, for example: dir/fmt.a for gc or
+	// dir/libfmt.a for gccgo.
+	PkgDirs []string
+
+	// Checked maps import paths to packages type-checked by a
+	// previous run, such as an earlier Load, whose PackageInfos a
+	// Load may use as is, without locating, parsing, or checking
+	// the packages again.  Incremental drivers that cache the
+	// results of each package may use it to load only the packages
+	// that have changed.  The dependencies of each such package,
+	// as given by its Pkg.Imports, are taken from the previous run
+	// too, whether or not they appear in Checked, so that types
+	// remain identical across packages.  If a package has syntax,
+	// its positions are those of the previous run's FileSet, which
+	// should therefore be Fset.
+	//
+	// The new Program has its own copy of each PackageInfo, which
+	// shares the syntax trees and type information of the original
+	// but not its mutable state, so the previous Program remains
+	// unchanged and usable, even by queries that run concurrently
+	// with Load.
+	//
+	// As with ExportFiles, the initial packages are always loaded
+	// from source.  Checked cannot be combined with Shared.
+	Checked map[string]*PackageInfo
+
+	// ExportFiles maps import paths to the names of files containing
+	// their export data, for build systems that know exactly where
+	// each compiled dependency lives.  A dependency in the map is
+	// imported from the named file, without searching for its source
+	// or consulting ImportFromBinary.  The file may be an object or
+	// archive file produced by the compiler, or raw export data as
+	// written by gcexportdata.Write or Program.WriteExportData.  As
+	// with ImportFromBinary, initial packages are always loaded from
+	// source.
+	ExportFiles map[string]string
+
 	// If Build is non-nil, it is used to locate source packages.
-	// Otherwise &build.Default is used.
+	// Otherwise &build.Default is used, unless GOROOT or GOPATH is
+	// set.
+	//
+	// If Build.UseAllFiles is set, all Go files in a package
+	// directory are loaded regardless of their build constraints.
+	// The constraints of each file are recorded in
+	// PackageInfo.Constraints.
 	//
 	// By default, cgo is invoked to preprocess Go files that
 	// import the fake package "C".  This behaviour can be
@@ -66,6 +194,24 @@ type Config struct {
 	// to startup, or by setting Build.CgoEnabled=false.
 	Build *build.Context
 
+	// GOROOT and GOPATH, if non-empty, override the corresponding
+	// fields of the effective build context.  GOPATH is a list of
+	// directories separated by filepath.ListSeparator.
+	//
+	// If Build is nil, setting either field isolates the load from
+	// the process environment: instead of build.Default, the
+	// effective context is one that describes the host, runtime.GOOS
+	// and runtime.GOARCH, for the gc compiler, with the release tags
+	// of the Go version that built the program, no other build tags,
+	// and cgo disabled.  Neither root then defaults
+	// to that of the environment, so a client that needs the
+	// standard library must set GOROOT too.  A client that needs
+	// other settings should supply a complete Build context.
+	//
+	// Load fails if any of the specified directories does not exist.
+	GOROOT string
+	GOPATH string
+
 	// The current directory, used for resolving relative package
 	// references such as "./go/loader".  If empty, os.Getwd will be
 	// used instead.
@@ -83,31 +229,220 @@ type Config struct {
 	// false, Load will fail if any package had an error.
 	AllowErrors bool
 
+	// If IsolateFailures is true, a package that cannot be found or
+	// read, for example because its directory is missing or
+	// unreadable, does not cause Load to fail.  Instead it is
+	// recorded as a PackageInfo whose Failed field is set, and Load
+	// fails only if some package that does not depend, directly or
+	// indirectly, on a failed package has errors.
+	IsolateFailures bool
+
+	// Parallelism is the maximum number of packages that Load
+	// type-checks concurrently.  If zero, there is no limit.
+	Parallelism int
+
+	// Limits bounds the resources spent on each package, for
+	// programs that load untrusted source trees.
+	Limits Limits
+
 	// CreatePkgs specifies a list of non-importable initial
 	// packages to create.  The resulting packages will appear in
 	// the corresponding elements of the Program.Created slice.
 	CreatePkgs []PkgSpec
 
+	// SplitCreatePkgs causes Load to partition the files of each
+	// CreatePkgs entry by directory and package declaration, and to
+	// create a separate package for each part, in order of the first
+	// file of each part.  This permits, for example, sibling packages
+	// emitted by a code generator to be checked in a single Load.
+	// If an entry has several parts, each has the path of the entry
+	// followed by a slash and its package name, or just its package
+	// name if the entry's path is empty.  The parts may import each
+	// other by these paths, in preference to any packages of the
+	// same paths, so they are importable, and are loaded like
+	// imported packages, but they appear consecutively in
+	// Program.Created.  A part whose path is that of an initial
+	// package or an earlier part is not importable.
+	//
+	// By default, all the files of an entry form a single package,
+	// and files with mismatched package declarations are errors.
+	SplitCreatePkgs bool
+
 	// ImportPkgs specifies a set of initial packages to load.
-	// The map keys are package paths.
+	// The map keys are package paths or patterns such as
+	// "golang.org/x/tools/...", "./..." or "std", which Load expands
+	// to the set of matching packages as 'go build' does.
 	//
 	// The map value indicates whether to load tests.  If true, Load
 	// will add and type-check two lists of files to the package:
 	// non-test files followed by in-package *_test.go files.  In
 	// addition, it will append the external test package (if any)
 	// to Program.Created.
+	//
+	// A key preceded by '-', such as "-./vendor/...", excludes the
+	// packages matching the rest of the key from the set.
 	ImportPkgs map[string]bool
 
+	// Exclude is a predicate over package paths.  Packages for
+	// which it returns true are omitted from the expansion of
+	// patterns in ImportPkgs, although they may still be loaded as
+	// dependencies.  If nil, no packages are excluded.
+	Exclude func(path string) bool
+
 	// FindPackage is called during Load to create the build.Package
 	// for a given import path from a given directory.
 	// If FindPackage is nil, (*build.Context).Import is used.
 	// A client may use this hook to adapt to a proprietary build
 	// system that does not follow the "go build" layout
-	// conventions, for example.
+	// conventions, for example.  GoListFindPackage returns an
+	// alternative that consults the go tool, DriverFindPackage one
+	// that runs the external driver of a build system, and the
+	// FindPackage method of a Manifest one that consults a list of
+	// files.  If FindPackage is nil, backends registered by
+	// RegisterBackend take precedence for the import paths they
+	// handle.
 	//
 	// It must be safe to call concurrently from multiple goroutines.
 	FindPackage func(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error)
 
+	// SourcePkgs maps the import path of a synthetic package to
+	// its source files, as a mapping from file name to contents.
+	// Load parses the files from memory, in order of name, and the
+	// package may be imported by others as if it existed in the
+	// workspace, in preference to any package of the same path.
+	// The file names appear in the FileSet as given; relative
+	// imports within a synthetic package are not supported.
+	//
+	// The CreateFromSource method populates this map.
+	SourcePkgs map[string]map[string]string
+
+	// ExpandTemplate, if non-nil, is called with each import path
+	// before the package it denotes is located, and returns the
+	// source files of the package if the path denotes the
+	// expansion of a template package, in the manner of code
+	// generators such as genny, or nil if it is an ordinary
+	// package.  For example, it might expand the template package
+	// "example.com/list" for the path "example.com/list/of/int",
+	// replacing its placeholder types by int.  The result, a
+	// mapping from file name to contents, is treated as if it
+	// were an entry of SourcePkgs, so that the program contains
+	// the concrete package, which other packages may import,
+	// without a separate generation step.  The hook may read the
+	// template's files through ctxt, the effective build context.
+	//
+	// It is called at most once for each path.  An error is
+	// reported as a failure to import the package.
+	//
+	// It must be safe to call concurrently from multiple goroutines.
+	ExpandTemplate func(ctxt *build.Context, path string) (map[string]string, error)
+
+	// ExtraFiles maps the import path of a package to additional
+	// files that are added to those of the package, whether an
+	// initial package or a dependency, after it has been parsed
+	// and before it is type-checked.  They may, for example,
+	// declare export shims or instrumentation stubs for a
+	// third-party package.  The files should be parsed using Fset,
+	// and must declare the package's name.  A package with extra
+	// files is loaded from source even if ImportFromBinary or
+	// ExportFiles would otherwise import it from export data.
+	//
+	// The AddFiles and AddSource methods populate this map.
+	ExtraFiles map[string][]*ast.File
+
+	// Preprocess, if non-nil, is called with the name and contents
+	// of each Go source file that Load reads, and returns the
+	// source to parse in its place.  It lets a client apply a
+	// simple preprocessor, or expand build tags, for example.
+	//
+	// The result lines, if non-nil, gives for each line of the
+	// output the number, counting from 1, of the line of the
+	// original from which it derives, or 0 for a line with no
+	// counterpart.  The loader inserts //line directives into the
+	// output as needed so that positions within it, as reported by
+	// Program.Position, refer to the original file.  If lines is
+	// nil, the output is parsed as is.  Since directives are
+	// inserted at the start of a line, the numbering of the output
+	// should not be discontinuous within a multi-line comment or
+	// raw string literal.
+	//
+	// If Preprocess returns an error, the file is not parsed and
+	// the error is reported as if the file could not be read.
+	// Files created from ASTs, and cgo files, are not preprocessed.
+	// Build constraints are evaluated, by FindPackage, on the
+	// original file.
+	//
+	// It must be safe to call concurrently from multiple goroutines.
+	Preprocess func(filename string, src []byte) (out []byte, lines []int, err error)
+
+	// FilterFiles, if non-nil, is called with the path of a package
+	// and a list of its files after they have been parsed, and
+	// returns the files to type-check, which may be a subset of
+	// them in any order.  It may, for example, exclude generated
+	// files, or impose a deterministic order, which matters since
+	// the order of files determines the order of package
+	// initialization.  It is called before MutateAST, and, like
+	// it, may be called twice for the same package.  File names
+	// may be obtained from Fset.
+	//
+	// It must be safe to call concurrently from multiple goroutines.
+	FilterFiles func(path string, files []*ast.File) []*ast.File
+
+	// MutateAST, if non-nil, is called with the path of a package
+	// and a list of its files after they have been parsed and
+	// before they are type-checked, and returns the files to check
+	// in their place.  It lets instrumentation and transformation
+	// tools rewrite the syntax trees, or add or remove files, and
+	// still obtain type information consistent with the result.
+	// The files may be modified in place.  New imports are loaded
+	// as usual.
+	//
+	// If it returns an error, the error is recorded in the
+	// package's Errors and the files are checked as parsed.
+	//
+	// Like AfterTypeCheck, it may be called twice for the same
+	// package: once for its files and again for its in-package
+	// test files.  It is not called for packages imported from
+	// export data.
+	//
+	// It must be safe to call concurrently from multiple goroutines.
+	MutateAST func(path string, files []*ast.File) ([]*ast.File, error)
+
+	// ExcludeGenerated causes Load to exclude generated files, as
+	// recorded in PackageInfo.Generated, from PackageInfo.Files, and
+	// from the files passed to AfterTypeCheck, so that analyses of
+	// the package ignore them.  They are still type-checked, and
+	// the objects they declare are recorded in the package's
+	// types.Info, so that the rest of the package is checked
+	// correctly.
+	ExcludeGenerated bool
+
+	// InstrumentStmt, if non-nil, is called for each statement of
+	// each package selected by InstrumentPkgs, and returns the
+	// statements that replace it in its enclosing statement list,
+	// which typically include the statement itself; for example, a
+	// coverage tool might precede it with the increment of a
+	// counter.  Nested statements are instrumented before the
+	// statements that contain them, and inserted statements are
+	// not themselves instrumented.
+	//
+	// The loader prints each instrumented file and parses it anew,
+	// with //line directives that refer to the original file, and
+	// type-checks the result.  So Program.Position, and thus the
+	// positions of diagnostics, refer to the original source, and
+	// Program.Positions reports the physical position within the
+	// instrumented source.  Inserted statements should have no
+	// positions, and then adopt those of their neighbors.
+	// Instrumentation follows MutateAST.
+	//
+	// It must be safe to call concurrently from multiple goroutines.
+	InstrumentStmt func(path string, stmt ast.Stmt) []ast.Stmt
+
+	// InstrumentPkgs reports whether the package of the specified
+	// path should be instrumented by InstrumentStmt.  If nil, only
+	// the initial packages, both imported and created, are
+	// instrumented.
+	InstrumentPkgs func(path string) bool
+
 	// AfterTypeCheck is called immediately after a list of files
 	// has been type-checked and appended to info.Files.
 	//
@@ -126,6 +461,15 @@ type Config struct {
 	//
 	// It must be safe to call concurrently from multiple goroutines.
 	AfterTypeCheck func(info *PackageInfo, files []*ast.File)
+
+	// Logf, if non-nil, is called with debugging messages at key
+	// points of Load: when a package is found, when its files are
+	// parsed and type-checked, when it is imported from export data,
+	// and when a request for a package is satisfied by one already
+	// loaded.  It may help to diagnose slow or surprising loads.
+	//
+	// It must be safe to call concurrently from multiple goroutines.
+	Logf func(format string, args ...interface{})
 }
 
 // A PkgSpec specifies a non-importable package to be created by Load.
@@ -137,10 +481,23 @@ type Config struct {
 type PkgSpec struct {
 	Path      string      // package path ("" => use package declaration)
 	Files     []*ast.File // ASTs of already-parsed files
-	Filenames []string    // names of files to be parsed
+	Filenames []string    // names or patterns of files to be parsed
 }
 
 // A Program is a Go program loaded from source as specified by a Config.
+//
+// A Program is immutable once Load returns, as are its PackageInfos and
+// the syntax trees and type information they hold, so it may be shared
+// by concurrent clients such as the goroutines of a query server.  Its
+// fields may be read, and its methods called, concurrently by multiple
+// goroutines; methods that compute derived information lazily, such
+// as PathEnclosingInterval's index of positions, synchronize
+// internally.  Clients must not modify a shared Program; a client that
+// wishes to discard type information to save memory, for example,
+// should do so in Config.AfterTypeCheck, during Load.
+//
+// The exception is the Program of an Importer, which changes with each
+// call to Importer.Import; see Importer.Program.
 type Program struct {
 	Fset *token.FileSet // the file set for this program
 
@@ -166,12 +523,76 @@ type Program struct {
 	// AllPackages contains the PackageInfo of every package
 	// encountered by Load: all initial packages and all
 	// dependencies, including incomplete ones.
+	// SortedPackages returns them in a deterministic order.
 	AllPackages map[*types.Package]*PackageInfo
 
+	// MethodSets caches the method sets of the program's types.
+	// It is used by Program methods such as Implements, and may be
+	// shared by clients to avoid recomputing method sets.
+	// It is safe for concurrent use.
+	MethodSets *typeutil.MethodSetCache
+
 	// importMap is the canonical mapping of package paths to
 	// packages.  It contains all Imported initial packages, but not
 	// Created ones, and all imported dependencies.
 	importMap map[string]*types.Package
+
+	// failed maps the paths of the packages that could not be
+	// found to their PackageInfos, if Config.IsolateFailures is set.
+	failed map[string]*PackageInfo
+
+	// files maps each cleaned file name to its package and syntax.
+	files map[string]fileInfo
+
+	// posIndex, built lazily, holds the position range of every
+	// file, ordered by start position.
+	posIndexOnce sync.Once
+	posIndex     []fileRange
+
+	// lineFiles, built lazily, maps each cleaned file name given by
+	// a //line directive to the files containing such directives.
+	lineFilesOnce sync.Once
+	lineFiles     map[string][]*token.File
+
+	// importGraph, built lazily, is the import graph used by Deps
+	// and Dependents; unlike that returned by ImportGraph, it is
+	// never modified.
+	importGraphOnce sync.Once
+	importGraph     *ImportGraph
+
+	// refs, if Config.IndexReferences, maps each object to the
+	// identifiers that define or refer to it, ordered by position.
+	refs map[types.Object][]*ast.Ident
+
+	physical bool // Config.PhysicalPositions
+
+	// These fields are those of the Config, for CheckFileEdit.
+	parserMode       parser.Mode
+	typeChecker      types.Config
+	preprocess       func(filename string, src []byte) ([]byte, []int, error)
+	mutateAST        func(path string, files []*ast.File) ([]*ast.File, error)
+	instrumentStmt   func(path string, stmt ast.Stmt) []ast.Stmt
+	excludeGenerated bool
+
+	// sources, if Config.KeepSource, holds the source from which
+	// each file parsed by the loader was parsed.
+	sources map[*ast.File][]byte
+
+	// savedImports, for a Program restored by LoadSaved, holds the
+	// import edges of each package, which cannot be derived from
+	// its syntax, since it is not type-checked.
+	savedImports map[*PackageInfo]savedEdges
+}
+
+type fileRange struct {
+	start, end token.Pos // [start, end)
+	info       *PackageInfo
+	file       *ast.File
+}
+
+type fileInfo struct {
+	info *PackageInfo
+	file *ast.File
 }
 
 // PackageInfo holds the ASTs and facts derived by the type-checker
@@ -188,12 +609,87 @@ type PackageInfo struct {
 	types.Info                        // type-checker deductions.
 	dir                   string      // package directory
 
+	// Constraints maps each file that declares build constraints
+	// to their expressions: that of its "//go:build" line, if any,
+	// or else those of its "// +build" lines, as go/build would
+	// interpret them.
+	Constraints map[*ast.File][]string
+
+	// Generated is the set of the package's files that are marked
+	// as generated by a "// Code generated ... DO NOT EDIT." comment
+	// before the package clause, following the convention of
+	// https://golang.org/s/generatedcode.  It includes files
+	// excluded from Files by Config.ExcludeGenerated.
+	Generated map[*ast.File]bool
+
+	// CommentMaps maps each file to its comment map, if
+	// Config.CommentMaps is set.
+	CommentMaps map[*ast.File]ast.CommentMap
+
+	// Directives holds the compiler directives of the package's
+	// files in order of position, if Config.IndexDirectives is set.
+	Directives []Directive
+
+	// Origin records why a Created package was created.
+	// It is nil for all other packages.
+	Origin *Origin
+
+	// Failed is set, if Config.IsolateFailures is true, for a
+	// package that could not be found, or some of whose files could
+	// not be read; Errors explains why.  A package that could not
+	// be found has no files, and its Pkg is empty.
+	Failed bool
+
+	// BinaryOnly is set for a binary-only package, which was
+	// imported from export data because it has no source; see
+	// Config.ImportFromBinary.  Like other packages imported from
+	// export data, it has no syntax trees or type-checker facts.
+	BinaryOnly bool
+
+	// OtherFiles holds the sorted names of the non-Go files in the
+	// package directory that go/build selects for the package:
+	// assembly (.s), C (.c and .h), and object (.syso) files.  A
+	// function declared without a body in a package that has
+	// assembly files is typically implemented by them.  Names are
+	// subject to Config.DisplayPath, like those of Files.
+	OtherFiles []string
+
 	checker   *types.Checker // transient type-checker state
 	errorFunc func(error)
+	byName    map[string]*ast.File // cleaned file name to syntax, built by Load
+
+	// checked holds the files passed to the type checker, after
+	// MutateAST and InstrumentStmt, including generated files
+	// excluded from Files; instrumented records whether
+	// InstrumentStmt applied to the package.  Both are for
+	// CheckFileEdit.
+	checked      []*ast.File
+	instrumented bool
 }
 
 func (info *PackageInfo) String() string { return info.Pkg.Path() }
 
+// File returns the syntax tree of the package's file with the given
+// name, which is compared with the file names recorded in the
+// Program's FileSet after cleaning both.  A name without a directory
+// matches a file of the package with that base name.  File returns
+// nil if the package has no such file.
+//
+func (info *PackageInfo) File(filename string) *ast.File {
+	filename = filepath.Clean(filename)
+	if f, ok := info.byName[filename]; ok {
+		return f
+	}
+	if filepath.Base(filename) == filename {
+		for name, f := range info.byName {
+			if filepath.Base(name) == filename {
+				return f
+			}
+		}
+	}
+	return nil
+}
+
 func (info *PackageInfo) appendError(err error) {
 	if info.errorFunc != nil {
 		info.errorFunc(err)
@@ -203,9 +699,29 @@ func (info *PackageInfo) appendError(err error) {
 	info.Errors = append(info.Errors, err)
 }
 
+// An ImportMainError is the error recorded in the PackageInfo of a
+// package that imports a package named main, which is a program, not
+// an importable package.  As with 'go build', a package in the same
+// directory, such as the external test package of a main package,
+// may import it.
+type ImportMainError struct {
+	Fset *token.FileSet
+	Pos  token.Pos // position of the import path
+	Path string    // the import path, as written
+}
+
+func (e *ImportMainError) Error() string {
+	return fmt.Sprintf("%s: import %q is a program, not an importable package",
+		e.Fset.Position(e.Pos), e.Path)
+}
+
 func (conf *Config) fset() *token.FileSet {
 	if conf.Fset == nil {
-		conf.Fset = token.NewFileSet()
+		if conf.Shared != nil {
+			conf.Fset = conf.Shared.fset
+		} else {
+			conf.Fset = token.NewFileSet()
+		}
 	}
 	return conf.Fset
 }
@@ -223,10 +739,12 @@ func (conf *Config) ParseFile(filename string, src interface{}) (*ast.File, erro
 }
 
 // FromArgsUsage is a partial usage message that applications calling
-// FromArgs may wish to include in their -help output.
+// FromArgs may wish to include in their -help output.  Being constant,
+// it does not describe the argument prefixes registered by
+// RegisterArgHandler; ArgsUsage returns it followed by a list of them.
 const FromArgsUsage = `
 <args> is a list of arguments denoting a set of initial packages.
-It may take one of two forms:
+It may take one of three forms:
 
 1. A list of *.go source files.
 
@@ -248,7 +766,29 @@ It may take one of two forms:
    import path may denote two packages.  (Whether this behaviour is
    enabled is tool-specific, and may depend on additional flags.)
 
+   An import path containing "..." is a pattern denoting all the
+   packages whose paths match it, as for 'go build': for example,
+   "golang.org/x/tools/..." or "./...".  The special names "std",
+   "cmd" and "all" denote the standard library, the Go commands,
+   and all packages in the workspace, respectively.
+
+   An import path or pattern preceded by '-' excludes the matching
+   packages, for example "./... -./vendor/... -./testdata/...".
+
+   An argument may also name a package directory, either relative
+   ("./foo") or absolute.  If the directory is within $GOROOT or
+   $GOPATH, the package has its usual import path; otherwise, it
+   is given a synthetic path of the form "_/dir/foo".
+
+3. A single '-' argument.
+
+   A single Go source file is read from the standard input and
+   type-checked as a package.
+
 A '--' argument terminates the list of packages.
+
+Arguments with certain prefixes, such as "notest:fmt", are
+interpreted specially; see ArgsUsage.
 `
 
 // FromArgs interprets args as a set of initial packages to load from
@@ -272,7 +812,25 @@ func (conf *Config) FromArgs(args []string, xtest bool) ([]string, error) {
 		}
 	}
 
-	if len(args) > 0 && strings.HasSuffix(args[0], ".go") {
+	// Apply the handlers of prefixed arguments.
+	var unprefixed []string
+	for _, arg := range args {
+		if h := lookupArgHandler(arg); h != nil {
+			if err := h.Handle(conf, arg[len(h.Prefix):], xtest); err != nil {
+				return nil, fmt.Errorf("%s: %v", arg, err)
+			}
+		} else {
+			unprefixed = append(unprefixed, arg)
+		}
+	}
+	args = unprefixed
+
+	if len(args) == 1 && args[0] == "-" {
+		// Read a single file from the standard input.
+		if err := conf.CreateFromReader("<standard input>", os.Stdin); err != nil {
+			return nil, err
+		}
+	} else if len(args) > 0 && strings.HasSuffix(args[0], ".go") {
 		// Assume args is a list of a *.go files
 		// denoting a single ad hoc package.
 		for _, arg := range args {
@@ -300,22 +858,99 @@ func (conf *Config) FromArgs(args []string, xtest bool) ([]string, error) {
 // a conf.CreatePkgs entry to create a package of the specified *.go
 // files.
 //
+// If path is non-empty, it becomes the path of the created package,
+// allowing callers to distinguish several packages with the same
+// package declaration, such as "main".  Otherwise the path is the
+// name in the package declaration of the files.
+//
+// A file name may be a shell-style pattern such as "cmd/*.go" or
+// "**/*_gen.go", in which "**" matches any number of directories.
+// Load replaces it by the files it matches, found using the build
+// context, and reports an error if there are none.
+//
+// A file name may also denote a directory, in which case Load
+// replaces it by the non-test Go files in that directory that
+// satisfy the build constraints of the build context.
+//
 func (conf *Config) CreateFromFilenames(path string, filenames ...string) {
 	conf.CreatePkgs = append(conf.CreatePkgs, PkgSpec{Path: path, Filenames: filenames})
 }
 
+// CreateFromReader is a convenience function that parses a Go source
+// file read from r, whose apparent name is filename, and adds a
+// conf.CreatePkgs entry to create a package of it, as if by
+// CreateFromFiles.  It is useful for reading a file from the standard
+// input.
+//
+// It returns an error if the file could not be read or parsed.
+//
+func (conf *Config) CreateFromReader(filename string, r io.Reader) error {
+	f, err := conf.ParseFile(filename, r)
+	if err != nil {
+		return err
+	}
+	conf.CreateFromFiles("", f)
+	return nil
+}
+
 // CreateFromFiles is a convenience function that adds a conf.CreatePkgs
 // entry to create package of the specified path and parsed files.
+// As with CreateFromFilenames, an empty path denotes the name in the
+// package declaration of the files.
 //
 func (conf *Config) CreateFromFiles(path string, files ...*ast.File) {
 	conf.CreatePkgs = append(conf.CreatePkgs, PkgSpec{Path: path, Files: files})
 }
 
+// CreateFromSource is a convenience function that adds to SourcePkgs
+// a synthetic package of the specified import path, whose source files
+// are given as a mapping from file name to contents, and adds it to
+// ImportPkgs, the set of initial packages.  Because it is importable,
+// it may be imported by other packages, for example to substitute a
+// mock implementation for a real one; and because it is parsed from
+// memory, tests of analyses may construct whole programs without
+// touching the file system.  Parse errors are reported by Load, in the
+// package's Errors.
+//
+func (conf *Config) CreateFromSource(path string, files map[string]string) {
+	if conf.SourcePkgs == nil {
+		conf.SourcePkgs = make(map[string]map[string]string)
+	}
+	conf.SourcePkgs[path] = files
+	conf.Import(path)
+}
+
+// AddFiles is a convenience function that adds the specified parsed
+// files to the ExtraFiles of the package of the specified import path.
+//
+func (conf *Config) AddFiles(path string, files ...*ast.File) {
+	if conf.ExtraFiles == nil {
+		conf.ExtraFiles = make(map[string][]*ast.File)
+	}
+	conf.ExtraFiles[path] = append(conf.ExtraFiles[path], files...)
+}
+
+// AddSource is a convenience function that parses a Go source file
+// using the Config's FileSet and adds it to the ExtraFiles of the
+// package of the specified import path.  The arguments filename and
+// src are as for ParseFile.
+//
+// It returns an error if the file could not be parsed.
+//
+func (conf *Config) AddSource(path, filename string, src interface{}) error {
+	f, err := conf.ParseFile(filename, src)
+	if err != nil {
+		return err
+	}
+	conf.AddFiles(path, f)
+	return nil
+}
+
 // ImportWithTests is a convenience function that adds path to
 // ImportPkgs, the set of initial source packages located relative to
 // $GOPATH.  The package will be augmented by any *_test.go files in
 // its directory that contain a "package x" (not "package x_test")
-// declaration.
+// declaration.  The path may be a pattern such as "./...".
 //
 // In addition, if any *_test.go files contain a "package x_test"
 // declaration, an additional package comprising just those files will
@@ -325,6 +960,7 @@ func (conf *Config) ImportWithTests(path string) { conf.addImport(path, true) }
 
 // Import is a convenience function that adds path to ImportPkgs, the
 // set of initial packages that will be imported from source.
+// The path may be a pattern such as "./...".
 //
 func (conf *Config) Import(path string) { conf.addImport(path, false) }
 
@@ -343,42 +979,128 @@ func (conf *Config) addImport(path string, tests bool) {
 // up to the AST root.  It searches all ast.Files of all packages in prog.
 // exact is defined as for astutil.PathEnclosingInterval.
 //
+// The first call builds an index of the files of the program, so
+// each query takes time logarithmic in the number of files.
+//
+// To obtain start and end from file names, lines, and columns,
+// logical or physical according to Config.PhysicalPositions, use
+// PosOf.
+//
 // The zero value is returned if not found.
 //
 func (prog *Program) PathEnclosingInterval(start, end token.Pos) (pkg *PackageInfo, path []ast.Node, exact bool) {
-	for _, info := range prog.AllPackages {
-		for _, f := range info.Files {
-			if f.Pos() == token.NoPos {
-				// This can happen if the parser saw
-				// too many errors and bailed out.
-				// (Use parser.AllErrors to prevent that.)
-				continue
-			}
-			if !tokenFileContainsPos(prog.Fset.File(f.Pos()), start) {
-				continue
-			}
-			if path, exact := astutil.PathEnclosingInterval(f, start, end); path != nil {
-				return info, path, exact
-			}
+	index := prog.fileRanges()
+	// Find the first file that ends after start.
+	i := sort.Search(len(index), func(i int) bool { return index[i].end > start })
+	// Several packages may contain the same file.
+	for ; i < len(index) && index[i].start <= start; i++ {
+		fr := index[i]
+		if path, exact := astutil.PathEnclosingInterval(fr.file, start, end); path != nil {
+			return fr.info, path, exact
 		}
 	}
 	return nil, nil, false
 }
 
+// fileRanges returns the position index of the program's files,
+// building it if necessary.
+func (prog *Program) fileRanges() []fileRange {
+	prog.posIndexOnce.Do(func() {
+		var index []fileRange
+		for _, info := range prog.SortedPackages() {
+			for _, f := range info.Files {
+				if f.Pos() == token.NoPos {
+					// This can happen if the parser saw
+					// too many errors and bailed out.
+					// (Use parser.AllErrors to prevent that.)
+					continue
+				}
+				tf := prog.Fset.File(f.Pos())
+				if tf == nil {
+					continue
+				}
+				start := token.Pos(tf.Base())
+				index = append(index, fileRange{start, start + token.Pos(tf.Size()), info, f})
+			}
+		}
+		sort.SliceStable(index, func(i, j int) bool { return index[i].start < index[j].start })
+		prog.posIndex = index
+	})
+	return prog.posIndex
+}
+
 // InitialPackages returns a new slice containing the set of initial
-// packages (Created + Imported) in unspecified order.
+// packages: the Created packages, in order, followed by the Imported
+// packages, ordered by import path.
 //
 func (prog *Program) InitialPackages() []*PackageInfo {
 	infos := make([]*PackageInfo, 0, len(prog.Created)+len(prog.Imported))
 	infos = append(infos, prog.Created...)
-	for _, info := range prog.Imported {
+	paths := make([]string, 0, len(prog.Imported))
+	for path := range prog.Imported {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		infos = append(infos, prog.Imported[path])
+	}
+	return infos
+}
+
+// InitialMainPackages returns a new slice containing those initial
+// packages, in the order of InitialPackages, that are named "main" and
+// declare a main function, that is, the packages of executables.
+//
+func (prog *Program) InitialMainPackages() []*PackageInfo {
+	var mains []*PackageInfo
+	for _, info := range prog.InitialPackages() {
+		if info.Pkg.Name() != "main" {
+			continue
+		}
+		if _, ok := info.Pkg.Scope().Lookup("main").(*types.Func); ok {
+			mains = append(mains, info)
+		}
+	}
+	return mains
+}
+
+// SortedPackages returns a new slice containing the PackageInfo of
+// every package in AllPackages, ordered by package path.  Created
+// packages, whose paths need not be unique, follow any other package
+// with the same path, in the order in which they appear in Created.
+//
+// Tools should iterate over SortedPackages rather than AllPackages
+// when the order of their output matters.
+//
+func (prog *Program) SortedPackages() []*PackageInfo {
+	created := make(map[*PackageInfo]int)
+	for i, info := range prog.Created {
+		created[info] = i + 1
+	}
+	infos := make([]*PackageInfo, 0, len(prog.AllPackages))
+	for _, info := range prog.AllPackages {
 		infos = append(infos, info)
 	}
+	sort.Slice(infos, func(i, j int) bool {
+		x, y := infos[i], infos[j]
+		if x.Pkg.Path() != y.Pkg.Path() {
+			return x.Pkg.Path() < y.Pkg.Path()
+		}
+		return created[x] < created[y]
+	})
 	return infos
 }
 
 // Package returns the ASTs and results of type checking for the
-// specified package.
+// specified package, or nil if the program contains no such package.
+//
+// The path is first looked up among the importable packages: the
+// Imported packages and all their dependencies, including those
+// imported from export data.  Otherwise it denotes the first Created
+// package, such as an external test package "fmt_test", with that
+// path.  Thus a Created package is not found if it shares its path
+// with an importable one.
+//
 func (prog *Program) Package(path string) *PackageInfo {
 	if info, ok := prog.AllPackages[prog.importMap[path]]; ok {
 		return info
@@ -388,9 +1110,36 @@ func (prog *Program) Package(path string) *PackageInfo {
 			return info
 		}
 	}
+	if info, ok := prog.failed[path]; ok {
+		return info
+	}
 	return nil
 }
 
+// PackageForFile returns the package containing the named file, and
+// the file's syntax tree, or nil if no package contains it.  The name
+// is compared with the file names recorded in prog.Fset, which are
+// subject to Config.DisplayPath, after cleaning both.
+//
+// If the file belongs to several packages, for example because it
+// was named by Config.CreatePkgs and is also part of an importable
+// package, the importable package is preferred.
+//
+func (prog *Program) PackageForFile(filename string) (*PackageInfo, *ast.File) {
+	fi := prog.files[filepath.Clean(filename)]
+	return fi.info, fi.file
+}
+
+// Files returns a new map from the name of each file of the Program,
+// cleaned as by PackageForFile, to its syntax tree.
+func (prog *Program) Files() map[string]*ast.File {
+	files := make(map[string]*ast.File, len(prog.files))
+	for name, fi := range prog.files {
+		files[name] = fi.file
+	}
+	return files
+}
+
 // ---------- Implementation ----------
 
 // importer holds the working state of the algorithm.
@@ -398,15 +1147,25 @@ type importer struct {
 	conf  *Config   // the client configuration
 	start time.Time // for logging
 
-	progMu sync.Mutex // guards prog
+	progMu sync.Mutex // guards prog and fromExportData
 	prog   *Program   // the resulting program
 
+	// fromExportData holds the packages that Load imported from
+	// export data, whose dependencies were created as a side
+	// effect in the cache of such packages.
+	fromExportData []*types.Package
+
 	// findpkg is a memoization of FindPackage.
 	findpkgMu sync.Mutex // guards findpkg
 	findpkg   map[findpkgKey]*findpkgValue
 
-	importedMu sync.Mutex             // guards imported
-	imported   map[string]*importInfo // all imported packages (incl. failures) by import path
+	// imported holds a future for each package, by import path,
+	// including failures.  The first goroutine to request a path
+	// creates its entry, under importedMu, and loads the package;
+	// the others wait for it to complete.  So each package is
+	// loaded once, however many goroutines import it concurrently.
+	importedMu sync.Mutex // guards imported
+	imported   map[string]*importInfo
 
 	// import dependency graph: graph[x][y] => x imports y
 	//
@@ -415,6 +1174,65 @@ type importer struct {
 	// packages.  Nodes are identified by their import paths.
 	graphMu sync.Mutex
 	graph   map[string]map[string]bool
+
+	// initial is the set of canonical paths of the initially
+	// imported packages, which are never imported from binary.
+	// It is not mutated once loading has begun.
+	initial map[string]bool
+
+	// roots is the set of paths of the initial packages, as
+	// specified, and of the importable parts of split packages.
+	// They are instrumented by default and never taken from
+	// Config.Checked.  It is not mutated once loading has begun.
+	roots map[string]bool
+
+	// binary maps package paths to the packages created by reading
+	// export data, so that references between them are consistent.
+	binaryMu *sync.Mutex // guards binary, which may be shared
+	binary   map[string]*types.Package
+
+	// checked maps package paths to the packages of
+	// Config.Checked and their dependencies.
+	// It is not mutated once loading has begun.
+	checked map[string]*PackageInfo
+
+	// splitParts maps the paths of the importable parts of
+	// CreatePkgs entries split by Config.SplitCreatePkgs to them.
+	// It is not mutated once loading has begun.
+	splitParts map[string]*createPart
+
+	// templates maps package paths to the results of
+	// Config.ExpandTemplate.
+	templatesMu sync.Mutex // guards templates
+	templates   map[string]*expansion
+
+	// checkLimit is a counting semaphore that limits the number of
+	// concurrent calls to the type checker, if Config.Parallelism > 0.
+	checkLimit chan bool
+
+	// constraints holds the build constraints of each parsed file,
+	// and generated the set of generated files, until addFiles
+	// moves them to the file's PackageInfo.
+	constraintsMu sync.Mutex // guards constraints and generated
+	constraints   map[*ast.File][]string
+	generated     map[*ast.File]bool
+
+	refsMu sync.Mutex // guards prog.refs
+
+	// failedImporters is the set of packages an import of which
+	// failed, if Config.IsolateFailures is set.
+	failedMu        sync.Mutex // guards failedImporters and prog.failed
+	failedImporters map[*PackageInfo]bool
+}
+
+// A createPart is a package to be created from the files of a
+// CreatePkgs entry, or from one part of them if it is split.
+type createPart struct {
+	path, dir  string
+	files      []*ast.File
+	errs       []error // I/O and parse errors
+	origin     *Origin
+	importable bool // an importable part of a split entry
 }
 
 type findpkgKey struct {
@@ -441,6 +1259,17 @@ type importInfo struct {
 	complete chan struct{} // closed to broadcast that info is set.
 }
 
+// isComplete reports, without blocking, whether ii is complete.
+// Only then is its info field safe to inspect.
+func (ii *importInfo) isComplete() bool {
+	select {
+	case <-ii.complete:
+		return true
+	default:
+		return false
+	}
+}
+
 // awaitCompletion blocks until ii is complete,
 // i.e. the info field is safe to inspect.
 func (ii *importInfo) awaitCompletion() {
@@ -475,40 +1304,97 @@ type importError struct {
 //
 // It is an error if no packages were loaded.
 //
+// Although packages are loaded in parallel, the result does not depend
+// on the scheduling of goroutines, on Parallelism, or on GOMAXPROCS:
+// for the same configuration and sources, the set of packages, and
+// the files, errors, and initialization order of each, are the same.
+// Only the interleaving of calls to TypeChecker.Error for different
+// packages may vary, and, if the program contains an import cycle,
+// which of the packages in the cycle reports it.
+//
 func (conf *Config) Load() (*Program, error) {
-	// Create a simple default error handler for parse/type errors.
-	if conf.TypeChecker.Error == nil {
-		conf.TypeChecker.Error = func(e error) { fmt.Fprintln(os.Stderr, e) }
+	imp, err := conf.newImporter()
+	if err != nil {
+		return nil, err
 	}
+	prog := imp.prog
 
-	// Set default working directory for relative package references.
-	if conf.Cwd == "" {
-		var err error
-		conf.Cwd, err = os.Getwd()
-		if err != nil {
-			return nil, err
+	// Expand patterns such as "./..." in the initial packages,
+	// and interpret absolute directory names.
+	importPkgs := imp.localizeDirs(imp.expandPatterns(conf.ImportPkgs))
+
+	// Initial packages are always loaded from source.
+	for path := range importPkgs {
+		if _, ok := conf.ExportFiles[path]; ok {
+			imp.initial[path] = true
 		}
+		imp.roots[path] = true
 	}
-
-	// Install default FindPackage hook using go/build logic.
-	if conf.FindPackage == nil {
-		conf.FindPackage = (*build.Context).Import
+	imp.addChecked()
+	if conf.ImportFromBinary != nil {
+		for path := range importPkgs {
+			// No vendor check on packages imported from the command line.
+			if bp, err := imp.findPackage(path, conf.Cwd, ignoreVendor); err == nil {
+				imp.initial[bp.ImportPath] = true
+			}
+		}
 	}
 
-	prog := &Program{
-		Fset:        conf.fset(),
-		Imported:    make(map[string]*PackageInfo),
-		importMap:   make(map[string]*types.Package),
-		AllPackages: make(map[*types.Package]*PackageInfo),
-	}
+	// Parse the files of conf.CreatePkgs.  The parts of an entry
+	// split by SplitCreatePkgs may import each other, so they are
+	// registered, before loading begins, as importable packages.
+	var createParts []*createPart
+	for i, cp := range conf.CreatePkgs {
+		origin := &Origin{Spec: i, Filenames: cp.Filenames, Parsed: cp.Files != nil}
+		filenames, errs := expandFilenames(conf.build(), conf.Cwd, cp.Filenames)
+		filenames, dups := dedupFilenames(conf.build(), conf.Cwd, filenames)
+		for _, name := range dups {
+			conf.TypeChecker.Error(fmt.Errorf("warning: CreatePkgs[%d]: ignoring duplicate file %s", i, name))
+		}
+		if err := conf.Limits.checkFiles(fmt.Sprintf("CreatePkgs[%d]", i), len(filenames)); err != nil {
+			errs = append(errs, err)
+			filenames = nil
+		}
+		imp.logf("parse CreatePkgs[%d]: %d files", i, len(filenames))
+		files, parseErrs := parseFiles(conf.fset(), conf.build(), nil, conf.Cwd, filenames, conf.ParserMode, &conf.Limits, conf.Preprocess, imp.recordFile)
+		errs = append(errs, parseErrs...)
+		files = append(files, cp.Files...)
 
-	imp := importer{
-		conf:     conf,
-		prog:     prog,
-		findpkg:  make(map[findpkgKey]*findpkgValue),
-		imported: make(map[string]*importInfo),
-		start:    time.Now(),
-		graph:    make(map[string]map[string]bool),
+		parts := [][]*ast.File{files}
+		if conf.SplitCreatePkgs && len(files) > 1 {
+			parts = splitFiles(files, func(f *ast.File) string {
+				return fileDir(conf.fset(), f)
+			})
+		}
+		for _, files := range parts {
+			files, nameErrs := majorityName(conf.fset(), files)
+			errs = append(errs, nameErrs...)
+
+			part := &createPart{path: cp.Path, dir: conf.Cwd, files: files, errs: errs, origin: origin}
+			if len(files) > 0 && files[0].Pos().IsValid() {
+				part.dir = filepath.Dir(conf.fset().File(files[0].Pos()).Name())
+			}
+			if len(parts) > 1 && len(files) > 0 {
+				part.path = files[0].Name.Name
+				if cp.Path != "" {
+					part.path = cp.Path + "/" + part.path
+				}
+				if _, ok := importPkgs[part.path]; !ok && imp.splitParts[part.path] == nil {
+					part.importable = true
+					imp.splitParts[part.path] = part
+					imp.initial[part.path] = true
+					imp.roots[part.path] = true
+				}
+			} else if part.path == "" {
+				if len(files) > 0 {
+					part.path = files[0].Name.Name
+				} else {
+					part.path = "(unnamed)"
+				}
+			}
+			createParts = append(createParts, part)
+			errs = nil // report I/O and parse errors only once
+		}
 	}
 
 	// -- loading proper (concurrent phase) --------------------------------
@@ -518,10 +1404,14 @@ func (conf *Config) Load() (*Program, error) {
 	// Load the initially imported packages and their dependencies,
 	// in parallel.
 	// No vendor check on packages imported from the command line.
-	infos, importErrors := imp.importAll("", conf.Cwd, conf.ImportPkgs, ignoreVendor)
+	infos, importErrors := imp.importAll("", conf.Cwd, importPkgs, ignoreVendor)
 	for _, ie := range importErrors {
 		conf.TypeChecker.Error(ie.err) // failed to create package
-		errpkgs = append(errpkgs, ie.path)
+		if conf.IsolateFailures {
+			prog.Imported[ie.path] = imp.addFailed(ie.path, ie.err)
+		} else {
+			errpkgs = append(errpkgs, ie.path)
+		}
 	}
 	for _, info := range infos {
 		prog.Imported[info.Pkg.Path()] = info
@@ -530,7 +1420,7 @@ func (conf *Config) Load() (*Program, error) {
 	// Augment the designated initial packages by their tests.
 	// Dependencies are loaded in parallel.
 	var xtestPkgs []*build.Package
-	for importPath, augment := range conf.ImportPkgs {
+	for importPath, augment := range importPkgs {
 		if !augment {
 			continue
 		}
@@ -548,6 +1438,11 @@ func (conf *Config) Load() (*Program, error) {
 			xtestPkgs = append(xtestPkgs, bp)
 		}
 
+		// A binary-only package has no syntax to augment.
+		if bp.BinaryOnly {
+			continue
+		}
+
 		// Consult the cache using the canonical package path.
 		path := bp.ImportPath
 		imp.importedMu.Lock() // (unnecessary, we're sequential here)
@@ -577,7 +1472,7 @@ func (conf *Config) Load() (*Program, error) {
 		imp.importedMu.Unlock()
 
 		// Parse the in-package test files.
-		files, errs := imp.conf.parsePackageFiles(bp, 't')
+		files, errs := imp.parsePackageFiles(bp, 't')
 		for _, err := range errs {
 			info.appendError(err)
 		}
@@ -588,8 +1483,9 @@ func (conf *Config) Load() (*Program, error) {
 		imp.addFiles(info, files, false)
 	}
 
-	createPkg := func(path, dir string, files []*ast.File, errs []error) {
+	createPkg := func(path, dir string, files []*ast.File, errs []error, origin *Origin) {
 		info := imp.newPackageInfo(path, dir)
+		info.Origin = origin
 		for _, err := range errs {
 			info.appendError(err)
 		}
@@ -602,31 +1498,31 @@ func (conf *Config) Load() (*Program, error) {
 	}
 
 	// Create packages specified by conf.CreatePkgs.
-	for _, cp := range conf.CreatePkgs {
-		files, errs := parseFiles(conf.fset(), conf.build(), nil, conf.Cwd, cp.Filenames, conf.ParserMode)
-		files = append(files, cp.Files...)
-
-		path := cp.Path
-		if path == "" {
-			if len(files) > 0 {
-				path = files[0].Name.Name
-			} else {
-				path = "(unnamed)"
-			}
-		}
-
-		dir := conf.Cwd
-		if len(files) > 0 && files[0].Pos().IsValid() {
-			dir = filepath.Dir(conf.fset().File(files[0].Pos()).Name())
+	// The importable parts of split entries are loaded,
+	// along with their dependencies, in parallel.
+	splitPaths := make(map[string]bool)
+	for path := range imp.splitParts {
+		splitPaths[path] = false
+	}
+	splitInfos := make(map[string]*PackageInfo)
+	infos, _ = imp.importAll("", conf.Cwd, splitPaths, 0) // parts are always found
+	for _, info := range infos {
+		splitInfos[info.Pkg.Path()] = info
+	}
+	for _, part := range createParts {
+		if info := splitInfos[part.path]; part.importable && info != nil {
+			info.Origin = part.origin
+			prog.Created = append(prog.Created, info)
+		} else {
+			createPkg(part.path, part.dir, part.files, part.errs, part.origin)
 		}
-		createPkg(path, dir, files, errs)
 	}
 
 	// Create external test packages.
 	sort.Sort(byImportPath(xtestPkgs))
 	for _, bp := range xtestPkgs {
-		files, errs := imp.conf.parsePackageFiles(bp, 'x')
-		createPkg(bp.ImportPath+"_test", bp.Dir, files, errs)
+		files, errs := imp.parsePackageFiles(bp, 'x')
+		createPkg(bp.ImportPath+"_test", bp.Dir, files, errs, &Origin{Spec: -1, XTestOf: bp.ImportPath})
 	}
 
 	// -- finishing up (sequential) ----------------------------------------
@@ -635,27 +1531,19 @@ func (conf *Config) Load() (*Program, error) {
 		return nil, errors.New("no initial packages were loaded")
 	}
 
-	// Create infos for indirectly imported packages.
-	// e.g. incomplete packages without syntax, loaded from export data.
-	for _, obj := range prog.importMap {
-		info := prog.AllPackages[obj]
-		if info == nil {
-			prog.AllPackages[obj] = &PackageInfo{Pkg: obj, Importable: true}
-		} else {
-			// finished
-			info.checker = nil
-			info.errorFunc = nil
-		}
-	}
+	imp.addIndirect()
 
 	if !conf.AllowErrors {
-		// Report errors in indirectly imported packages.
+		// Report errors in indirectly imported packages,
+		// other than those due to failed packages.
+		isolated := imp.isolated()
 		for _, info := range prog.AllPackages {
-			if len(info.Errors) > 0 {
+			if len(info.Errors) > 0 && !isolated[info.Pkg] {
 				errpkgs = append(errpkgs, info.Pkg.Path())
 			}
 		}
 		if errpkgs != nil {
+			sort.Strings(errpkgs)
 			var more string
 			if len(errpkgs) > 3 {
 				more = fmt.Sprintf(" and %d more", len(errpkgs)-3)
@@ -666,42 +1554,219 @@ func (conf *Config) Load() (*Program, error) {
 		}
 	}
 
-	markErrorFreePackages(prog.AllPackages)
+	imp.finish()
 
 	return prog, nil
 }
 
-type byImportPath []*build.Package
-
-func (b byImportPath) Len() int           { return len(b) }
-func (b byImportPath) Less(i, j int) bool { return b[i].ImportPath < b[j].ImportPath }
-func (b byImportPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
-
-// markErrorFreePackages sets the TransitivelyErrorFree flag on all
-// applicable packages.
-func markErrorFreePackages(allPackages map[*types.Package]*PackageInfo) {
-	// Build the transpose of the import graph.
-	importedBy := make(map[*types.Package]map[*types.Package]bool)
-	for P := range allPackages {
-		for _, Q := range P.Imports() {
-			clients, ok := importedBy[Q]
-			if !ok {
-				clients = make(map[*types.Package]bool)
-				importedBy[Q] = clients
-			}
-			clients[P] = true
-		}
+// addIndirect adds to the program the packages that were loaded only
+// indirectly, such as the dependencies of packages imported from
+// export data, which have no syntax.
+func (imp *importer) addIndirect() {
+	prog := imp.prog
+
+	// Record the dependencies of packages imported from binary.
+	// (The cache of such packages may be shared with other
+	// programs, so we follow the import edges.)
+	var deps []*types.Package
+	for _, pkg := range imp.fromExportData {
+		deps = append(deps, pkg.Imports()...)
 	}
-
-	// Find all packages reachable from some error package.
-	reachable := make(map[*types.Package]bool)
-	var visit func(*types.Package)
-	visit = func(p *types.Package) {
-		if !reachable[p] {
-			reachable[p] = true
-			for q := range importedBy[p] {
-				visit(q)
-			}
+	for len(deps) > 0 {
+		pkg := deps[len(deps)-1]
+		deps = deps[:len(deps)-1]
+		if _, ok := prog.importMap[pkg.Path()]; !ok && pkg != types.Unsafe {
+			prog.importMap[pkg.Path()] = pkg
+			deps = append(deps, pkg.Imports()...)
+		}
+	}
+
+	// Create infos for indirectly imported packages.
+	// e.g. incomplete packages without syntax, loaded from export data.
+	for _, obj := range prog.importMap {
+		info := prog.AllPackages[obj]
+		if info == nil {
+			prog.AllPackages[obj] = &PackageInfo{Pkg: obj, Importable: true}
+		} else {
+			// finished
+			info.checker = nil
+			info.errorFunc = nil
+		}
+	}
+}
+
+// finish computes the derived information of the program, once all
+// its packages are loaded.
+func (imp *importer) finish() {
+	prog := imp.prog
+
+	markErrorFreePackages(prog.AllPackages)
+
+	for _, refs := range prog.refs {
+		sort.Slice(refs, func(i, j int) bool { return refs[i].Pos() < refs[j].Pos() })
+	}
+
+	prog.indexFiles()
+
+	// Discard the lazily built indexes, in case the program
+	// is that of an Importer, and has grown since they were built.
+	prog.posIndexOnce = sync.Once{}
+	prog.posIndex = nil
+	prog.lineFilesOnce = sync.Once{}
+	prog.lineFiles = nil
+	prog.importGraphOnce = sync.Once{}
+	prog.importGraph = nil
+}
+
+// newImporter applies the defaults of conf and returns a new importer
+// for a new, empty Program.
+func (conf *Config) newImporter() (*importer, error) {
+	// Create a simple default error handler for parse/type errors.
+	if conf.TypeChecker.Error == nil {
+		conf.TypeChecker.Error = printError(conf.PhysicalPositions)
+	}
+
+	// Set default working directory for relative package references.
+	if conf.Cwd == "" {
+		var err error
+		conf.Cwd, err = os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := conf.checkRoots(); err != nil {
+		return nil, err
+	}
+	if conf.Shared != nil && conf.fset() != conf.Shared.fset {
+		return nil, fmt.Errorf("Config.Fset is not the FileSet of Config.Shared")
+	}
+	if conf.Shared != nil && conf.Checked != nil {
+		// Checked packages are entered in the cache of packages
+		// imported from export data, which Shared would publish
+		// to other Loads.
+		return nil, fmt.Errorf("Config.Checked cannot be used with Config.Shared")
+	}
+	if conf.ImportFromBinary != nil || conf.ExportFiles != nil {
+		switch compiler := conf.build().Compiler; compiler {
+		case "gc", "gccgo":
+		default:
+			return nil, fmt.Errorf("can't import from binary: unsupported compiler %q", compiler)
+		}
+	}
+
+	// Install default FindPackage hook using the registered
+	// backends and go/build logic.
+	if conf.FindPackage == nil {
+		conf.FindPackage = defaultFindPackage
+	}
+
+	prog := &Program{
+		Fset:        conf.fset(),
+		Imported:    make(map[string]*PackageInfo),
+		importMap:   make(map[string]*types.Package),
+		failed:      make(map[string]*PackageInfo),
+		AllPackages: make(map[*types.Package]*PackageInfo),
+		MethodSets:  new(typeutil.MethodSetCache),
+		physical:    conf.PhysicalPositions,
+		parserMode:  conf.ParserMode,
+		typeChecker: conf.TypeChecker,
+
+		preprocess:       conf.Preprocess,
+		mutateAST:        conf.MutateAST,
+		instrumentStmt:   conf.InstrumentStmt,
+		excludeGenerated: conf.ExcludeGenerated,
+	}
+
+	imp := &importer{
+		conf:     conf,
+		prog:     prog,
+		findpkg:  make(map[findpkgKey]*findpkgValue),
+		imported: make(map[string]*importInfo),
+		start:    time.Now(),
+		graph:    make(map[string]map[string]bool),
+		initial:  make(map[string]bool),
+		roots:    make(map[string]bool),
+		binary:   make(map[string]*types.Package),
+		binaryMu: new(sync.Mutex),
+		checked:  make(map[string]*PackageInfo),
+
+		failedImporters: make(map[*PackageInfo]bool),
+
+		templates:  make(map[string]*expansion),
+		splitParts: make(map[string]*createPart),
+
+		constraints: make(map[*ast.File][]string),
+		generated:   make(map[*ast.File]bool),
+	}
+	if conf.Shared != nil {
+		imp.binary = conf.Shared.binary
+		imp.binaryMu = &conf.Shared.mu
+	}
+	if conf.Parallelism > 0 {
+		imp.checkLimit = make(chan bool, conf.Parallelism)
+	}
+	if conf.IndexReferences {
+		prog.refs = make(map[types.Object][]*ast.Ident)
+	}
+	if conf.KeepSource {
+		prog.sources = make(map[*ast.File][]byte)
+	}
+
+	return imp, nil
+}
+
+// indexFiles indexes the files of each package by name, favoring
+// importable packages in prog.files.
+func (prog *Program) indexFiles() {
+	prog.files = make(map[string]fileInfo)
+	for _, info := range prog.SortedPackages() {
+		for _, f := range info.Files {
+			if tf := prog.Fset.File(f.Pos()); tf != nil {
+				name := filepath.Clean(tf.Name())
+				if info.byName == nil {
+					info.byName = make(map[string]*ast.File)
+				}
+				info.byName[name] = f
+				if prev, ok := prog.files[name]; !ok || info.Importable && !prev.info.Importable {
+					prog.files[name] = fileInfo{info, f}
+				}
+			}
+		}
+	}
+}
+
+type byImportPath []*build.Package
+
+func (b byImportPath) Len() int           { return len(b) }
+func (b byImportPath) Less(i, j int) bool { return b[i].ImportPath < b[j].ImportPath }
+func (b byImportPath) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// markErrorFreePackages sets the TransitivelyErrorFree flag on all
+// applicable packages.
+func markErrorFreePackages(allPackages map[*types.Package]*PackageInfo) {
+	// Build the transpose of the import graph.
+	importedBy := make(map[*types.Package]map[*types.Package]bool)
+	for P := range allPackages {
+		for _, Q := range P.Imports() {
+			clients, ok := importedBy[Q]
+			if !ok {
+				clients = make(map[*types.Package]bool)
+				importedBy[Q] = clients
+			}
+			clients[P] = true
+		}
+	}
+
+	// Find all packages reachable from some error package.
+	reachable := make(map[*types.Package]bool)
+	var visit func(*types.Package)
+	visit = func(p *types.Package) {
+		if !reachable[p] {
+			reachable[p] = true
+			for q := range importedBy[p] {
+				visit(q)
+			}
 		}
 	}
 	for _, info := range allPackages {
@@ -718,12 +1783,116 @@ func markErrorFreePackages(allPackages map[*types.Package]*PackageInfo) {
 	}
 }
 
+// addFailed records, if it has not already done so, that the package
+// denoted by path could not be found, and returns its PackageInfo.
+func (imp *importer) addFailed(path string, err error) *PackageInfo {
+	imp.failedMu.Lock()
+	defer imp.failedMu.Unlock()
+	info, ok := imp.prog.failed[path]
+	if !ok {
+		info = &PackageInfo{
+			Pkg:        types.NewPackage(path, pathpkg.Base(path)),
+			Importable: true,
+			Errors:     []error{err},
+			Failed:     true,
+		}
+		imp.prog.failed[path] = info
+		imp.progMu.Lock()
+		imp.prog.AllPackages[info.Pkg] = info
+		imp.progMu.Unlock()
+	}
+	return info
+}
+
+// isolated returns the set of packages that are failed, or depend
+// directly or indirectly on a failed package, if
+// Config.IsolateFailures is set.
+func (imp *importer) isolated() map[*types.Package]bool {
+	if !imp.conf.IsolateFailures {
+		return nil
+	}
+	importedBy := make(map[*types.Package][]*types.Package)
+	for P := range imp.prog.AllPackages {
+		for _, Q := range P.Imports() {
+			importedBy[Q] = append(importedBy[Q], P)
+		}
+	}
+	isolated := make(map[*types.Package]bool)
+	var visit func(*types.Package)
+	visit = func(p *types.Package) {
+		if !isolated[p] {
+			isolated[p] = true
+			for _, q := range importedBy[p] {
+				visit(q)
+			}
+		}
+	}
+	for _, info := range imp.prog.AllPackages {
+		if info.Failed || imp.failedImporters[info] {
+			visit(info.Pkg)
+		}
+	}
+	return isolated
+}
+
 // build returns the effective build context.
 func (conf *Config) build() *build.Context {
-	if conf.Build != nil {
-		return conf.Build
+	ctxt := conf.Build
+	if ctxt == nil {
+		if conf.GOROOT != "" || conf.GOPATH != "" {
+			ctxt = isolatedContext()
+		} else {
+			ctxt = &build.Default
+		}
+	}
+	if conf.GOROOT == "" && conf.GOPATH == "" && conf.Compiler == "" && conf.InstallSuffix == "" {
+		return ctxt
+	}
+	c := *ctxt // copy
+	if conf.GOROOT != "" {
+		c.GOROOT = conf.GOROOT
+	}
+	if conf.GOPATH != "" {
+		c.GOPATH = conf.GOPATH
+	}
+	if conf.Compiler != "" {
+		c.Compiler = conf.Compiler
+	}
+	if conf.InstallSuffix != "" {
+		c.InstallSuffix = conf.InstallSuffix
+	}
+	return &c
+}
+
+// isolatedContext returns a build context for the host that, unlike
+// build.Default, does not depend on the environment: it has no roots,
+// no build tags, and cgo disabled, since cgo must be found in the
+// environment.
+func isolatedContext() *build.Context {
+	return &build.Context{
+		GOOS:        runtime.GOOS,
+		GOARCH:      runtime.GOARCH,
+		Compiler:    "gc",
+		ReleaseTags: build.Default.ReleaseTags, // of the Go release, not the environment
 	}
-	return &build.Default
+}
+
+// checkRoots reports an error if the GOROOT or any GOPATH directory
+// specified by the Config does not exist in the effective build
+// context's file system.
+func (conf *Config) checkRoots() error {
+	ctxt := conf.build()
+	if conf.GOROOT != "" && !buildutil.IsDir(ctxt, conf.GOROOT) {
+		return fmt.Errorf("GOROOT directory %s does not exist", conf.GOROOT)
+	}
+	if conf.GOPATH != "" {
+		for _, dir := range buildutil.SplitPathList(ctxt, conf.GOPATH) {
+			if !buildutil.IsDir(ctxt, dir) {
+				return fmt.Errorf("GOPATH directory %s does not exist", dir)
+			}
+		}
+	}
+	return nil
 }
 
 // parsePackageFiles enumerates the files belonging to package path,
@@ -735,10 +1904,17 @@ func (conf *Config) build() *build.Context {
 //    't': include in-package *_test.go source files (TestGoFiles)
 //    'x': include external *_test.go source files. (XTestGoFiles)
 //
-func (conf *Config) parsePackageFiles(bp *build.Package, which rune) ([]*ast.File, []error) {
+func (imp *importer) parsePackageFiles(bp *build.Package, which rune) ([]*ast.File, []error) {
+	conf := imp.conf
 	if bp.ImportPath == "unsafe" {
 		return nil, nil
 	}
+	if part := imp.splitParts[bp.ImportPath]; part != nil {
+		if which == 'g' {
+			return part.files, part.errs
+		}
+		return nil, nil
+	}
 	var filenames []string
 	switch which {
 	case 'g':
@@ -751,17 +1927,63 @@ func (conf *Config) parsePackageFiles(bp *build.Package, which rune) ([]*ast.Fil
 		panic(which)
 	}
 
-	files, errs := parseFiles(conf.fset(), conf.build(), conf.DisplayPath, bp.Dir, filenames, conf.ParserMode)
+	n := len(filenames)
+	if which == 'g' {
+		n += len(bp.CgoFiles)
+	}
+	if err := conf.Limits.checkFiles(bp.ImportPath, n); err != nil {
+		return nil, []error{err}
+	}
+
+	imp.logf("parse %q (%c): start (%d files)", bp.ImportPath, which, len(filenames))
+	t0 := time.Now()
+	files, errs := parseFiles(conf.fset(), conf.build(), conf.DisplayPath, bp.Dir, filenames, conf.ParserMode, &conf.Limits, conf.Preprocess, imp.recordFile)
+
+	// Parse the sources of a synthetic package.
+	if src := imp.source(bp.ImportPath); src != nil && which == 'g' {
+		var names []string
+		for name := range src {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := conf.Limits.checkSource(name, []byte(src[name])); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := conf.Limits.checkFileSet(conf.fset(), name, len(src[name])); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			f, err := parser.ParseFile(conf.fset(), name, src[name], conf.ParserMode)
+			if f != nil {
+				imp.keepSource(f, []byte(src[name]))
+				files = append(files, f)
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
 
 	// Preprocess CgoFiles and parse the outputs (sequentially).
+	// The inputs are first checked against the Limits, since
+	// the outputs are parsed by cgo.ProcessFiles.
 	if which == 'g' && bp.CgoFiles != nil {
-		cgofiles, err := cgo.ProcessFiles(bp, conf.fset(), conf.DisplayPath, conf.ParserMode)
-		if err != nil {
+		if err := imp.checkCgoFiles(bp); err != nil {
+			errs = append(errs, err)
+		} else if cgofiles, err := cgo.ProcessFiles(bp, conf.fset(), conf.DisplayPath, conf.ParserMode); err != nil {
 			errs = append(errs, err)
 		} else {
 			files = append(files, cgofiles...)
 		}
 	}
+	if which == 'g' {
+		if extra := conf.ExtraFiles[bp.ImportPath]; extra != nil {
+			files = append(files, extra...)
+		}
+	}
+	imp.logf("parse %q (%c): done in %s (%d errors)", bp.ImportPath, which, time.Since(t0), len(errs))
 
 	return files, errs
 }
@@ -787,6 +2009,12 @@ func (imp *importer) doImport(from *PackageInfo, to string) (*types.Package, err
 
 	bp, err := imp.findPackage(to, from.dir, 0)
 	if err != nil {
+		if imp.conf.IsolateFailures {
+			imp.addFailed(to, err)
+			imp.failedMu.Lock()
+			imp.failedImporters[from] = true
+			imp.failedMu.Unlock()
+		}
 		return nil, err
 	}
 
@@ -804,7 +2032,7 @@ func (imp *importer) doImport(from *PackageInfo, to string) (*types.Package, err
 	if ii == nil {
 		panic("internal error: unexpected import: " + path)
 	}
-	if ii.info != nil {
+	if ii.isComplete() {
 		return ii.info.Pkg, nil
 	}
 
@@ -831,6 +2059,7 @@ func (imp *importer) findPackage(importPath, fromDir string, mode build.ImportMo
 		imp.findpkgMu.Unlock()
 
 		<-v.ready // wait for entry to become ready
+		imp.logf("find %q from %s: cache hit", importPath, fromDir)
 	} else {
 		// Cache miss: this goroutine becomes responsible for
 		// populating the map entry and broadcasting its readiness.
@@ -838,14 +2067,63 @@ func (imp *importer) findPackage(importPath, fromDir string, mode build.ImportMo
 		imp.findpkg[key] = v
 		imp.findpkgMu.Unlock()
 
-		ioLimit <- true
-		v.bp, v.err = imp.conf.FindPackage(imp.conf.build(), importPath, fromDir, mode)
-		<-ioLimit
+		if part := imp.splitParts[importPath]; part != nil {
+			// A part of a split CreatePkgs entry is already parsed.
+			v.bp = &build.Package{
+				ImportPath: importPath,
+				Name:       part.files[0].Name.Name,
+				Dir:        part.dir,
+			}
+		} else if src, err := imp.expand(importPath); err != nil {
+			v.err = err
+		} else if _, ok := imp.conf.SourcePkgs[importPath]; ok || src != nil {
+			// A synthetic package has no directory.
+			v.bp = &build.Package{
+				ImportPath: importPath,
+				Name:       pathpkg.Base(importPath),
+			}
+		} else if info := imp.checked[importPath]; info != nil {
+			// A package checked by a previous run needs no search.
+			v.bp = &build.Package{
+				ImportPath: importPath,
+				Name:       info.Pkg.Name(),
+				Dir:        info.dir,
+			}
+		} else if filename, ok := imp.conf.ExportFiles[importPath]; ok && !imp.initial[importPath] {
+			// Export data needs no search.
+			v.bp = &build.Package{
+				ImportPath: importPath,
+				Name:       pathpkg.Base(importPath),
+				PkgObj:     filename,
+			}
+		} else {
+			ioLimit <- true
+			v.bp, v.err = imp.conf.FindPackage(imp.conf.build(), importPath, fromDir, mode)
+			<-ioLimit
+		}
 
 		if _, ok := v.err.(*build.NoGoError); ok {
 			v.err = nil // empty directory is not an error
 		}
 
+		// A local import of a directory outside the workspace
+		// has no canonical path, so give it a synthetic one,
+		// as 'go build' does.
+		if v.err == nil && v.bp != nil && build.IsLocalImport(v.bp.ImportPath) && v.bp.Dir != "" {
+			bp := *v.bp // copy
+			bp.ImportPath = "_" + filepath.ToSlash(bp.Dir)
+			if !strings.HasPrefix(bp.ImportPath, "_/") {
+				bp.ImportPath = "_/" + bp.ImportPath[1:] // e.g. Windows volume
+			}
+			v.bp = &bp
+		}
+
+		if v.err != nil {
+			imp.logf("find %q from %s: %v", importPath, fromDir, v.err)
+		} else {
+			imp.logf("find %q from %s: found %s in %s", importPath, fromDir, v.bp.ImportPath, v.bp.Dir)
+		}
+
 		close(v.ready) // broadcast ready condition
 	}
 	return v.bp, v.err
@@ -863,8 +2141,16 @@ func (imp *importer) findPackage(importPath, fromDir string, mode build.ImportMo
 func (imp *importer) importAll(fromPath, fromDir string, imports map[string]bool, mode build.ImportMode) (infos []*PackageInfo, errors []importError) {
 	// TODO(adonovan): opt: do the loop in parallel once
 	// findPackage is non-blocking.
-	var pending []*importInfo
+	// Visit the imports in order, so that errors are reported
+	// deterministically.
+	var paths []string
 	for importPath := range imports {
+		paths = append(paths, importPath)
+	}
+	sort.Strings(paths)
+
+	var pending []*importInfo
+	for _, importPath := range paths {
 		bp, err := imp.findPackage(importPath, fromDir, mode)
 		if err != nil {
 			errors = append(errors, importError{
@@ -917,8 +2203,9 @@ func (imp *importer) importAll(fromPath, fromDir string, imports map[string]bool
 	return infos, errors
 }
 
-// findPath returns an arbitrary path from 'from' to 'to' in the import
-// graph, or nil if there was none.
+// findPath returns a path from 'from' to 'to' in the import graph,
+// or nil if there was none.  Of the paths that the graph contains
+// at the time of the call, it returns the first in lexical order.
 func (imp *importer) findPath(from, to string) []string {
 	imp.graphMu.Lock()
 	defer imp.graphMu.Unlock()
@@ -932,7 +2219,12 @@ func (imp *importer) findPath(from, to string) []string {
 			if importPath == to {
 				return stack
 			}
+			var deps []string
 			for x := range imp.graph[importPath] {
+				deps = append(deps, x)
+			}
+			sort.Strings(deps)
+			for _, x := range deps {
 				if p := search(stack, x); p != nil {
 					return p
 				}
@@ -955,7 +2247,10 @@ func (imp *importer) startLoad(bp *build.Package) *importInfo {
 	path := bp.ImportPath
 	imp.importedMu.Lock()
 	ii, ok := imp.imported[path]
-	if !ok {
+	if ok {
+		imp.logf("load %q: cache hit", path)
+	} else {
+		imp.logf("load %q: cache miss", path)
 		ii = &importInfo{path: path, complete: make(chan struct{})}
 		imp.imported[path] = ii
 		go func() {
@@ -971,10 +2266,21 @@ func (imp *importer) startLoad(bp *build.Package) *importInfo {
 // load implements package loading by parsing Go source files
 // located by go/build.
 func (imp *importer) load(bp *build.Package) *PackageInfo {
+	if info := imp.checked[bp.ImportPath]; info != nil {
+		return imp.loadChecked(info)
+	}
+	if imp.fromBinary(bp) {
+		return imp.loadBinary(bp)
+	}
+
 	info := imp.newPackageInfo(bp.ImportPath, bp.Dir)
 	info.Importable = true
-	files, errs := imp.conf.parsePackageFiles(bp, 'g')
+	info.OtherFiles = imp.otherFiles(bp)
+	files, errs := imp.parsePackageFiles(bp, 'g')
 	for _, err := range errs {
+		if _, ok := err.(*os.PathError); ok && imp.conf.IsolateFailures {
+			info.Failed = true // an unreadable file
+		}
 		info.appendError(err)
 	}
 
@@ -987,6 +2293,249 @@ func (imp *importer) load(bp *build.Package) *PackageInfo {
 	return info
 }
 
+// addChecked records the packages of Config.Checked, other than the
+// initial packages, and their dependencies.
+func (imp *importer) addChecked() {
+	var add func(info *PackageInfo)
+	add = func(info *PackageInfo) {
+		path := info.Pkg.Path()
+		if imp.checked[path] != nil || info.Pkg == types.Unsafe {
+			return
+		}
+		imp.checked[path] = info
+		for _, dep := range info.Pkg.Imports() {
+			if seed := imp.conf.Checked[dep.Path()]; seed != nil && seed.Pkg == dep {
+				add(seed)
+			} else {
+				add(&PackageInfo{Pkg: dep, Importable: true})
+			}
+		}
+	}
+	for path, info := range imp.conf.Checked {
+		if !imp.roots[path] {
+			add(info)
+		}
+	}
+}
+
+// loadChecked adds to the program a copy of info, a package checked
+// by a previous run.
+func (imp *importer) loadChecked(info *PackageInfo) *PackageInfo {
+	imp.logf("use %q checked by a previous run", info.Pkg.Path())
+
+	// Its dependencies also come from the previous run.
+	deps := make(map[string]bool)
+	for _, dep := range info.Pkg.Imports() {
+		deps[dep.Path()] = true
+	}
+	imp.importAll("", info.dir, deps, 0)
+
+	// Copy on write: the previous program may still be in use,
+	// so nothing reachable from info may be modified.  The copy
+	// shares its syntax and type information, which are immutable,
+	// but not the slices to which Load may append, nor the index
+	// of files, which finish rebuilds.
+	copy := *info
+	copy.checker = nil
+	copy.errorFunc = nil
+	copy.Files = info.Files[:len(info.Files):len(info.Files)]
+	copy.Errors = info.Errors[:len(info.Errors):len(info.Errors)]
+	copy.Directives = info.Directives[:len(info.Directives):len(info.Directives)]
+	copy.byName = nil
+
+	imp.progMu.Lock()
+	imp.prog.AllPackages[copy.Pkg] = &copy
+	imp.prog.importMap[copy.Pkg.Path()] = copy.Pkg
+	imp.progMu.Unlock()
+
+	imp.binaryMu.Lock()
+	imp.binary[copy.Pkg.Path()] = copy.Pkg
+	imp.binaryMu.Unlock()
+
+	return &copy
+}
+
+// otherFiles returns the value of PackageInfo.OtherFiles for bp.
+func (imp *importer) otherFiles(bp *build.Package) []string {
+	var names []string
+	for _, list := range [][]string{bp.SFiles, bp.CFiles, bp.HFiles, bp.SysoFiles} {
+		for _, name := range list {
+			name = buildutil.JoinPath(imp.conf.build(), bp.Dir, name)
+			if imp.conf.DisplayPath != nil {
+				name = imp.conf.DisplayPath(name)
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fromBinary reports whether package bp should be imported from
+// export data.
+func (imp *importer) fromBinary(bp *build.Package) bool {
+	if bp.ImportPath == "unsafe" {
+		return false
+	}
+	if bp.BinaryOnly {
+		return true // there is no source to load
+	}
+	if imp.initial[bp.ImportPath] {
+		return false
+	}
+	if imp.source(bp.ImportPath) != nil {
+		return false
+	}
+	if _, ok := imp.conf.ExtraFiles[bp.ImportPath]; ok {
+		return false // the extra files need the package's syntax
+	}
+	if _, ok := imp.conf.ExportFiles[bp.ImportPath]; ok {
+		return true
+	}
+	return imp.conf.ImportFromBinary != nil && imp.conf.ImportFromBinary(bp.ImportPath)
+}
+
+// loadBinary implements package loading by reading the export data
+// of a package installed by the compiler.  The resulting PackageInfo
+// has no syntax.  Errors are appended to its Errors field.
+func (imp *importer) loadBinary(bp *build.Package) *PackageInfo {
+	info := &PackageInfo{
+		Importable: true,
+		BinaryOnly: bp.BinaryOnly,
+		OtherFiles: imp.otherFiles(bp),
+		dir:        bp.Dir,
+		errorFunc:  imp.conf.TypeChecker.Error,
+	}
+	pkg, err := imp.importBinary(bp)
+	if err != nil {
+		imp.logf("import %q from export data: %v", bp.ImportPath, err)
+		pkg = types.NewPackage(bp.ImportPath, bp.Name)
+		info.appendError(err)
+	} else {
+		imp.logf("import %q from export data: done", bp.ImportPath)
+	}
+	info.Pkg = pkg
+
+	imp.progMu.Lock()
+	imp.prog.AllPackages[pkg] = info
+	imp.prog.importMap[bp.ImportPath] = pkg
+	imp.fromExportData = append(imp.fromExportData, pkg)
+	imp.progMu.Unlock()
+
+	return info
+}
+
+// importBinary reads and decodes the export data of package bp
+// in the format of the effective build context's compiler.
+func (imp *importer) importBinary(bp *build.Package) (*types.Package, error) {
+	ctxt := imp.conf.build()
+	filename := imp.conf.findObjFile(ctxt, bp)
+	if filename == "" {
+		return nil, fmt.Errorf("can't find export data for %s", bp.ImportPath)
+	}
+	f, err := buildutil.OpenFile(ctxt, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The decoders update the shared map, so they run sequentially.
+	imp.binaryMu.Lock()
+	defer imp.binaryMu.Unlock()
+
+	if pkg := imp.binary[bp.ImportPath]; pkg != nil && pkg.Complete() {
+		return pkg, nil
+	}
+
+	var pkg *types.Package
+	if ctxt.Compiler == "gccgo" {
+		var r io.Reader
+		if r, err = gccgoexportdata.NewReader(f); err == nil {
+			pkg, err = gccgoexportdata.Read(r, imp.conf.fset(), imp.binary, bp.ImportPath)
+		}
+	} else {
+		br := bufio.NewReader(f)
+		var r io.Reader = br
+		if hdr, _ := br.Peek(len("go object")); isObjectFile(hdr) {
+			r, err = gcexportdata.NewReader(r)
+		}
+		if err == nil {
+			pkg, err = gcexportdata.Read(r, imp.conf.fset(), imp.binary, bp.ImportPath)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading export data for %s from %s: %v", bp.ImportPath, filename, err)
+	}
+	return pkg, nil
+}
+
+// isObjectFile reports whether a file beginning with hdr is an object
+// or archive file, as opposed to raw export data.
+func isObjectFile(hdr []byte) bool {
+	return bytes.HasPrefix(hdr, []byte("!<arch>\n")) || bytes.HasPrefix(hdr, []byte("go object"))
+}
+
+// findObjFile returns the name of the object file containing the
+// export data of package bp: the one named by conf.ExportFiles, the
+// first one found in conf.PkgDirs, or else the one in which the
+// compiler of ctxt installs it.  It returns "" if the location is
+// unknown.
+func (conf *Config) findObjFile(ctxt *build.Context, bp *build.Package) string {
+	if filename, ok := conf.ExportFiles[bp.ImportPath]; ok {
+		return filename
+	}
+	for _, dir := range conf.PkgDirs {
+		if filename := objFile(ctxt, dir, bp.ImportPath); buildutil.FileExists(ctxt, filename) {
+			return filename
+		}
+	}
+	if bp.PkgObj != "" {
+		return bp.PkgObj
+	}
+	// go/build doesn't report PkgObj for packages in GOROOT.
+	if bp.PkgTargetRoot != "" {
+		return objFile(ctxt, bp.PkgTargetRoot, bp.ImportPath)
+	}
+	return ""
+}
+
+// objFile returns the name of the object file for the specified
+// package within an installation directory such as
+// $GOPATH/pkg/$GOOS_$GOARCH.
+func objFile(ctxt *build.Context, dir, importPath string) string {
+	if ctxt.Compiler == "gccgo" {
+		d, elem := pathpkg.Split(importPath)
+		return buildutil.JoinPath(ctxt, dir, d+"lib"+elem+".a")
+	}
+	return buildutil.JoinPath(ctxt, dir, importPath+".a")
+}
+
+// recordFile records facts about a file parsed from source src.
+// It is called concurrently by parseFiles.
+func (imp *importer) recordFile(f *ast.File, src []byte) {
+	if constraints := buildConstraints(src); constraints != nil {
+		imp.constraintsMu.Lock()
+		imp.constraints[f] = constraints
+		imp.constraintsMu.Unlock()
+	}
+	if isGeneratedSource(src) {
+		imp.constraintsMu.Lock()
+		imp.generated[f] = true
+		imp.constraintsMu.Unlock()
+	}
+	imp.keepSource(f, src)
+}
+
+// keepSource records the source of a file, if Config.KeepSource.
+// It may be called concurrently.
+func (imp *importer) keepSource(f *ast.File, src []byte) {
+	if imp.prog.sources != nil {
+		imp.constraintsMu.Lock()
+		imp.prog.sources[f] = src
+		imp.constraintsMu.Unlock()
+	}
+}
+
 // addFiles adds and type-checks the specified files to info, loading
 // their dependencies if needed.  The order of files determines the
 // package initialization order.  It may be called multiple times on the
@@ -996,6 +2545,25 @@ func (imp *importer) load(bp *build.Package) *PackageInfo {
 // dependency edges that should be checked for potential cycles.
 //
 func (imp *importer) addFiles(info *PackageInfo, files []*ast.File, cycleCheck bool) {
+	if imp.conf.FilterFiles != nil && info.Pkg != types.Unsafe {
+		files = imp.conf.FilterFiles(info.Pkg.Path(), files)
+	}
+	if imp.conf.MutateAST != nil && info.Pkg != types.Unsafe {
+		if mutated, err := imp.conf.MutateAST(info.Pkg.Path(), files); err != nil {
+			info.appendError(err)
+		} else {
+			files = mutated
+		}
+	}
+	if imp.conf.InstrumentStmt != nil && info.Pkg != types.Unsafe && imp.instrumented(info) {
+		var errs []error
+		info.instrumented = true
+		files, errs = imp.instrument(info.Pkg.Path(), files)
+		for _, err := range errs {
+			info.appendError(err)
+		}
+	}
+
 	// Ensure the dependencies are loaded, in parallel.
 	var fromPath string
 	if cycleCheck {
@@ -1003,12 +2571,15 @@ func (imp *importer) addFiles(info *PackageInfo, files []*ast.File, cycleCheck b
 	}
 	// TODO(adonovan): opt: make the caller do scanImports.
 	// Callers with a build.Package can skip it.
+	imp.checkMainImports(info, files)
 	imp.importAll(fromPath, info.dir, scanImports(files), 0)
 
 	if trace {
 		fmt.Fprintf(os.Stderr, "%s: start %q (%d)\n",
 			time.Since(imp.start), info.Pkg.Path(), len(files))
 	}
+	imp.logf("check %q: start (%d files)", info.Pkg.Path(), len(files))
+	t0 := time.Now()
 
 	// Don't call checker.Files on Unsafe, even with zero files,
 	// because it would mutate the package, which is a global.
@@ -1019,20 +2590,157 @@ func (imp *importer) addFiles(info *PackageInfo, files []*ast.File, cycleCheck b
 	} else {
 		// Ignore the returned (first) error since we
 		// already collect them all in the PackageInfo.
+		// All dependencies are complete, so the checker
+		// won't block while holding a token.
+		if imp.checkLimit != nil {
+			imp.checkLimit <- true
+		}
 		info.checker.Files(files)
-		info.Files = append(info.Files, files...)
+		if imp.checkLimit != nil {
+			<-imp.checkLimit
+		}
+	}
+
+	imp.constraintsMu.Lock()
+	for _, f := range files {
+		if constraints, ok := imp.constraints[f]; ok {
+			if info.Constraints == nil {
+				info.Constraints = make(map[*ast.File][]string)
+			}
+			info.Constraints[f] = constraints
+			delete(imp.constraints, f)
+		}
+		// Files not parsed by the loader are recognized by
+		// their comments, if any.
+		if imp.generated[f] || isGenerated(f) {
+			if info.Generated == nil {
+				info.Generated = make(map[*ast.File]bool)
+			}
+			info.Generated[f] = true
+			delete(imp.generated, f)
+		}
+	}
+	imp.constraintsMu.Unlock()
+	info.checked = append(info.checked, files...)
+
+	// Generated files are type-checked, but otherwise ignored,
+	// if Config.ExcludeGenerated is set.
+	if imp.conf.ExcludeGenerated && info.Generated != nil {
+		var nongen []*ast.File
+		for _, f := range files {
+			if !info.Generated[f] {
+				nongen = append(nongen, f)
+			}
+		}
+		files = nongen
+	}
+	info.Files = append(info.Files, files...)
+
+	if imp.conf.CommentMaps {
+		if info.CommentMaps == nil {
+			info.CommentMaps = make(map[*ast.File]ast.CommentMap)
+		}
+		for _, f := range files {
+			info.CommentMaps[f] = ast.NewCommentMap(imp.conf.fset(), f, f.Comments)
+		}
+	}
+
+	if imp.conf.IndexDirectives {
+		for _, f := range files {
+			info.Directives = append(info.Directives, fileDirectives(f)...)
+		}
+	}
+
+	if imp.prog.refs != nil {
+		imp.indexReferences(info, files)
 	}
 
 	if imp.conf.AfterTypeCheck != nil {
 		imp.conf.AfterTypeCheck(info, files)
 	}
 
+	imp.logf("check %q: done in %s", info.Pkg.Path(), time.Since(t0))
 	if trace {
 		fmt.Fprintf(os.Stderr, "%s: stop %q\n",
 			time.Since(imp.start), info.Pkg.Path())
 	}
 }
 
+// checkMainImports reports an ImportMainError for each import, in
+// files of package info, of a main package in another directory.
+// It consults only the package's build metadata, so it reports the
+// error as each import is resolved, before the package is loaded.
+// The name of a package found without a directory, such as one
+// loaded from export data, is not known until it is loaded, so its
+// imports are not checked.
+func (imp *importer) checkMainImports(info *PackageInfo, files []*ast.File) {
+	for _, f := range files {
+		for _, spec := range f.Imports {
+			path, err := strconv.Unquote(spec.Path.Value)
+			if err != nil || path == "C" {
+				continue
+			}
+			bp, err := imp.findPackage(path, info.dir, 0)
+			if err != nil || bp.Dir == "" || bp.Dir == info.dir {
+				continue
+			}
+			if bp.Name == "main" {
+				info.appendError(&ImportMainError{imp.conf.fset(), spec.Path.Pos(), path})
+			}
+		}
+	}
+}
+
+// indexReferences adds to prog.refs the identifiers of files, which
+// have just been type-checked as part of package info.
+func (imp *importer) indexReferences(info *PackageInfo, files []*ast.File) {
+	type ref struct {
+		obj types.Object
+		id  *ast.Ident
+	}
+	var refs []ref
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok {
+				// An embedded field is both defined and used.
+				if obj := info.Defs[id]; obj != nil {
+					refs = append(refs, ref{obj, id})
+				}
+				if obj := info.Uses[id]; obj != nil {
+					refs = append(refs, ref{obj, id})
+				}
+			}
+			return true
+		})
+	}
+	imp.refsMu.Lock()
+	for _, r := range refs {
+		imp.prog.refs[r.obj] = append(imp.prog.refs[r.obj], r.id)
+	}
+	imp.refsMu.Unlock()
+}
+
+// printError returns the default error handler, which prints each
+// error to stderr.  If physical, type errors are printed with the
+// physical positions of Config.PhysicalPositions.
+func printError(physical bool) func(error) {
+	return func(err error) {
+		if err, ok := err.(types.Error); ok && physical {
+			posn := err.Fset.PositionFor(err.Pos, false)
+			fmt.Fprintf(os.Stderr, "%s: %s\n", posn, err.Msg)
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// logf calls the client's Logf hook, if any.
+func (imp *importer) logf(format string, args ...interface{}) {
+	if imp.conf.Logf != nil {
+		imp.conf.Logf(format, args...)
+	}
+}
+
 func (imp *importer) newPackageInfo(path, dir string) *PackageInfo {
 	var pkg *types.Package
 	if path == "unsafe" {
@@ -9,19 +9,28 @@
 package loader_test
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"go/ast"
 	"go/build"
 	"go/constant"
+	"go/parser"
+	"go/token"
 	"go/types"
+	"io/ioutil"
+	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 
 	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/gcexportdata"
 	"golang.org/x/tools/go/loader"
 )
 
@@ -164,6 +173,478 @@ func TestCreateUnnamedPackage(t *testing.T) {
 	}
 }
 
+func TestCreatePackagePath(t *testing.T) {
+	var conf loader.Config
+	for _, path := range []string{"cmd/a", "cmd/b", ""} {
+		f, err := conf.ParseFile(path+"/main.go", `package main; func main() {}`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf.CreateFromFiles(path, f)
+	}
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := created(prog), "cmd/a cmd/b main"; got != want {
+		t.Errorf("Created = %s, want %s", got, want)
+	}
+	for _, info := range prog.Created {
+		if info.Pkg.Name() != "main" {
+			t.Errorf("package %s has name %s, want main", info, info.Pkg.Name())
+		}
+		if got := prog.Package(info.Pkg.Path()); got != info {
+			t.Errorf("Package(%q) = %v, want %v", info.Pkg.Path(), got, info)
+		}
+	}
+}
+
+func TestCreateFromReader(t *testing.T) {
+	var conf loader.Config
+	if err := conf.CreateFromReader("<stdin>", strings.NewReader(`package p; import "errors"; var E = errors.New("")`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conf.CreateFromReader("<stdin>", strings.NewReader(`package`)); err == nil {
+		t.Errorf("CreateFromReader succeeded on a syntax error")
+	}
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := created(prog), "p"; got != want {
+		t.Errorf("Created = %s, want %s", got, want)
+	}
+}
+
+func TestMixedPackageNames(t *testing.T) {
+	for _, test := range []struct {
+		srcs []string
+		want []string // errors
+		pkg  string
+	}{
+		{
+			srcs: []string{
+				`package q; var Q int`, // not the first file's name, but the majority's
+				`package p; var A = 1`,
+				`package p; var B = A`,
+				"\npackage r",
+			},
+			want: []string{
+				"f0.go:1:9: package q; expected p, as declared by 2 of 4 files",
+				"f3.go:2:9: package r; expected p, as declared by 2 of 4 files",
+			},
+			pkg: "p",
+		},
+		{
+			// A tie goes to the name that appears first.
+			srcs: []string{
+				`package b; var B = 1`,
+				`package a`,
+				`package a`,
+				`package b; var C = B`,
+			},
+			want: []string{
+				"f1.go:1:9: package a; expected b, as declared by 2 of 4 files",
+				"f2.go:1:9: package a; expected b, as declared by 2 of 4 files",
+			},
+			pkg: "b",
+		},
+	} {
+		var conf loader.Config
+		var files []*ast.File
+		for i, src := range test.srcs {
+			f, err := conf.ParseFile(fmt.Sprintf("f%d.go", i), src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, f)
+		}
+		conf.CreateFromFiles("", files...)
+		conf.AllowErrors = true
+		var errs []string
+		conf.TypeChecker.Error = func(err error) { errs = append(errs, err.Error()) }
+		prog, err := conf.Load()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		if got, want := strings.Join(errs, "\n"), strings.Join(test.want, "\n"); got != want {
+			t.Errorf("got errors:\n%s\nwant:\n%s", got, want)
+		}
+		if info := prog.Created[0]; info.Pkg.Path() != test.pkg || len(info.Files) != 2 {
+			t.Errorf("created package %s with %d files, want %s with 2", info, len(info.Files), test.pkg)
+		}
+	}
+}
+
+func TestSplitCreatePkgs(t *testing.T) {
+	// A generator emits sibling packages gen/a and gen/b into out,
+	// which is not where their import paths would be found.
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"out/a": {"a1.go": `package a; import "gen/b"; var _ = b.B`, "a2.go": `package a_test`},
+		"out/b": {"b.go": `package b; const B = 1`},
+	})
+	filenames := []string{"/go/src/out/a/a1.go", "/go/src/out/b/b.go", "/go/src/out/a/a2.go"}
+
+	conf := loader.Config{Build: ctxt, SplitCreatePkgs: true}
+	conf.CreateFromFilenames("gen", filenames...)
+	conf.CreateFromFilenames("main", "/go/src/out/b/b.go")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var got []string
+	for _, info := range prog.Created {
+		got = append(got, fmt.Sprintf("%s:%d", info.Pkg.Path(), len(info.Files)))
+	}
+	if want := "gen/a:1 gen/b:1 gen/a_test:1 main:1"; strings.Join(got, " ") != want {
+		t.Errorf("Created = %s, want %s", got, want)
+	}
+	if imports := prog.Created[0].Pkg.Imports(); len(imports) != 1 || imports[0] != prog.Created[1].Pkg {
+		t.Errorf("gen/a imports %v, want the created package gen/b", imports)
+	}
+
+	// Without splitting, the package clauses conflict.
+	conf = loader.Config{Build: ctxt}
+	conf.CreateFromFilenames("", filenames...)
+	if _, err := conf.Load(); err == nil {
+		t.Errorf("Load succeeded without SplitCreatePkgs")
+	}
+}
+
+func TestSortedPackages(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"c": `package c; import _ "a"`,
+		"b": `package b`,
+		"a": `package a`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("c")
+	conf.Import("b")
+	for _, name := range []string{"z2", "b", "z1"} {
+		f, err := conf.ParseFile(name+".go", `package main`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conf.CreateFromFiles(name[:1], f)
+	}
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	describe := func(infos []*loader.PackageInfo) string {
+		var buf bytes.Buffer
+		for _, info := range infos {
+			fmt.Fprintf(&buf, " %s", info.Pkg.Path())
+			if !info.Importable {
+				fmt.Fprintf(&buf, "(%s)", prog.Fset.File(info.Files[0].Pos()).Name())
+			}
+		}
+		return buf.String()
+	}
+	for i := 0; i < 3; i++ {
+		if got, want := describe(prog.InitialPackages()), " z(z2.go) b(b.go) z(z1.go) b c"; got != want {
+			t.Errorf("InitialPackages =%s, want%s", got, want)
+		}
+		if got, want := describe(prog.SortedPackages()), " a b b(b.go) c z(z2.go) z(z1.go)"; got != want {
+			t.Errorf("SortedPackages =%s, want%s", got, want)
+		}
+	}
+}
+
+func TestPackage(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {"a.go": `package a; import _ "b"`, "a_test.go": `package a_test`},
+		"b": {"b.go": `package b`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.ImportWithTests("a")
+	conf.CreateFromFilenames("b", "/go/src/a/a_test.go")
+	conf.CreateFromFilenames("c", "/go/src/a/a_test.go")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, test := range []struct {
+		path string
+		want *loader.PackageInfo
+	}{
+		{"a", prog.Imported["a"]},                                    // initial
+		{"b", prog.AllPackages[prog.Imported["a"].Pkg.Imports()[0]]}, // dependency
+		{"c", prog.Created[1]},                                       // created
+		{"a_test", prog.Created[2]},                                  // external test
+		{"d", nil},
+	} {
+		if got := prog.Package(test.path); got != test.want {
+			t.Errorf("Package(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+	if prog.Package("b") == prog.Created[0] {
+		t.Errorf("Package(%q) returned the Created package, not the importable one", "b")
+	}
+}
+
+func TestPackageForFile(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {"a.go": `package a; import _ "b"`, "a_test.go": `package a`, "x_test.go": `package a_test`},
+		"b": {"b.go": `package b`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.ImportWithTests("a")
+	conf.CreateFromFilenames("c", "/go/src/b/b.go")
+	conf.CreateFromFilenames("ab", "/go/src/b/b.go") // sorts before b
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, test := range []struct {
+		filename, want string
+	}{
+		{"/go/src/a/a.go", "a"},
+		{"/go/src/a/./a_test.go", "a"},
+		{"/go/src/a/x_test.go", "a_test"},
+		{"/go/src/b/b.go", "b"}, // importable, not created package ab or c
+		{"/go/src/b/c.go", ""},
+	} {
+		info, f := prog.PackageForFile(test.filename)
+		var got string
+		if info != nil {
+			got = info.Pkg.Path()
+			if name := prog.Fset.File(f.Pos()).Name(); filepath.Clean(name) != filepath.Clean(test.filename) {
+				t.Errorf("PackageForFile(%q) returned file %s", test.filename, name)
+			}
+		} else if f != nil {
+			t.Errorf("PackageForFile(%q) returned file but no package", test.filename)
+		}
+		if got != test.want {
+			t.Errorf("PackageForFile(%q) = %q, want %q", test.filename, got, test.want)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {"a.go": `package a`, "a_test.go": `package a`},
+		"b": {"b.go": `package b`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.ImportWithTests("a")
+	conf.CreateFromFilenames("c", "/go/src/b/b.go")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	files := prog.Files()
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, " "); got != "/go/src/a/a.go /go/src/a/a_test.go /go/src/b/b.go" {
+		t.Errorf("Files() has keys %s", got)
+	}
+	for name, f := range files {
+		if _, pf := prog.PackageForFile(name); pf != f {
+			t.Errorf("Files()[%s] disagrees with PackageForFile", name)
+		}
+	}
+
+	a, c := prog.Imported["a"], prog.Created[0]
+	for _, test := range []struct {
+		info     *loader.PackageInfo
+		filename string
+		want     *ast.File
+	}{
+		{a, "/go/src/a/a.go", files["/go/src/a/a.go"]},
+		{a, "/go/src/a/../a/a_test.go", files["/go/src/a/a_test.go"]},
+		{a, "a_test.go", files["/go/src/a/a_test.go"]},
+		{a, "/go/src/b/b.go", nil},
+		{a, "b.go", nil},
+		{c, "/go/src/b/b.go", c.Files[0]}, // not the same syntax as package b
+	} {
+		if got := test.info.File(test.filename); got != test.want {
+			t.Errorf("%s.File(%q) = %p, want %p", test.info, test.filename, got, test.want)
+		}
+	}
+}
+
+func TestInitialMainPackages(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"cmd/a": `package main; func main() {}`,
+		"cmd/b": `package main; var main int`, // not an executable
+		"lib":   `package lib; func main() {}`,
+	})
+	conf := loader.Config{Build: ctxt, AllowErrors: true}
+	conf.TypeChecker.Error = func(error) {}
+	conf.Import("cmd/a")
+	conf.Import("cmd/b")
+	conf.Import("lib")
+	f, err := conf.ParseFile("c.go", `package main; func main() {}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.CreateFromFiles("cmd/c", f)
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var got []string
+	for _, info := range prog.InitialMainPackages() {
+		got = append(got, info.Pkg.Path())
+	}
+	if want := []string{"cmd/c", "cmd/a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InitialMainPackages = %s, want %s", got, want)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {"a.go": `package a`, "x_test.go": `package a_test`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.ImportWithTests("a")
+	conf.CreateFromFilenames("b", "/go/src/a/[a-w]*.go")
+	f, err := conf.ParseFile("c.go", `package c`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.CreateFromFiles("c", f)
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var got []string
+	for _, info := range prog.Created {
+		got = append(got, info.Origin.String())
+	}
+	want := []string{
+		"files /go/src/a/[a-w]*.go (Config.CreatePkgs[0])",
+		"parsed files (Config.CreatePkgs[1])",
+		`external test package of "a"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Origins = %q, want %q", got, want)
+	}
+	if o := prog.Imported["a"].Origin; o != nil {
+		t.Errorf("imported package has Origin %v", o)
+	}
+}
+
+func TestCommentMaps(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import _ "b"
+
+// F is a function.
+func F() {}`,
+		"b": `package b
+
+// V is a variable.
+var V int`,
+	})
+	conf := loader.Config{Build: ctxt, ParserMode: parser.ParseComments, CommentMaps: true}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for path, want := range map[string]string{
+		"a": "F is a function.\n",
+		"b": "V is a variable.\n",
+	} {
+		info := prog.Package(path)
+		f := info.Files[0]
+		cmap := info.CommentMaps[f]
+		decl := f.Decls[len(f.Decls)-1]
+		if groups := cmap[decl]; len(groups) != 1 || groups[0].Text() != want {
+			t.Errorf("%s: comments of last declaration = %v, want %q", path, groups, want)
+		}
+	}
+
+	// The maps are built only on request.
+	conf = loader.Config{Build: ctxt, ParserMode: parser.ParseComments}
+	conf.Import("a")
+	prog, err = conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if m := prog.Imported["a"].CommentMaps; m != nil {
+		t.Errorf("CommentMaps = %v, want nil", m)
+	}
+}
+
+func TestLogf(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import (_ "b"; _ "c")`,
+		"b": `package b; import _ "c"`,
+		"c": `package c`,
+	})
+	var (
+		mu   sync.Mutex
+		msgs []string
+	)
+	conf := loader.Config{
+		Build: ctxt,
+		Logf: func(format string, args ...interface{}) {
+			mu.Lock()
+			msgs = append(msgs, fmt.Sprintf(format, args...))
+			mu.Unlock()
+		},
+	}
+	conf.Import("a")
+	if _, err := conf.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	log := strings.Join(msgs, "\n")
+	for _, want := range []string{
+		`find "c" from /go/src/a: found c in /go/src/c`,
+		`load "c": cache miss`,
+		`load "c": cache hit`,
+		`parse "b" (g): start (1 files)`,
+		`check "a": done in`,
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log does not contain %q:\n%s", want, log)
+		}
+	}
+}
+
+func TestPathEnclosingInterval(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import _ "b"; func A() { var x int; _ = x }`,
+		"b": `package b; const B = 1`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	f, err := conf.ParseFile("c.go", `package c; var C = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.CreateFromFiles("c", f)
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, info := range prog.AllPackages {
+		for _, f := range info.Files {
+			// Find the innermost node at each identifier.
+			ast.Inspect(f, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if !ok {
+					return true
+				}
+				pkg, path, exact := prog.PathEnclosingInterval(id.Pos(), id.End())
+				if pkg != info || len(path) == 0 || path[0] != id || !exact {
+					t.Errorf("PathEnclosingInterval(%s) = %v, %v, %t; want %s, [%s ...], true",
+						prog.Fset.Position(id.Pos()), pkg, path, exact, info, id.Name)
+				}
+				return true
+			})
+		}
+	}
+	if pkg, path, _ := prog.PathEnclosingInterval(token.NoPos, token.NoPos); pkg != nil || path != nil {
+		t.Errorf("PathEnclosingInterval(NoPos) = %v, %v; want nil", pkg, path)
+	}
+}
+
 func TestLoad_MissingFileInCreatedPackage(t *testing.T) {
 	var conf loader.Config
 	conf.CreateFromFilenames("", "missing.go")
@@ -271,136 +752,1188 @@ func TestLoad_FromImports_Success(t *testing.T) {
 	if prog == nil {
 		t.Fatalf("Load returned a nil Program")
 	}
-	if got, want := created(prog), "errors_test fmt_test"; got != want {
-		t.Errorf("Created = %q, want %s", got, want)
+	if got, want := created(prog), "errors_test fmt_test"; got != want {
+		t.Errorf("Created = %q, want %s", got, want)
+	}
+	if got, want := imported(prog), "errors fmt"; got != want {
+		t.Errorf("Imported = %s, want %s", got, want)
+	}
+	// Check set of transitive packages.
+	// There are >30 and the set may grow over time, so only check a few.
+	want := map[string]bool{
+		"strings": true,
+		"time":    true,
+		"runtime": true,
+		"testing": true,
+		"unicode": true,
+	}
+	for _, path := range all(prog) {
+		delete(want, path)
+	}
+	if len(want) > 0 {
+		t.Errorf("AllPackages is missing these keys: %q", keys(want))
+	}
+}
+
+func TestLoad_MissingIndirectImport(t *testing.T) {
+	pkgs := map[string]string{
+		"a": `package a; import _ "b"`,
+		"b": `package b; import _ "c"`,
+	}
+	conf := loader.Config{Build: fakeContext(pkgs)}
+	conf.Import("a")
+
+	const wantErr = "couldn't load packages due to errors: b"
+
+	prog, err := conf.Load()
+	if err == nil {
+		t.Errorf("Load succeeded unexpectedly, want %q", wantErr)
+	} else if err.Error() != wantErr {
+		t.Errorf("Load failed with wrong error %q, want %q", err, wantErr)
+	}
+	if prog != nil {
+		t.Errorf("Load unexpectedly returned a Program")
+	}
+}
+
+func TestLoad_BadDependency_AllowErrors(t *testing.T) {
+	for _, test := range []struct {
+		descr    string
+		pkgs     map[string]string
+		wantPkgs string
+	}{
+
+		{
+			descr: "missing dependency",
+			pkgs: map[string]string{
+				"a": `package a; import _ "b"`,
+				"b": `package b; import _ "c"`,
+			},
+			wantPkgs: "a b",
+		},
+		{
+			descr: "bad package decl in dependency",
+			pkgs: map[string]string{
+				"a": `package a; import _ "b"`,
+				"b": `package b; import _ "c"`,
+				"c": `package`,
+			},
+			wantPkgs: "a b",
+		},
+		{
+			descr: "parse error in dependency",
+			pkgs: map[string]string{
+				"a": `package a; import _ "b"`,
+				"b": `package b; import _ "c"`,
+				"c": `package c; var x = `,
+			},
+			wantPkgs: "a b c",
+		},
+	} {
+		conf := loader.Config{
+			AllowErrors: true,
+			Build:       fakeContext(test.pkgs),
+		}
+		conf.Import("a")
+
+		prog, err := conf.Load()
+		if err != nil {
+			t.Errorf("%s: Load failed unexpectedly: %v", test.descr, err)
+		}
+		if prog == nil {
+			t.Fatalf("%s: Load returned a nil Program", test.descr)
+		}
+
+		if got, want := imported(prog), "a"; got != want {
+			t.Errorf("%s: Imported = %s, want %s", test.descr, got, want)
+		}
+		if got := all(prog); strings.Join(got, " ") != test.wantPkgs {
+			t.Errorf("%s: AllPackages = %s, want %s", test.descr, got, test.wantPkgs)
+		}
+	}
+}
+
+func TestCwd(t *testing.T) {
+	ctxt := fakeContext(map[string]string{"one/two/three": `package three`})
+	for _, test := range []struct {
+		cwd, arg, want string
+	}{
+		{cwd: "/go/src/one", arg: "./two/three", want: "one/two/three"},
+		{cwd: "/go/src/one", arg: "../one/two/three", want: "one/two/three"},
+		{cwd: "/go/src/one", arg: "one/two/three", want: "one/two/three"},
+		{cwd: "/go/src/one/two/three", arg: ".", want: "one/two/three"},
+		{cwd: "/go/src/one", arg: "two/three", want: ""},
+		{cwd: "/go/src/one", arg: "/go/src/one/two/three", want: "one/two/three"},
+		{cwd: "/go/src/one/two/three", arg: "/go/src/one/two/three", want: "one/two/three"},
+	} {
+		conf := loader.Config{
+			Cwd:   test.cwd,
+			Build: ctxt,
+		}
+		conf.Import(test.arg)
+
+		var got string
+		prog, err := conf.Load()
+		if prog != nil {
+			got = imported(prog)
+		}
+		if got != test.want {
+			t.Errorf("Load(%s) from %s: Imported = %s, want %s",
+				test.arg, test.cwd, got, test.want)
+			if err != nil {
+				t.Errorf("Load failed: %v", err)
+			}
+		}
+	}
+}
+
+func TestDirOutsideWorkspace(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "foo")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "x.go"), []byte(`package foo`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "_" + filepath.ToSlash(dir)
+	for _, arg := range []string{dir, "./foo"} {
+		conf := loader.Config{Cwd: tmp}
+		if _, err := conf.FromArgs([]string{arg}, false); err != nil {
+			t.Fatal(err)
+		}
+		prog, err := conf.Load()
+		if err != nil {
+			t.Errorf("Load(%s) failed: %v", arg, err)
+			continue
+		}
+		if got := imported(prog); got != want {
+			t.Errorf("Load(%s): Imported = %s, want %s", arg, got, want)
+		}
+	}
+}
+
+func TestGOPATHOverride(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	dir := filepath.Join(tmp, "src", "hermetic")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, src := range map[string]string{
+		"x.go":     `package hermetic`,
+		"tag.go":   "// +build leak\n\npackage hermetic",
+		"cgo.go":   `package hermetic; import "C"`,
+		"other.go": "// +build !" + runtime.GOOS + "\n\npackage hermetic",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The settings of build.Default, which come from the
+	// environment, do not apply.
+	saved := build.Default
+	defer func() { build.Default = saved }()
+	build.Default.BuildTags = []string{"leak"}
+	build.Default.CgoEnabled = true
+
+	// The package is visible only through the overridden GOPATH.
+	conf := loader.Config{GOPATH: tmp}
+	conf.Import("hermetic")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := imported(prog), "hermetic"; got != want {
+		t.Errorf("Imported = %s, want %s", got, want)
+	}
+	var files []string
+	for _, f := range prog.Imported["hermetic"].Files {
+		files = append(files, filepath.Base(prog.Fset.File(f.Pos()).Name()))
+	}
+	if got, want := strings.Join(files, " "), "x.go"; got != want {
+		t.Errorf("files = %s, want %s", got, want)
+	}
+
+	// Nonexistent roots are rejected before loading.
+	for _, conf := range []loader.Config{
+		{GOPATH: filepath.Join(tmp, "nonesuch")},
+		{GOROOT: filepath.Join(tmp, "nonesuch")},
+	} {
+		conf.Import("hermetic")
+		if _, err := conf.Load(); err == nil || !strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("Load with GOROOT=%q GOPATH=%q: got error %v, want 'does not exist'",
+				conf.GOROOT, conf.GOPATH, err)
+		}
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	tmp, err := ioutil.TempDir("", "loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	src := filepath.Join(tmp, "gopath", "src")
+	if err := os.MkdirAll(filepath.Join(src, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(tmp, "goroot"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "a", "x.go"), []byte(`package a`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range [][2]string{
+		{"gopath/src", "gopath/src/a/loop"}, // a cycle
+		{"gopath/src/a", "gopath/src/b"},    // an alias for package a
+		{"gopath", "gopath/gopath2"},        // an alias for the workspace
+	} {
+		if err := os.Symlink(filepath.Join(tmp, link[0]), filepath.Join(tmp, link[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Use a file system that follows links to directories.
+	ctxt := build.Default
+	ctxt.GOROOT = filepath.Join(tmp, "goroot")
+	ctxt.GOPATH = filepath.Join(tmp, "gopath") + string(filepath.ListSeparator) + filepath.Join(tmp, "gopath", "gopath2")
+	ctxt.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		fis, err := ioutil.ReadDir(dir)
+		for i, fi := range fis {
+			if fi.Mode()&os.ModeSymlink != 0 {
+				if target, err := os.Stat(filepath.Join(dir, fi.Name())); err == nil {
+					fis[i] = target
+				}
+			}
+		}
+		return fis, err
+	}
+
+	conf := loader.Config{Build: &ctxt, Cwd: src}
+	pkgs, err := conf.ImportPattern("./...", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(pkgs, " "), "a"; got != want {
+		t.Errorf("ImportPattern(./...) = %s, want %s", got, want)
+	}
+}
+
+// TestRootPattern checks that "./..." in a workspace root matches only
+// the packages of that root.
+func TestRootPattern(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "loader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for _, dir := range []string{"goroot/src/fmt", "gopath/src/a", "gopath/src/a/b"} {
+		dir = filepath.Join(tmp, filepath.FromSlash(dir))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "x.go"), []byte("package "+filepath.Base(dir)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctxt := build.Default
+	ctxt.GOROOT = filepath.Join(tmp, "goroot")
+	ctxt.GOPATH = filepath.Join(tmp, "gopath")
+	for _, test := range []struct {
+		cwd, arg, want, removed string
+	}{
+		{"gopath/src", "./...", "a a/b", "a"},
+		{"gopath/src", "./a/...", "a a/b", "a"},
+		{"goroot/src", "./...", "fmt", "fmt"},
+	} {
+		conf := loader.Config{Build: &ctxt, Cwd: filepath.Join(tmp, filepath.FromSlash(test.cwd))}
+		pkgs, err := conf.ImportPattern(test.arg, false)
+		if err != nil {
+			t.Errorf("ImportPattern(%s) from %s failed: %v", test.arg, test.cwd, err)
+		} else if got := strings.Join(pkgs, " "); got != test.want {
+			t.Errorf("ImportPattern(%s) from %s = %s, want %s", test.arg, test.cwd, got, test.want)
+		}
+
+		// Exclusion is confined to the root too.
+		conf = loader.Config{Build: &ctxt, Cwd: conf.Cwd}
+		conf.ImportPkgs = map[string]bool{"fmt": false, "a": false}
+		removed, err := conf.ImportPattern("-"+test.arg, false)
+		if err != nil {
+			t.Errorf("ImportPattern(-%s) from %s failed: %v", test.arg, test.cwd, err)
+		} else if got := strings.Join(removed, " "); got != test.removed {
+			t.Errorf("ImportPattern(-%s) from %s removed %s, want %s", test.arg, test.cwd, got, test.removed)
+		}
+	}
+}
+
+func TestImportFromBinary(t *testing.T) {
+	pkgs := map[string]map[string]string{
+		"p": {"x.go": `package p; func F() int { return 0 }`},
+		"q": {"x.go": `package q; import "p"; var X = p.F()`},
+	}
+
+	// Load p from source and install its export data
+	// where the gc compiler would put it.
+	ctxt := buildutil.FakeContext(pkgs)
+	conf := loader.Config{Build: ctxt}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("go object " + ctxt.GOOS + " " + ctxt.GOARCH + "\n$$B\n")
+	if err := gcexportdata.Write(&buf, prog.Fset, prog.Imported["p"].Pkg); err != nil {
+		t.Fatal(err)
+	}
+	pkgs["/go/pkg/"+ctxt.GOOS+"_"+ctxt.GOARCH] = map[string]string{"p.a": buf.String()}
+	ctxt = buildutil.FakeContext(pkgs)
+
+	for _, initial := range []string{"p", "q"} {
+		conf := loader.Config{
+			Build:            ctxt,
+			ImportFromBinary: func(path string) bool { return path == "p" },
+		}
+		conf.Import(initial)
+		prog, err := conf.Load()
+		if err != nil {
+			t.Fatalf("Load(%s) failed: %v", initial, err)
+		}
+		p := prog.Package("p")
+		if p.Pkg.Scope().Lookup("F") == nil {
+			t.Errorf("Load(%s): p.F not found", initial)
+		}
+		// Initial packages are always loaded from source.
+		if got, want := len(p.Files) > 0, initial == "p"; got != want {
+			t.Errorf("Load(%s): p has syntax = %t, want %t", initial, got, want)
+		}
+	}
+
+	// Object files in PkgDirs take precedence over installed ones.
+	pkgs["/objs"] = pkgs["/go/pkg/"+ctxt.GOOS+"_"+ctxt.GOARCH]
+	pkgs["/go/pkg/"+ctxt.GOOS+"_"+ctxt.GOARCH] = map[string]string{"p.a": "garbage"}
+	conf = loader.Config{
+		Build:            buildutil.FakeContext(pkgs),
+		ImportFromBinary: func(path string) bool { return path == "p" },
+		PkgDirs:          []string{"/objs"},
+	}
+	conf.Import("q")
+	if _, err := conf.Load(); err != nil {
+		t.Errorf("Load with PkgDirs failed: %v", err)
+	}
+}
+
+func TestBinaryOnly(t *testing.T) {
+	// Load p from source and install its export data.
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"p": {"x.go": `package p; func F() int { return 0 }`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("go object " + ctxt.GOOS + " " + ctxt.GOARCH + "\n$$B\n")
+	if err := gcexportdata.Write(&buf, prog.Fset, prog.Imported["p"].Pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replace its source by a binary-only stub.
+	ctxt = buildutil.FakeContext(map[string]map[string]string{
+		"p": {
+			"x.go":      "//go:binary-only-package\n\npackage p",
+			"x_test.go": `package p; var _ = F`,
+		},
+		"q": {"x.go": `package q; import "p"; var X = p.F()`},
+		"/go/pkg/" + ctxt.GOOS + "_" + ctxt.GOARCH: {"p.a": buf.String()},
+	})
+	for _, initial := range []string{"p", "q"} {
+		conf := loader.Config{Build: ctxt}
+		conf.ImportWithTests(initial)
+		prog, err := conf.Load()
+		if err != nil {
+			t.Fatalf("Load(%s) failed: %v", initial, err)
+		}
+		p := prog.Package("p")
+		if !p.BinaryOnly || p.Files != nil || p.Pkg.Scope().Lookup("F") == nil {
+			t.Errorf("Load(%s): p was not imported from export data: %+v", initial, p)
+		}
+	}
+}
+
+func TestOtherFiles(t *testing.T) {
+	conf := loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {
+				"x.go":   `package p; func F() int`,
+				"f.s":    `TEXT ·F(SB),$0`,
+				"h.h":    ``,
+				"x.syso": ``,
+				"y.txt":  ``,
+			},
+		}),
+		DisplayPath: func(path string) string { return strings.TrimPrefix(path, "/go/src/") },
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := strings.Join(prog.Package("p").OtherFiles, " "), "p/f.s p/h.h p/x.syso"; got != want {
+		t.Errorf("OtherFiles = %s, want %s", got, want)
+	}
+}
+
+func TestExportFiles(t *testing.T) {
+	// Write the export data of p, in raw form and in an object file.
+	conf := loader.Config{Build: buildutil.FakeContext(map[string]map[string]string{
+		"p": {"x.go": `package p; func F() int { return 0 }`},
+	})}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var raw bytes.Buffer
+	if err := prog.WriteExportData(&raw, prog.Imported["p"]); err != nil {
+		t.Fatal(err)
+	}
+	obj := "go object linux amd64\n$$B\n" + raw.String()
+
+	// The source of p is absent; only the export data is known.
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"q":     {"x.go": `package q; import "p"; var X = p.F()`},
+		"/objs": {"p.x": raw.String(), "p.a": obj},
+	})
+	for _, filename := range []string{"/objs/p.x", "/objs/p.a"} {
+		conf := loader.Config{
+			Build:       ctxt,
+			ExportFiles: map[string]string{"p": filename},
+		}
+		conf.Import("q")
+		prog, err := conf.Load()
+		if err != nil {
+			t.Fatalf("Load with ExportFiles[p]=%s failed: %v", filename, err)
+		}
+		if p := prog.Package("p"); p == nil || p.Files != nil || p.Pkg.Scope().Lookup("F") == nil {
+			t.Errorf("Load with ExportFiles[p]=%s: bad package p: %v", filename, p)
+		}
+	}
+
+	// Initial packages are loaded from source, so p cannot be.
+	conf = loader.Config{
+		Build:       ctxt,
+		ExportFiles: map[string]string{"p": "/objs/p.x"},
+	}
+	conf.Import("p")
+	if _, err := conf.Load(); err == nil {
+		t.Errorf("Load of initial package in ExportFiles succeeded without source")
+	}
+}
+
+func TestSharedState(t *testing.T) {
+	// Write the export data of p, which depends on r.
+	conf := loader.Config{Build: buildutil.FakeContext(map[string]map[string]string{
+		"p": {"x.go": `package p; import "r"; func F() r.T { return 0 }`},
+		"r": {"x.go": `package r; type T int`},
+	})}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var raw bytes.Buffer
+	if err := prog.WriteExportData(&raw, prog.Imported["p"]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load q1 and q2 concurrently, sharing the import of p.
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"q1":    {"x.go": `package q1; import "p"; var X = p.F()`},
+		"q2":    {"x.go": `package q2; import "p"; var Y = p.F()`},
+		"/objs": {"p.x": raw.String()},
+	})
+	shared := loader.NewSharedState()
+	progs := make([]*loader.Program, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range progs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conf := loader.Config{
+				Build:       ctxt,
+				ExportFiles: map[string]string{"p": "/objs/p.x"},
+				Shared:      shared,
+			}
+			conf.Import(fmt.Sprintf("q%d", i+1))
+			progs[i], errs[i] = conf.Load()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, prog := range progs {
+		if prog.Fset != shared.FileSet() {
+			t.Errorf("program %d does not use the shared FileSet", i)
+		}
+		if prog.Package("p").Pkg != progs[0].Package("p").Pkg {
+			t.Errorf("program %d has its own p", i)
+		}
+		if prog.Package("r") == nil {
+			t.Errorf("program %d lacks r, a dependency of p", i)
+		}
+		if prog.Package(fmt.Sprintf("q%d", 2-i)) != nil {
+			t.Errorf("program %d has a package of the other", i)
+		}
+	}
+
+	// The FileSet must be that of the shared state.
+	conf = loader.Config{Build: ctxt, Fset: token.NewFileSet(), Shared: shared}
+	conf.Import("q1")
+	if _, err := conf.Load(); err == nil {
+		t.Errorf("Load with another FileSet succeeded")
+	}
+
+	// Checked packages must not leak into the shared state.
+	conf = loader.Config{Build: ctxt, Shared: shared, Checked: map[string]*loader.PackageInfo{"p": progs[0].Package("p")}}
+	conf.Import("q1")
+	if _, err := conf.Load(); err == nil {
+		t.Errorf("Load with Checked and Shared succeeded")
+	}
+}
+
+func TestUseAllFiles(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"p": {
+			"a.go":         "package p; const A = B",
+			"b_windows.go": "// +build windows\n\npackage p; const B = 1",
+			"c.go":         "// Copyright\n\n// +build ignore\n// +build !windows,!linux\n\npackage p",
+			"d.go":         "//go:build linux && !cgo\n// +build linux,!cgo\n\npackage p",
+			"e.go":         "// +build plan9\npackage p // no blank line",
+			"f.go":         "/* block */\n//go:build darwin\n\npackage p",
+		},
+	})
+	ctxt.UseAllFiles = true
+	conf := loader.Config{Build: ctxt}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	info := prog.Imported["p"]
+	if got := len(info.Files); got != 6 {
+		t.Errorf("got %d files, want 6", got)
+	}
+	got := make(map[string][]string)
+	for f, constraints := range info.Constraints {
+		got[filepath.Base(prog.Fset.File(f.Pos()).Name())] = constraints
+	}
+	want := map[string][]string{
+		"b_windows.go": {"windows"},
+		"c.go":         {"ignore", "!windows,!linux"},
+		"d.go":         {"linux && !cgo"},
+		"f.go":         {"darwin"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Constraints = %v, want %v", got, want)
+	}
+}
+
+func TestChecked(t *testing.T) {
+	// Load q and its dependency r.
+	conf1 := loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"q": {"q.go": `package q; import "r"; func F() r.T { return 0 }`},
+			"r": {"r.go": `package r; type T int`},
+		}),
+	}
+	conf1.Import("q")
+	prog1, err := conf1.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Load p, which imports q and r, using q as checked by the
+	// previous run, although its sources are now absent.
+	conf2 := loader.Config{
+		Fset: prog1.Fset,
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {"p.go": `package p; import ("q"; "r"); var X r.T = q.F()`},
+		}),
+		Checked: map[string]*loader.PackageInfo{"q": prog1.Package("q")},
+	}
+	conf2.Import("p")
+	prog2, err := conf2.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"q", "r"} {
+		info := prog2.Package(path)
+		if info == nil {
+			t.Errorf("package %s is missing", path)
+			continue
+		}
+		if info.Pkg != prog1.Package(path).Pkg {
+			t.Errorf("package %s was not taken from the previous run", path)
+		}
+	}
+	if info := prog2.Package("q"); info != nil && len(info.Files) != 1 {
+		t.Errorf("package q has %d files, want 1", len(info.Files))
+	}
+	if errs := prog2.Package("p").Errors; errs != nil {
+		t.Errorf("package p has errors: %v", errs)
+	}
+}
+
+// TestCheckedSnapshot checks that a Program remains usable, without
+// change, while its packages are reused by a later Load.
+// It is most useful with -race.
+func TestCheckedSnapshot(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"p": {"p.go": `package p; import "q"; var X = q.Y`},
+		"q": {"q.go": `package q; var Y int`},
+	})
+	conf1 := loader.Config{Build: ctxt}
+	conf1.Import("p")
+	old, err := conf1.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldQ := old.Package("q")
+	oldFiles := len(oldQ.Files)
+
+	// Query the old program while reloading p.
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			if info, _ := old.PackageForFile("/go/src/q/q.go"); info != oldQ {
+				t.Errorf("old PackageForFile(q.go) = %v", info)
+				return
+			}
+			if oldQ.File("q.go") == nil {
+				t.Errorf("old q.File(q.go) = nil")
+				return
+			}
+		}
+	}()
+	conf2 := loader.Config{
+		Build:   ctxt,
+		Fset:    old.Fset,
+		Checked: map[string]*loader.PackageInfo{"q": oldQ},
+	}
+	conf2.Import("p")
+	prog, err := conf2.Load()
+	<-done
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The new program has its own PackageInfo for q.
+	q := prog.Package("q")
+	if q == oldQ || q.Pkg != oldQ.Pkg {
+		t.Errorf("new program shares the PackageInfo of q, or not its package")
+	}
+	if old.Package("q") != oldQ || len(oldQ.Files) != oldFiles {
+		t.Errorf("old program was modified")
+	}
+	if q.File("q.go") == nil {
+		t.Errorf("new q.File(q.go) = nil")
+	}
+}
+
+func TestPreprocess(t *testing.T) {
+	var errs []error
+	conf := loader.Config{
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(err error) { errs = append(errs, err) }},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {"p.go": `package p
+
+#if DEBUG
+const debug = true
+#endif
+
+var x int = "s"
+`},
+		}),
+		// Remove the preprocessor lines.
+		Preprocess: func(filename string, src []byte) ([]byte, []int, error) {
+			var out []byte
+			var lines []int
+			for i, line := range strings.SplitAfter(string(src), "\n") {
+				if !strings.HasPrefix(line, "#") {
+					out = append(out, line...)
+					lines = append(lines, i+1)
+				}
+			}
+			return out, lines, nil
+		},
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj := prog.Package("p").Pkg.Scope().Lookup("debug"); obj == nil {
+		t.Errorf("const debug is not declared")
+	}
+	if len(errs) != 1 {
+		t.Fatalf("got errors %v, want 1", errs)
+	}
+	posn := prog.Position(errs[0].(types.Error).Pos)
+	if posn.Filename != "/go/src/p/p.go" || posn.Line != 7 {
+		t.Errorf("error %v at %s, want p.go:7", errs[0], posn)
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	for _, exclude := range []bool{false, true} {
+		conf := loader.Config{
+			Build: buildutil.FakeContext(map[string]map[string]string{
+				"p": {
+					"a.go": `package p; type T int; var S = T(0).String()`,
+					"t_string.go": `// Code generated by "stringer -type T"; DO NOT EDIT.
+
+package p
+
+func (T) String() string { return "" }`,
+				},
+			}),
+			ExcludeGenerated: exclude,
+		}
+		conf.Import("p")
+		prog, err := conf.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		info := prog.Package("p")
+		var files, generated []string
+		for _, f := range info.Files {
+			files = append(files, filepath.Base(prog.Fset.File(f.Pos()).Name()))
+		}
+		for f := range info.Generated {
+			generated = append(generated, filepath.Base(prog.Fset.File(f.Pos()).Name()))
+		}
+		want := "a.go t_string.go"
+		if exclude {
+			want = "a.go"
+		}
+		if got := strings.Join(files, " "); got != want {
+			t.Errorf("ExcludeGenerated=%t: files = %s, want %s", exclude, got, want)
+		}
+		if got := strings.Join(generated, " "); got != "t_string.go" {
+			t.Errorf("ExcludeGenerated=%t: generated files = %s, want t_string.go", exclude, got)
+		}
+	}
+}
+
+func TestInstrumentStmt(t *testing.T) {
+	var errs []error
+	conf := loader.Config{
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(err error) { errs = append(errs, err) }},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {"p.go": `package p
+
+func f() {
+	a := 1
+	if a > 0 {
+		a = "s"
+	}
+}`},
+		}),
+		// Precede each statement by a call to println.
+		InstrumentStmt: func(path string, stmt ast.Stmt) []ast.Stmt {
+			call := &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent("println")}}
+			return []ast.Stmt{call, stmt}
+		},
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	info := prog.Package("p")
+	ast.Inspect(info.Files[0], func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpr); ok && info.Uses[call.Fun.(*ast.Ident)] == types.Universe.Lookup("println") {
+			calls++
+		}
+		return true
+	})
+	if calls != 3 {
+		t.Errorf("got %d calls to println, want 3", calls)
+	}
+
+	// The error is reported at its position in the original file.
+	if len(errs) != 1 {
+		t.Fatalf("got errors %v, want 1", errs)
+	}
+	terr := errs[0].(types.Error)
+	physical, logical := prog.Positions(terr.Pos)
+	if logical.Filename != "/go/src/p/p.go" || logical.Line != 6 {
+		t.Errorf("error %v at %s, want p.go:6", terr, logical)
+	}
+	if physical.Line == logical.Line {
+		t.Errorf("error %v at instrumented line %d, want another", terr, physical.Line)
+	}
+}
+
+func TestCreateFromSource(t *testing.T) {
+	conf := loader.Config{
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"db": {"db.go": `package db; func Query() string { return "real" }`},
+		}),
+	}
+	// The mock replaces the package db of the workspace.
+	conf.CreateFromSource("db", map[string]string{
+		"mock.go": `package db; func Query() string { return "mock" }`,
+	})
+	conf.CreateFromSource("example.com/app", map[string]string{
+		"b.go": `package app; var B = db.Query()`,
+		"a.go": `package app; import "db"; var A = db.Query()`,
+		"c.go": `package app; import "db"; var C = db.Query()`,
+	})
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := prog.Package("example.com/app")
+	if app == nil || prog.Imported["example.com/app"] != app {
+		t.Fatalf("example.com/app is not an initial package")
+	}
+	var names []string
+	for _, f := range app.Files {
+		names = append(names, prog.Fset.File(f.Pos()).Name())
+	}
+	if got, want := strings.Join(names, " "), "a.go b.go c.go"; got != want {
+		t.Errorf("files of example.com/app = %s, want %s", got, want)
+	}
+	// b.go does not import db.
+	if len(app.Errors) != 1 || !hasError(app.Errors, "undefined: db") {
+		t.Errorf("errors of example.com/app = %v, want undefined db", app.Errors)
+	}
+	db := prog.Package("db")
+	if len(db.Files) != 1 || prog.Fset.File(db.Files[0].Pos()).Name() != "mock.go" {
+		t.Errorf("package db was not loaded from the mock")
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	var calls int32
+	conf := loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"list": {"list.go": `package list
+
+type T int // placeholder
+
+type List []T
+
+func (l List) First() T { return l[0] }`},
+			"p": {"p.go": `package p; import "list/of/string"; var X string = list.List{"a"}.First()`},
+			"q": {"q.go": `package q; import "list/of/string"; var Y = list.List{}`},
+		}),
+		// Expand "list/of/E" by replacing T with E.
+		ExpandTemplate: func(ctxt *build.Context, path string) (map[string]string, error) {
+			if !strings.HasPrefix(path, "list/of/") {
+				return nil, nil
+			}
+			atomic.AddInt32(&calls, 1)
+			rc, err := buildutil.OpenFile(ctxt, "/go/src/list/list.go")
+			if err != nil {
+				return nil, err
+			}
+			defer rc.Close()
+			src, err := ioutil.ReadAll(rc)
+			if err != nil {
+				return nil, err
+			}
+			elem := strings.TrimPrefix(path, "list/of/")
+			expanded := strings.Replace(string(src), "type T int", "type T = "+elem, 1)
+			return map[string]string{"list.go": expanded}, nil
+		},
+	}
+	conf.Import("p")
+	conf.Import("q")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prog.Package("list/of/string") == nil {
+		t.Fatal("no package list/of/string")
+	}
+	if prog.Package("list") != nil {
+		t.Errorf("the template package was loaded")
+	}
+	if calls != 1 {
+		t.Errorf("ExpandTemplate called %d times for list/of/string, want 1", calls)
+	}
+}
+
+func TestExtraFiles(t *testing.T) {
+	conf := loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {"p.go": `package p; import "q"; var X = q.Secret()`},
+			"q": {"q.go": `package q; func secret() int { return 1 }`},
+		}),
+	}
+	// Add an export shim to the dependency q.
+	if err := conf.AddSource("q", "/go/src/q/shim.go", `package q; func Secret() int { return secret() }`); err != nil {
+		t.Fatal(err)
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"p", "q"} {
+		if info := prog.Package(path); len(info.Errors) > 0 {
+			t.Errorf("package %s has errors: %v", path, info.Errors)
+		}
+	}
+	var names []string
+	for _, f := range prog.Package("q").Files {
+		names = append(names, filepath.Base(prog.Fset.File(f.Pos()).Name()))
+	}
+	if got, want := strings.Join(names, " "), "q.go shim.go"; got != want {
+		t.Errorf("files of q = %s, want %s", got, want)
+	}
+}
+
+func TestFilterFiles(t *testing.T) {
+	var conf loader.Config
+	conf = loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {
+				"a.go":        `package p; var A = 1`,
+				"b.go":        `package p; var B = 2`,
+				"c_string.go": `package p; func (T) String() string { return "" }`,
+			},
+		}),
+		FilterFiles: func(path string, files []*ast.File) []*ast.File {
+			// Drop generated files and reverse the order of the others.
+			var res []*ast.File
+			for _, f := range files {
+				if !strings.HasSuffix(conf.Fset.File(f.Pos()).Name(), "_string.go") {
+					res = append([]*ast.File{f}, res...)
+				}
+			}
+			return res
+		},
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if got, want := imported(prog), "errors fmt"; got != want {
-		t.Errorf("Imported = %s, want %s", got, want)
+	var names []string
+	for _, f := range prog.Package("p").Files {
+		names = append(names, filepath.Base(prog.Fset.File(f.Pos()).Name()))
 	}
-	// Check set of transitive packages.
-	// There are >30 and the set may grow over time, so only check a few.
-	want := map[string]bool{
-		"strings": true,
-		"time":    true,
-		"runtime": true,
-		"testing": true,
-		"unicode": true,
+	if got, want := strings.Join(names, " "), "b.go a.go"; got != want {
+		t.Errorf("files = %s, want %s", got, want)
 	}
-	for _, path := range all(prog) {
-		delete(want, path)
+	var order []string
+	for _, init := range prog.Package("p").InitOrder {
+		order = append(order, init.Lhs[0].Name())
 	}
-	if len(want) > 0 {
-		t.Errorf("AllPackages is missing these keys: %q", keys(want))
+	if got, want := strings.Join(order, " "), "B A"; got != want {
+		t.Errorf("initialization order = %s, want %s", got, want)
 	}
 }
 
-func TestLoad_MissingIndirectImport(t *testing.T) {
-	pkgs := map[string]string{
-		"a": `package a; import _ "b"`,
-		"b": `package b; import _ "c"`,
+func TestMutateAST(t *testing.T) {
+	var conf loader.Config
+	conf = loader.Config{
+		Build: fakeContext(map[string]string{
+			"a": `package a; func F() int { return 1 }`,
+			"b": `package b; const B = 2`,
+		}),
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+		MutateAST: func(path string, files []*ast.File) ([]*ast.File, error) {
+			switch path {
+			case "a":
+				// Make F return G(), declared in a new file.
+				ret := files[0].Decls[0].(*ast.FuncDecl).Body.List[0].(*ast.ReturnStmt)
+				ret.Results[0] = &ast.CallExpr{Fun: ast.NewIdent("G")}
+				g, err := conf.ParseFile("/go/src/a/g.go", `package a; import "b"; func G() int { return b.B }`)
+				if err != nil {
+					return nil, err
+				}
+				return append(files, g), nil
+			case "c":
+				return nil, fmt.Errorf("can't mutate c")
+			}
+			return files, nil
+		},
 	}
-	conf := loader.Config{Build: fakeContext(pkgs)}
 	conf.Import("a")
-
-	const wantErr = "couldn't load packages due to errors: b"
-
+	conf.CreateFromFilenames("c")
 	prog, err := conf.Load()
-	if err == nil {
-		t.Errorf("Load succeeded unexpectedly, want %q", wantErr)
-	} else if err.Error() != wantErr {
-		t.Errorf("Load failed with wrong error %q, want %q", err, wantErr)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if prog != nil {
-		t.Errorf("Load unexpectedly returned a Program")
+	a := prog.Package("a")
+	if len(a.Errors) > 0 || len(a.Files) != 2 || prog.Package("b") == nil {
+		t.Fatalf("a has errors %v and %d files", a.Errors, len(a.Files))
+	}
+	ret := a.Files[0].Decls[0].(*ast.FuncDecl).Body.List[0].(*ast.ReturnStmt)
+	if tv := a.Types[ret.Results[0]]; tv.Type == nil || tv.Type.String() != "int" {
+		t.Errorf("type of mutated result is %v, want int", tv.Type)
+	}
+	if !hasError(prog.Created[0].Errors, "can't mutate c") {
+		t.Errorf("c errors = %v, want mutation error", prog.Created[0].Errors)
 	}
 }
 
-func TestLoad_BadDependency_AllowErrors(t *testing.T) {
+func TestPatterns(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a":          `package a`,
+		"a/b":        `package b`,
+		"a/b/c":      `package c`,
+		"a/vendor/v": `package v`,
+		"ab":         `package ab`,
+		"cmd/go":     `package main`,
+		"vendor/y":   `package y`,
+	})
 	for _, test := range []struct {
-		descr    string
-		pkgs     map[string]string
-		wantPkgs string
+		cwd, arg, want string
 	}{
-
-		{
-			descr: "missing dependency",
-			pkgs: map[string]string{
-				"a": `package a; import _ "b"`,
-				"b": `package b; import _ "c"`,
-			},
-			wantPkgs: "a b",
-		},
-		{
-			descr: "bad package decl in dependency",
-			pkgs: map[string]string{
-				"a": `package a; import _ "b"`,
-				"b": `package b; import _ "c"`,
-				"c": `package`,
-			},
-			wantPkgs: "a b",
-		},
-		{
-			descr: "parse error in dependency",
-			pkgs: map[string]string{
-				"a": `package a; import _ "b"`,
-				"b": `package b; import _ "c"`,
-				"c": `package c; var x = `,
-			},
-			wantPkgs: "a b c",
-		},
+		{arg: "a/...", want: "a a/b a/b/c"},
+		{arg: "a/.../c", want: "a/b/c"},
+		{arg: "a...", want: "a a/b a/b/c ab"},
+		{arg: "a/vendor/...", want: "a/vendor/v"},
+		{arg: "a/b", want: "a/b"},
+		{arg: "std", want: "a a/b a/b/c ab"},
+		{arg: "cmd", want: "cmd/go"},
+		{arg: "all", want: "a a/b a/b/c ab cmd/go"},
+		{cwd: "/go/src/a", arg: "./...", want: "a a/b a/b/c"},
+		{cwd: "/go/src/a", arg: "./b/...", want: "a/b a/b/c"},
+		{cwd: "/go/src/a/b", arg: "../...", want: "a a/b a/b/c"},
 	} {
 		conf := loader.Config{
-			AllowErrors: true,
-			Build:       fakeContext(test.pkgs),
+			Build: ctxt,
+			Cwd:   test.cwd,
 		}
-		conf.Import("a")
-
+		if conf.Cwd == "" {
+			conf.Cwd = "/go/src"
+		}
+		conf.Import(test.arg)
 		prog, err := conf.Load()
 		if err != nil {
-			t.Errorf("%s: Load failed unexpectedly: %v", test.descr, err)
+			t.Errorf("Load(%s) failed: %v", test.arg, err)
+			continue
 		}
-		if prog == nil {
-			t.Fatalf("%s: Load returned a nil Program", test.descr)
+		if got := imported(prog); got != test.want {
+			t.Errorf("Load(%s) from %s: Imported = %s, want %s",
+				test.arg, test.cwd, got, test.want)
 		}
 
-		if got, want := imported(prog), "a"; got != want {
-			t.Errorf("%s: Imported = %s, want %s", test.descr, got, want)
-		}
-		if got := all(prog); strings.Join(got, " ") != test.wantPkgs {
-			t.Errorf("%s: AllPackages = %s, want %s", test.descr, got, test.wantPkgs)
+		// ImportPattern reports the same expansion eagerly.
+		conf = loader.Config{Build: ctxt, Cwd: conf.Cwd}
+		pkgs, err := conf.ImportPattern(test.arg, false)
+		if err != nil {
+			t.Errorf("ImportPattern(%s) failed: %v", test.arg, err)
+		} else if got := strings.Join(pkgs, " "); got != test.want {
+			t.Errorf("ImportPattern(%s) from %s = %s, want %s",
+				test.arg, test.cwd, got, test.want)
 		}
 	}
 }
 
-func TestCwd(t *testing.T) {
-	ctxt := fakeContext(map[string]string{"one/two/three": `package three`})
-	for _, test := range []struct {
-		cwd, arg, want string
-	}{
-		{cwd: "/go/src/one", arg: "./two/three", want: "one/two/three"},
-		{cwd: "/go/src/one", arg: "../one/two/three", want: "one/two/three"},
-		{cwd: "/go/src/one", arg: "one/two/three", want: "one/two/three"},
-		{cwd: "/go/src/one/two/three", arg: ".", want: "one/two/three"},
-		{cwd: "/go/src/one", arg: "two/three", want: ""},
-	} {
-		conf := loader.Config{
-			Cwd:   test.cwd,
-			Build: ctxt,
-		}
-		conf.Import(test.arg)
+func TestExcludePatterns(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a":          `package a`,
+		"a/b":        `package b`,
+		"a/b/c":      `package c`,
+		"a/gen":      `package gen`,
+		"a/vendor/v": `package v`,
+	})
+	conf := loader.Config{
+		Build:   ctxt,
+		Cwd:     "/go/src/a",
+		Exclude: func(path string) bool { return strings.HasSuffix(path, "/gen") },
+	}
+	conf.Import("./...")
+	conf.Import("./vendor/...")
+	conf.Import("-./vendor/...")
+	conf.Import("-a/b/c")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, want := imported(prog), "a a/b"; got != want {
+		t.Errorf("Imported = %s, want %s", got, want)
+	}
 
-		var got string
-		prog, err := conf.Load()
-		if prog != nil {
-			got = imported(prog)
-		}
-		if got != test.want {
-			t.Errorf("Load(%s) from %s: Imported = %s, want %s",
-				test.arg, test.cwd, got, test.want)
-			if err != nil {
-				t.Errorf("Load failed: %v", err)
-			}
-		}
+	conf.ImportPkgs = nil
+	if _, err := conf.ImportPattern("./...", false); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := conf.ImportPattern("-./b/...", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(removed, " "), "a/b a/b/c"; got != want {
+		t.Errorf("ImportPattern removed %s, want %s", got, want)
+	}
+	if got, want := strings.Join(keys(conf.ImportPkgs), " "), "a"; got != want {
+		t.Errorf("ImportPkgs = %s, want %s", got, want)
+	}
+}
+
+func TestFlags(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import _ "b"`,
+		"b": `package b; var _ = x`,
+	})
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags := loader.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-tags=foo bar", "-test", "-allowerrors", "-parallelism=1", "a"}); err != nil {
+		t.Fatal(err)
+	}
+	conf := loader.Config{Build: ctxt}
+	flags.Apply(&conf)
+	if _, err := conf.FromArgs(fs.Args(), flags.Tests); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := conf.Build.BuildTags, []string{"foo", "bar"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildTags = %q, want %q", got, want)
+	}
+	if ctxt.BuildTags != nil {
+		t.Errorf("Apply modified the original build context")
+	}
+	if !conf.ImportPkgs["a"] || !conf.AllowErrors || conf.Parallelism != 1 {
+		t.Errorf("Apply: got ImportPkgs=%v AllowErrors=%t Parallelism=%d",
+			conf.ImportPkgs, conf.AllowErrors, conf.Parallelism)
+	}
+	if _, err := conf.Load(); err != nil {
+		t.Errorf("Load failed: %v", err)
 	}
 }
 
@@ -659,6 +2192,74 @@ func TestErrorReporting(t *testing.T) {
 	}
 }
 
+// TestDeterminism checks that Load yields the same Program, and the
+// same error, regardless of GOMAXPROCS and Parallelism.
+func TestDeterminism(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {
+			"a.go":      `package a; import ("b"; "c"); var A = B + C; var B = b.X; var C = c.X`,
+			"z.go":      `package a; import "e"; var Z = e.X + A`,
+			"a_test.go": `package a; var T = Z`,
+			"x_test.go": `package a_test; import "a"; var X = a.A`,
+		},
+		"b": {"b.go": `package b; import "d"; var X = d.X`},
+		"c": {"c.go": `package c; import ("d"; "missing"); var X = d.X + missing.Y`},
+		"d": {"d.go": `package d; var X = 1`},
+		"e": {
+			"e1.go": `package e; import ("b"; "c"); var X int = "e1" + b.X + c.X`,
+			"e2.go": `package e; var Y, Z = undefined1, undefined2`,
+		},
+	})
+	load := func(parallelism int, allowErrors bool) string {
+		conf := loader.Config{
+			Build:       ctxt,
+			Parallelism: parallelism,
+			AllowErrors: allowErrors,
+			TypeChecker: types.Config{Error: func(error) {}},
+		}
+		conf.ImportWithTests("a")
+		conf.Import("e")
+		prog, err := conf.Load()
+		if err != nil {
+			return err.Error()
+		}
+		var buf bytes.Buffer
+		for _, info := range prog.Created {
+			fmt.Fprintf(&buf, "created %s\n", info)
+		}
+		for _, info := range prog.SortedPackages() {
+			fmt.Fprintf(&buf, "package %s (error-free: %t)\n", info, info.TransitivelyErrorFree)
+			for _, f := range info.Files {
+				fmt.Fprintf(&buf, "\tfile %s\n", prog.Fset.File(f.Pos()).Name())
+			}
+			for _, err := range info.Errors {
+				fmt.Fprintf(&buf, "\terror %s\n", err)
+			}
+			for _, init := range info.InitOrder {
+				fmt.Fprintf(&buf, "\tinit %s\n", init)
+			}
+		}
+		return buf.String()
+	}
+
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, allowErrors := range []bool{true, false} {
+		runtime.GOMAXPROCS(1)
+		want := load(1, allowErrors)
+		for _, procs := range []int{1, 2, 8} {
+			runtime.GOMAXPROCS(procs)
+			for _, parallelism := range []int{0, 1, 4} {
+				for i := 0; i < 5; i++ {
+					if got := load(parallelism, allowErrors); got != want {
+						t.Fatalf("AllowErrors=%t, GOMAXPROCS=%d, Parallelism=%d: got\n%s\nwant\n%s",
+							allowErrors, procs, parallelism, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
 func TestCycles(t *testing.T) {
 	for _, test := range []struct {
 		descr   string
@@ -823,3 +2424,239 @@ func loadIO(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestLimits(t *testing.T) {
+	deep := "package deep; var X = " + strings.Repeat("(", 20) + "1" + strings.Repeat(")", 20)
+	closers := "package closers; var Y int " + strings.Repeat(")", 20) + " var X = " + strings.Repeat("(", 20) + "1" + strings.Repeat(")", 20)
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"main": {
+			"main.go": `package main; import (_ "big"; _ "cgobig"; _ "closers"; _ "deep")`,
+			"more.go": `package main; import (_ "many"; _ "ok"; _ "slices"; _ "unary")`,
+		},
+		"big":     {"big.go": "package big // " + strings.Repeat("x", 200)},
+		"cgobig":  {"cgo.go": "package cgobig; import \"C\" // " + strings.Repeat("x", 200)},
+		"closers": {"closers.go": closers},
+		"deep":    {"deep.go": deep},
+		"many":    {"a.go": "package many", "b.go": "package many", "c.go": "package many"},
+		"ok":      {"a.go": "package ok; var X = [](func()){func() {}}", "b.go": "package ok"},
+		"slices":  {"slices.go": "package slices; var X " + strings.Repeat("[]", 20) + "int"},
+		"unary":   {"unary.go": "package unary; var X = " + strings.Repeat("^", 20) + "1"},
+	})
+	ctxt.CgoEnabled = true
+	conf := loader.Config{
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+		Build:       ctxt,
+		Limits: loader.Limits{
+			MaxFileSize:     100,
+			MaxPackageFiles: 2,
+			MaxNestingDepth: 10,
+		},
+	}
+	conf.Import("main")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"big":     "/go/src/big/big.go: file exceeds the size limit of 100 bytes",
+		"cgobig":  "/go/src/cgobig/cgo.go: file exceeds the size limit of 100 bytes",
+		"closers": "/go/src/closers/closers.go:1:67: nesting depth exceeds the limit of 10",
+		"deep":    "/go/src/deep/deep.go:1:33: nesting depth exceeds the limit of 10",
+		"many":    "package many has 3 files, exceeding the limit of 2",
+		"ok":      "",
+		"slices":  "/go/src/slices/slices.go:1:43: nesting depth exceeds the limit of 10",
+		"unary":   "/go/src/unary/unary.go:1:34: nesting depth exceeds the limit of 10",
+	} {
+		info := prog.Package(path)
+		var got string
+		if len(info.Errors) > 0 {
+			got = info.Errors[0].Error()
+		}
+		if got != want {
+			t.Errorf("%s: got error %q, want %q", path, got, want)
+		}
+		if want != "" && len(info.Files) > 0 {
+			t.Errorf("%s: got %d files despite exceeding a limit", path, len(info.Files))
+		}
+	}
+}
+
+func TestPartitions(t *testing.T) {
+	pad := "// " + strings.Repeat("x", 100) + "\n"
+	var (
+		mu   sync.Mutex
+		errs []string
+	)
+	newConfig := func() *loader.Config {
+		conf := &loader.Config{
+			TypeChecker: types.Config{Error: func(err error) {
+				mu.Lock()
+				errs = append(errs, err.Error())
+				mu.Unlock()
+			}},
+			Build: buildutil.FakeContext(map[string]map[string]string{
+				"a": {"x.go": pad + `package a`},
+				"b": {"x.go": pad + `package b`},
+				"c": {"x.go": pad + `package c`},
+			}),
+			Limits: loader.Limits{MaxFileSetSize: 150},
+		}
+		conf.Import("...")
+		return conf
+	}
+
+	// A single FileSet is exhausted.
+	if _, err := newConfig().Load(); err == nil {
+		t.Errorf("Load succeeded despite exhausting the FileSet")
+	}
+	if len(errs) == 0 || !strings.Contains(errs[0], "FileSet exhausted") {
+		t.Errorf("Load: got errors %q, want FileSet exhausted", errs)
+	}
+	errs = nil
+
+	// A FileSet per package suffices.
+	parts, err := newConfig().LoadPartitioned(1)
+	if err != nil {
+		t.Fatal(err, errs)
+	}
+	if len(parts.Programs) != 3 {
+		t.Fatalf("got %d partitions, want 3", len(parts.Programs))
+	}
+	for i, path := range []string{"a", "b", "c"} {
+		prog, info := parts.Package(path)
+		if prog != parts.Programs[i] || info == nil {
+			t.Errorf("Package(%s) is not in partition %d", path, i)
+			continue
+		}
+		pos := parts.Pos(prog, info.Files[0].Name.Pos())
+		if got, want := parts.Position(pos).String(), "/go/src/"+path+"/x.go:2:9"; got != want {
+			t.Errorf("Position(%v) = %s, want %s", pos, got, want)
+		}
+	}
+}
+
+func TestIsolateFailures(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a":   {"x.go": `package a; import "bad"; var X = bad.X`},
+		"b":   {"x.go": `package b; import "c"; var X = c.X`},
+		"c":   {"x.go": `package c; var X int`},
+		"bad": {"x.go": `package bad; var X int`},
+		"d":   {"x.go": `package d; var X int = "d"`},
+	})
+	readDir := ctxt.ReadDir
+	ctxt.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		if dir == "/go/src/bad" {
+			return nil, &os.PathError{Op: "open", Path: dir, Err: os.ErrPermission}
+		}
+		return readDir(dir)
+	}
+
+	load := func(isolate bool, paths ...string) (*loader.Program, error) {
+		conf := loader.Config{
+			Build:           ctxt,
+			IsolateFailures: isolate,
+			TypeChecker:     types.Config{Error: func(error) {}},
+		}
+		for _, path := range paths {
+			conf.Import(path)
+		}
+		return conf.Load()
+	}
+
+	// By default, the failure of bad is fatal.
+	if _, err := load(false, "a", "b"); err == nil {
+		t.Errorf("Load succeeded despite an unreadable package")
+	}
+
+	// With IsolateFailures, it affects only its importers.
+	prog, err := load(true, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad := prog.Package("bad"); bad == nil || !bad.Failed || len(bad.Errors) != 1 || bad.Files != nil {
+		t.Errorf("bad is not a failed package: %+v", bad)
+	} else if !strings.Contains(bad.Errors[0].Error(), "permission denied") {
+		t.Errorf("bad has error %v, want permission denied", bad.Errors[0])
+	}
+	if a := prog.Package("a"); a.Failed || a.Errors == nil {
+		t.Errorf("a: Failed=%t Errors=%v, want an import error only", a.Failed, a.Errors)
+	}
+	for _, path := range []string{"b", "c"} {
+		if info := prog.Package(path); !info.TransitivelyErrorFree {
+			t.Errorf("%s is not error-free: %v", path, info.Errors)
+		}
+	}
+
+	// An initial package that cannot be found is itself failed.
+	prog, err = load(true, "b", "bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad := prog.Imported["bad"]; bad == nil || !bad.Failed {
+		t.Errorf("Imported[bad] is not a failed package: %+v", bad)
+	}
+
+	// Errors unrelated to failed packages remain fatal.
+	if _, err := load(true, "a", "d"); err == nil || !strings.HasSuffix(err.Error(), "errors: d") {
+		t.Errorf("Load: got error %v, want one naming d alone", err)
+	}
+}
+
+func TestImportMain(t *testing.T) {
+	conf := loader.Config{
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"tool": {
+				"main.go":      `package main; var X int; func main() {}`,
+				"main_test.go": `package main_test; import "tool"; var _ = main.X`,
+			},
+			"lib": {"x.go": "package lib\n\nimport \"tool\"\n\nvar _ = main.X"},
+		}),
+	}
+	conf.ImportWithTests("tool")
+	conf.Import("lib")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lib := prog.Package("lib")
+	if len(lib.Errors) != 1 {
+		t.Fatalf("lib: got errors %v, want 1", lib.Errors)
+	}
+	if err, ok := lib.Errors[0].(*loader.ImportMainError); !ok {
+		t.Errorf("lib: got %T, want *ImportMainError", lib.Errors[0])
+	} else if got, want := err.Error(), `/go/src/lib/x.go:3:8: import "tool" is a program, not an importable package`; got != want {
+		t.Errorf("lib: got error %q, want %q", got, want)
+	}
+
+	// The external test package of a main package may import it.
+	if xtest := prog.Package("tool_test"); xtest == nil || xtest.Errors != nil {
+		t.Errorf("tool_test: %v", xtest)
+	}
+
+	// The import is reported even if the main package cannot be
+	// loaded in full, here because of an import cycle.
+	conf = loader.Config{
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"tool": {"main.go": `package main; import _ "lib"; func main() {}`},
+			"lib":  {"x.go": `package lib; import _ "tool"`},
+		}),
+	}
+	conf.Import("lib")
+	prog, err = conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, err := range prog.Package("lib").Errors {
+		_, ok := err.(*loader.ImportMainError)
+		found = found || ok
+	}
+	if !found {
+		t.Errorf("lib: got errors %v, want an ImportMainError", prog.Package("lib").Errors)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines manifests, which specify exactly the files of each
+// package, for hermetic builds.
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// A Manifest specifies exactly which files constitute each package of
+// a program, by import path, so that a hermetic build environment
+// controls precisely what the loader sees.  Its FindPackage method is
+// a Config.FindPackage hook that consults only the manifest: it does
+// not scan directories, apply build constraints, or resolve vendored
+// imports, and a package absent from the manifest cannot be found.
+// The standard "unsafe" package need not be listed.
+//
+type Manifest map[string]*ManifestPackage
+
+// A ManifestPackage specifies the files of a package.  File names may
+// be absolute or relative to Dir.
+type ManifestPackage struct {
+	Dir          string   // directory of the package
+	GoFiles      []string // Go source files, other than tests
+	TestGoFiles  []string // in-package test files
+	XTestGoFiles []string // external test files
+
+	// ExportFile, if non-empty, is the file containing the export data
+	// of the package, for use when the package is imported from
+	// binary, as by Config.ImportFromBinary.
+	ExportFile string `json:",omitempty"`
+}
+
+// LoadManifest returns the Manifest decoded from the named JSON file,
+// a JSON object mapping each import path to a ManifestPackage.  A
+// relative Dir is interpreted relative to the directory containing the
+// file.
+func LoadManifest(filename string) (Manifest, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	for path, mp := range m {
+		if mp == nil {
+			return nil, fmt.Errorf("%s: package %s is null", filename, path)
+		}
+		if !filepath.IsAbs(mp.Dir) {
+			mp.Dir = filepath.Join(dir, mp.Dir)
+		}
+	}
+	return m, nil
+}
+
+// FindPackage returns the package of the manifest with the specified
+// import path.  The directory fromDir and mode are ignored.  Its
+// signature is that of Config.FindPackage.
+func (m Manifest) FindPackage(ctxt *build.Context, importPath, fromDir string, mode build.ImportMode) (*build.Package, error) {
+	mp, ok := m[importPath]
+	if !ok {
+		if importPath == "unsafe" {
+			return &build.Package{ImportPath: "unsafe", Goroot: true}, nil
+		}
+		return nil, fmt.Errorf("package %s is not in the manifest", importPath)
+	}
+	return &build.Package{
+		ImportPath:   importPath,
+		Dir:          mp.Dir,
+		GoFiles:      mp.GoFiles,
+		TestGoFiles:  mp.TestGoFiles,
+		XTestGoFiles: mp.XTestGoFiles,
+		PkgObj:       mp.ExportFile,
+	}, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"p/p.go":      `package p; import "unsafe"; const Size = unsafe.Sizeof(0)`,
+		"p/tagged.go": "// +build ignore\n\npackage p; const Tagged = true",
+		"p/extra.go":  `package p; const Extra = true`, // not in manifest
+		"q/q.go":      `package q; import "example.com/p"; var _ = p.Tagged`,
+		"q/q_test.go": `package q; var T = 1`,
+		"q/x_test.go": `package q_test; import "example.com/q"; var _ = q.T`,
+		"manifest.json": `{
+	"example.com/p": {"Dir": "p", "GoFiles": ["p.go", "tagged.go"]},
+	"example.com/q": {"Dir": "q", "GoFiles": ["q.go"], "TestGoFiles": ["q_test.go"], "XTestGoFiles": ["x_test.go"]}
+}`,
+	} {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(filename), 0755)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := loader.LoadManifest(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := loader.Config{FindPackage: m.FindPackage}
+	conf.ImportWithTests("example.com/q")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := prog.Package("example.com/p")
+	if p.Pkg.Scope().Lookup("Tagged") == nil {
+		t.Errorf("file excluded by build constraints was not loaded")
+	}
+	if p.Pkg.Scope().Lookup("Extra") != nil {
+		t.Errorf("file absent from the manifest was loaded")
+	}
+	if prog.Package("example.com/q_test") == nil {
+		t.Errorf("external test package was not loaded")
+	}
+
+	// A package absent from the manifest cannot be found.
+	conf = loader.Config{
+		FindPackage: m.FindPackage,
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+	}
+	f, err := conf.ParseFile("r.go", `package r; import "example.com/s"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf.CreateFromFiles("r", f)
+	prog, err = conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := prog.Created[0].Errors; len(errs) == 0 || !strings.Contains(errs[0].Error(), "package example.com/s is not in the manifest") {
+		t.Errorf("errors = %v, want 'not in the manifest'", errs)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines a functional-options constructor for Config.
+
+import (
+	"go/build"
+	"go/token"
+)
+
+// An Option configures the Config created by New.
+type Option func(*options)
+
+// options accumulates the effects of Options so that New can apply
+// them in a fixed order regardless of the order of its arguments.
+type options struct {
+	fset        *token.FileSet
+	ctxt        *build.Context
+	tests       bool
+	binary      func(path string) bool
+	allowErrors bool
+	imports     []string
+	creates     []PkgSpec
+}
+
+// New returns a new Config configured by the specified options.
+//
+// Options may be given in any order: New first establishes the file
+// set and build context, then the other settings, and finally adds
+// the initial packages.  For example:
+//
+//      conf := loader.New(
+//              loader.WithImports("fmt", "net/http"),
+//              loader.WithTests(),
+//              loader.WithFset(fset))
+//      prog, err := conf.Load()
+//
+func New(opts ...Option) *Config {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	conf := &Config{
+		Fset:             o.fset,
+		Build:            o.ctxt,
+		ImportFromBinary: o.binary,
+		AllowErrors:      o.allowErrors,
+	}
+	conf.fset() // initialize Fset before any parsing
+	for _, path := range o.imports {
+		conf.addImport(path, o.tests)
+	}
+	conf.CreatePkgs = append(conf.CreatePkgs, o.creates...)
+	return conf
+}
+
+// WithFset specifies the file set for the Config.
+// The file set of parsed files given by WithFiles must be this one.
+func WithFset(fset *token.FileSet) Option {
+	return func(o *options) { o.fset = fset }
+}
+
+// WithBuildContext specifies the build context used to locate and
+// read packages.  By default, build.Default is used.
+func WithBuildContext(ctxt *build.Context) Option {
+	return func(o *options) { o.ctxt = ctxt }
+}
+
+// WithTests causes the packages specified by WithImports to be
+// augmented by their tests, as by Config.ImportWithTests.
+func WithTests() Option {
+	return func(o *options) { o.tests = true }
+}
+
+// WithSourceImports causes all dependencies to be loaded from source.
+// This is the default.
+func WithSourceImports() Option {
+	return func(o *options) { o.binary = nil }
+}
+
+// WithBinaryImports causes dependencies for which the predicate holds
+// to be imported from export data; see Config.ImportFromBinary.
+func WithBinaryImports(pred func(path string) bool) Option {
+	return func(o *options) { o.binary = pred }
+}
+
+// WithAllowErrors causes Load to return a Program even if some
+// packages contained errors; see Config.AllowErrors.
+func WithAllowErrors() Option {
+	return func(o *options) { o.allowErrors = true }
+}
+
+// WithImports adds the specified import paths or patterns to the set
+// of initial packages.
+func WithImports(paths ...string) Option {
+	return func(o *options) { o.imports = append(o.imports, paths...) }
+}
+
+// WithFiles adds an initial package, with the specified path, created
+// from the named files; see Config.CreateFromFilenames.
+func WithFiles(path string, filenames ...string) Option {
+	return func(o *options) {
+		o.creates = append(o.creates, PkgSpec{Path: path, Filenames: filenames})
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/token"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestNew(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; import _ "b"`,
+		"b": `package b`,
+	})
+	fset := token.NewFileSet()
+
+	// The order of options is immaterial.
+	conf := loader.New(
+		loader.WithImports("a"),
+		loader.WithTests(),
+		loader.WithBuildContext(ctxt),
+		loader.WithBinaryImports(func(string) bool { return true }),
+		loader.WithSourceImports(),
+		loader.WithFset(fset))
+
+	if conf.Fset != fset || conf.Build != ctxt || conf.ImportFromBinary != nil {
+		t.Errorf("New: got Fset=%p Build=%p ImportFromBinary=%p", conf.Fset, conf.Build, conf.ImportFromBinary)
+	}
+	if want := map[string]bool{"a": true}; !reflect.DeepEqual(conf.ImportPkgs, want) {
+		t.Errorf("ImportPkgs = %v, want %v", conf.ImportPkgs, want)
+	}
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if prog.Fset != fset {
+		t.Errorf("Program.Fset is not the file set given to New")
+	}
+	if got, want := all(prog), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AllPackages = %s, want %s", got, want)
+	}
+
+	// The zero set of options yields a ready-to-use Config.
+	if conf := loader.New(); conf.Fset == nil {
+		t.Errorf("New() has nil Fset")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines Origin, the record of why a created package is
+// among the initial packages.
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An Origin records why a package appears in Program.Created, so that
+// tools that combine several sources of initial packages can explain
+// the presence of each one.
+type Origin struct {
+	// Spec is the index of the Config.CreatePkgs entry from which
+	// the package was created, or -1 for an external test package.
+	Spec int
+
+	// XTestOf is the import path of the package under test, for an
+	// external test package.
+	XTestOf string
+
+	// Filenames holds the file names and patterns of the CreatePkgs
+	// entry, before pattern expansion.
+	Filenames []string
+
+	// Parsed reports whether the CreatePkgs entry supplied
+	// already-parsed files.
+	Parsed bool
+}
+
+func (o *Origin) String() string {
+	if o.Spec < 0 {
+		return fmt.Sprintf("external test package of %q", o.XTestOf)
+	}
+	var parts []string
+	if o.Filenames != nil {
+		parts = append(parts, "files "+strings.Join(o.Filenames, " "))
+	}
+	if o.Parsed {
+		parts = append(parts, "parsed files")
+	}
+	if parts == nil {
+		parts = append(parts, "no files")
+	}
+	return fmt.Sprintf("%s (Config.CreatePkgs[%d])", strings.Join(parts, " and "), o.Spec)
+}
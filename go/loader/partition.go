@@ -0,0 +1,128 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines LoadPartitioned, which divides a large load among
+// several Programs, each with its own FileSet.
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+)
+
+// Partitions is the result of LoadPartitioned: a sequence of Programs,
+// each with its own FileSet, that together contain the initial
+// packages of a Config.
+//
+// Positions are meaningful only with respect to the FileSet of the
+// Program from which they came; a PartPos records both.
+type Partitions struct {
+	Programs []*Program
+
+	initial map[string]int // index of the Program of each initial package
+}
+
+// A PartPos is a position within one of the Programs of a Partitions.
+type PartPos struct {
+	Part int       // index of the Program in Partitions.Programs
+	Pos  token.Pos // position within its FileSet
+}
+
+// LoadPartitioned is like Load, but it divides the initial packages,
+// after the expansion of patterns, into partitions of at most size
+// packages each, in order of import path, and loads each partition
+// as a separate Program with its own FileSet.  The packages specified
+// by CreatePkgs belong to the first partition.  It thus permits the
+// loading of a set of packages whose source is too large for the range
+// of positions of a single FileSet.
+//
+// Dependencies shared by several partitions are loaded by each, so
+// their packages and types are distinct.
+//
+// The first partition uses Config.Fset, if any, and the others use
+// new FileSets, so LoadPartitioned does not support Shared,
+// ExtraFiles, or Checked, whose files belong to Config.Fset.
+//
+// LoadPartitioned fails if the Load of any partition fails.
+//
+func (conf *Config) LoadPartitioned(size int) (*Partitions, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("LoadPartitioned: invalid partition size %d", size)
+	}
+	if conf.Shared != nil || conf.ExtraFiles != nil || conf.Checked != nil {
+		return nil, fmt.Errorf("LoadPartitioned: Shared, ExtraFiles, and Checked are not supported")
+	}
+
+	imp, err := conf.newImporter()
+	if err != nil {
+		return nil, err
+	}
+	importPkgs := imp.localizeDirs(imp.expandPatterns(conf.ImportPkgs))
+	paths := make([]string, 0, len(importPkgs))
+	for path := range importPkgs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	parts := &Partitions{initial: make(map[string]int)}
+	for i := 0; i == 0 || i < len(paths); i += size {
+		part := *conf // shallow copy
+		part.ImportPkgs = make(map[string]bool)
+		if i > 0 {
+			part.Fset = nil
+			part.CreatePkgs = nil
+		}
+		end := i + size
+		if end > len(paths) {
+			end = len(paths)
+		}
+		for _, path := range paths[i:end] {
+			part.ImportPkgs[path] = importPkgs[path]
+			parts.initial[path] = len(parts.Programs)
+		}
+		prog, err := part.Load()
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %v", len(parts.Programs), err)
+		}
+		if i == 0 {
+			conf.Fset = part.Fset
+		}
+		parts.Programs = append(parts.Programs, prog)
+	}
+	return parts, nil
+}
+
+// Package returns the Program and PackageInfo of the package denoted
+// by path: the Program whose initial packages include it, or else the
+// first whose dependencies do, or nil if none does.
+func (parts *Partitions) Package(path string) (*Program, *PackageInfo) {
+	if i, ok := parts.initial[path]; ok {
+		prog := parts.Programs[i]
+		return prog, prog.Package(path)
+	}
+	for _, prog := range parts.Programs {
+		if info := prog.Package(path); info != nil {
+			return prog, info
+		}
+	}
+	return nil, nil
+}
+
+// Pos returns the PartPos of the position pos within prog, which
+// must be one of the Programs of parts.
+func (parts *Partitions) Pos(prog *Program, pos token.Pos) PartPos {
+	for i, p := range parts.Programs {
+		if p == prog {
+			return PartPos{i, pos}
+		}
+	}
+	panic("Pos: Program is not a partition")
+}
+
+// Position returns the source position of pos.
+func (parts *Partitions) Position(pos PartPos) token.Position {
+	return parts.Programs[pos.Part].Fset.Position(pos.Pos)
+}
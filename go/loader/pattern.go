@@ -0,0 +1,405 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the interpretation of initial package arguments:
+// import path patterns and directory names.
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+// isPattern reports whether the import path arg is a pattern
+// denoting a set of packages rather than a single package.
+func isPattern(arg string) bool {
+	return isMetaPackage(arg) || strings.Contains(arg, "...") || isExclusion(arg)
+}
+
+// isExclusion reports whether arg is an exclusion pattern such as
+// "-./vendor/...", which denotes packages to be removed from the
+// set of initial packages.
+func isExclusion(arg string) bool {
+	return strings.HasPrefix(arg, "-")
+}
+
+// isMetaPackage reports whether name is one of the reserved package
+// names that denote a set of packages.
+func isMetaPackage(name string) bool {
+	return name == "std" || name == "cmd" || name == "all"
+}
+
+// ImportPattern is a convenience function that expands pattern and
+// adds each matching package to ImportPkgs, augmented by its tests if
+// tests is true.  It returns the sorted list of matching packages.
+//
+// The pattern may be a single import path; a path containing "..."
+// such as "golang.org/x/tools/..." or "./..."; or one of the
+// meta-packages "std" (the standard library), "cmd" (the Go
+// commands), or "all" (every package in the workspace).
+// Patterns are interpreted as by 'go build'; see expandPattern.
+// Packages for which conf.Exclude returns true are not added.
+//
+// A pattern preceded by '-', such as "-./vendor/...", instead
+// removes the matching packages from ImportPkgs, and ImportPattern
+// returns the packages removed.
+//
+// Load performs the same expansion for patterns added by Import,
+// so ImportPattern is needed only by clients that wish to know the
+// expansion in advance.
+//
+func (conf *Config) ImportPattern(pattern string, tests bool) ([]string, error) {
+	if !isPattern(pattern) {
+		conf.addImport(pattern, tests)
+		return []string{pattern}, nil
+	}
+	cwd := conf.Cwd
+	if cwd == "" {
+		var err error
+		if cwd, err = os.Getwd(); err != nil {
+			return nil, err
+		}
+	}
+	findPackage := conf.FindPackage
+	if findPackage == nil {
+		findPackage = defaultFindPackage
+	}
+	ctxt := conf.build()
+	if isExclusion(pattern) {
+		return removeMatches(ctxt, cwd, pattern[1:], conf.ImportPkgs)
+	}
+	pkgs, err := expandPattern(ctxt, cwd, pattern, func(path string) (string, bool) {
+		if conf.excluded(path) {
+			return "", false
+		}
+		return goFilesDir(findPackage(ctxt, path, cwd, ignoreVendor))
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range pkgs {
+		conf.addImport(path, tests)
+	}
+	return pkgs, nil
+}
+
+// excluded reports whether the package path is excluded from the
+// expansion of patterns by conf.Exclude.
+func (conf *Config) excluded(path string) bool {
+	return conf.Exclude != nil && conf.Exclude(path)
+}
+
+// expandPatterns returns the set of initial packages denoted by
+// importPkgs, in which each pattern has been replaced by the packages
+// it matches.  The map value of a pattern is copied to each of its
+// matches.  Exclusion patterns are applied after all others.
+// If there are no patterns, importPkgs itself is returned.
+//
+// Patterns that match no packages are reported as warnings.
+func (imp *importer) expandPatterns(importPkgs map[string]bool) map[string]bool {
+	var patterns, exclusions []string
+	for arg := range importPkgs {
+		if isExclusion(arg) {
+			exclusions = append(exclusions, arg)
+		} else if isPattern(arg) {
+			patterns = append(patterns, arg)
+		}
+	}
+	if patterns == nil && exclusions == nil {
+		return importPkgs
+	}
+	sort.Strings(patterns)
+	sort.Strings(exclusions)
+
+	pkgs := make(map[string]bool)
+	for arg, tests := range importPkgs {
+		if !isPattern(arg) {
+			pkgs[arg] = pkgs[arg] || tests
+		}
+	}
+	find := func(path string) (string, bool) {
+		if imp.conf.excluded(path) {
+			return "", false
+		}
+		return goFilesDir(imp.findPackage(path, imp.conf.Cwd, ignoreVendor))
+	}
+	for _, arg := range patterns {
+		tests := importPkgs[arg]
+		matches, err := expandPattern(imp.conf.build(), imp.conf.Cwd, arg, find)
+		if err != nil {
+			imp.conf.TypeChecker.Error(err)
+			continue
+		}
+		if matches == nil {
+			imp.conf.TypeChecker.Error(fmt.Errorf("warning: %q matched no packages", arg))
+		}
+		for _, path := range matches {
+			pkgs[path] = pkgs[path] || tests
+		}
+	}
+	for _, arg := range exclusions {
+		if _, err := removeMatches(imp.conf.build(), imp.conf.Cwd, arg[1:], pkgs); err != nil {
+			imp.conf.TypeChecker.Error(err)
+		}
+	}
+	return pkgs
+}
+
+// removeMatches deletes from pkgs each package that matches pattern,
+// and returns the sorted list of deleted packages.
+func removeMatches(ctxt *build.Context, cwd, pattern string, pkgs map[string]bool) ([]string, error) {
+	var match func(path string) bool
+	if isMetaPackage(pattern) || isRootPattern(ctxt, cwd, pattern) {
+		matches, err := expandPattern(ctxt, cwd, pattern, func(string) (string, bool) { return "", true })
+		if err != nil {
+			return nil, err
+		}
+		set := make(map[string]bool)
+		for _, path := range matches {
+			set[path] = true
+		}
+		match = func(path string) bool { return set[path] }
+	} else {
+		abs, _, err := absPattern(ctxt, cwd, pattern)
+		if err != nil {
+			return nil, err
+		}
+		match = matchPattern(abs)
+	}
+
+	var removed []string
+	for path := range pkgs {
+		if match(path) {
+			removed = append(removed, path)
+			delete(pkgs, path)
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// localizeDirs returns the set of initial packages denoted by
+// importPkgs, in which each absolute directory name has been replaced
+// by an equivalent import path relative to conf.Cwd, such as "../foo",
+// which go/build interprets as the package in that directory.
+// If there are no absolute directory names, importPkgs is returned.
+func (imp *importer) localizeDirs(importPkgs map[string]bool) map[string]bool {
+	ctxt := imp.conf.build()
+	var pkgs map[string]bool
+	for arg, tests := range importPkgs {
+		if !buildutil.IsAbsPath(ctxt, arg) {
+			continue
+		}
+		if pkgs == nil {
+			pkgs = make(map[string]bool)
+			for arg, tests := range importPkgs {
+				pkgs[arg] = tests
+			}
+		}
+		delete(pkgs, arg)
+		rel, err := filepath.Rel(imp.conf.Cwd, arg)
+		if err != nil {
+			rel = arg // e.g. different Windows volume; go/build will report it
+		}
+		rel = filepath.ToSlash(rel)
+		if !build.IsLocalImport(rel) {
+			rel = "./" + rel
+		}
+		pkgs[rel] = pkgs[rel] || tests
+	}
+	if pkgs == nil {
+		return importPkgs
+	}
+	return pkgs
+}
+
+// expandPattern returns the sorted list of packages in the workspace
+// of ctxt that match pattern and for which find reports true.  find
+// also returns the package's directory, if known; of several matching
+// packages in the same physical directory, such as the aliases
+// created by a symbolic link within the workspace, only the first is
+// included.
+//
+// Patterns are interpreted as by 'go build': "..." matches any string,
+// including the empty string and strings containing slashes, and
+// "x/..." also matches "x".  A pattern beginning with "./" or "../"
+// is interpreted relative to cwd.  Packages within vendor
+// directories are matched only if the pattern mentions "vendor".
+// The meta-package "std" matches the packages of the standard
+// library, "cmd" the packages of the Go commands, both in $GOROOT,
+// and "all" matches every package in the workspace.
+//
+// Only the directories beneath the literal prefix of the pattern are
+// walked; for example, "golang.org/x/tools/go/..." walks only the
+// golang.org/x/tools/go directory of each workspace root.  A relative
+// pattern such as "./..." whose directory is a workspace root matches
+// only the packages of that root.
+func expandPattern(ctxt *build.Context, cwd, pattern string, find func(path string) (dir string, ok bool)) ([]string, error) {
+	var all []string // candidate packages
+	var match func(path string) bool
+	switch pattern {
+	case "std", "cmd":
+		// Enumerate only the packages in $GOROOT.
+		goroot := *ctxt // copy
+		goroot.GOPATH = ""
+		all = buildutil.AllPackages(&goroot)
+		isCmd := matchPattern("cmd/...")
+		match = func(path string) bool {
+			return isCmd(path) == (pattern == "cmd") && !isVendored(path)
+		}
+
+	case "all":
+		all = buildutil.AllPackages(ctxt)
+		match = matchPattern("...")
+
+	default:
+		abs, root, err := absPattern(ctxt, cwd, pattern)
+		if err != nil {
+			return nil, err
+		}
+		ws := ctxt
+		if root != "" {
+			ws = rootContext(ctxt, root)
+		}
+		all = buildutil.PackagesBeneath(ws, literalPrefix(abs))
+		match = matchPattern(abs)
+	}
+
+	var pkgs []string
+	dirs := make(map[string]bool) // canonical directories of pkgs
+	for _, path := range all {
+		if !match(path) {
+			continue
+		}
+		dir, ok := find(path)
+		if !ok {
+			continue
+		}
+		if dir != "" {
+			dir = buildutil.CanonicalDir(ctxt, dir)
+			if dirs[dir] {
+				continue // an alias for an earlier package
+			}
+			dirs[dir] = true
+		}
+		pkgs = append(pkgs, path)
+	}
+	return pkgs, nil
+}
+
+// absPattern converts a relative pattern such as "./..." into one
+// expressed in terms of import paths, using the workspace directory
+// that contains it.  If that directory is itself a workspace root,
+// absPattern also returns the root, to which the pattern is confined.
+func absPattern(ctxt *build.Context, cwd, pattern string) (abs, root string, err error) {
+	if !build.IsLocalImport(pattern) {
+		return pattern, "", nil
+	}
+	i := strings.Index(pattern, "...")
+	if i < 0 {
+		i = len(pattern)
+	}
+	dir := filepath.Join(cwd, filepath.FromSlash(pattern[:i]))
+	for _, root := range ctxt.SrcDirs() {
+		if filepath.Clean(root) == dir {
+			return pattern[i:], root, nil
+		}
+		if rel, ok := buildutil.HasSubdir(ctxt, root, dir); ok {
+			if strings.HasSuffix(pattern[:i], "/") {
+				rel += "/"
+			}
+			return rel + pattern[i:], "", nil
+		}
+	}
+	return "", "", fmt.Errorf("pattern %q: directory %s is outside the workspace", pattern, dir)
+}
+
+// isRootPattern reports whether pattern is a relative pattern whose
+// directory is a workspace root, as defined by absPattern.
+func isRootPattern(ctxt *build.Context, cwd, pattern string) bool {
+	_, root, err := absPattern(ctxt, cwd, pattern)
+	return err == nil && root != ""
+}
+
+// rootContext returns a copy of ctxt whose only source directory is
+// root, one of ctxt.SrcDirs().
+func rootContext(ctxt *build.Context, root string) *build.Context {
+	copy := *ctxt
+	if filepath.Clean(root) == filepath.Join(ctxt.GOROOT, "src") {
+		copy.GOPATH = ""
+	} else {
+		copy.GOROOT = ""
+		copy.GOPATH = filepath.Dir(filepath.Clean(root))
+	}
+	return &copy
+}
+
+// literalPrefix returns the longest import path that is a prefix of
+// every path matched by the absolute pattern, such as "a/b" for
+// "a/b/c..." and "" for "...".
+func literalPrefix(pattern string) string {
+	i := strings.Index(pattern, "...")
+	if i < 0 {
+		return strings.TrimSuffix(pattern, "/")
+	}
+	if j := strings.LastIndex(pattern[:i], "/"); j >= 0 {
+		return pattern[:j]
+	}
+	return ""
+}
+
+// hasGoFiles reports whether the package bp, found by FindPackage,
+// contains any Go files, including tests.  A package that could not
+// be found is assumed to have some, so that the error is reported
+// when it is loaded.
+func hasGoFiles(bp *build.Package, err error) bool {
+	if err != nil {
+		_, ok := err.(*build.NoGoError)
+		return !ok
+	}
+	return len(bp.GoFiles)+len(bp.CgoFiles)+len(bp.TestGoFiles)+len(bp.XTestGoFiles) > 0
+}
+
+// goFilesDir returns the directory of the package bp, found by
+// FindPackage, if known, and whether it contains any Go files, as
+// defined by hasGoFiles.
+func goFilesDir(bp *build.Package, err error) (string, bool) {
+	if !hasGoFiles(bp, err) {
+		return "", false
+	}
+	if bp == nil {
+		return "", true
+	}
+	return bp.Dir, true
+}
+
+// matchPattern returns a predicate that reports whether an import
+// path matches the pattern, as defined by expandPattern.
+func matchPattern(pattern string) func(path string) bool {
+	re := regexp.QuoteMeta(pattern)
+	re = strings.Replace(re, `\.\.\.`, `.*`, -1)
+	// Special case: foo/... matches foo too.
+	if strings.HasSuffix(re, `/.*`) {
+		re = re[:len(re)-len(`/.*`)] + `(/.*)?`
+	}
+	reg := regexp.MustCompile(`^` + re + `$`)
+	vendor := strings.Contains(pattern, "vendor")
+	return func(path string) bool {
+		return (vendor || !isVendored(path)) && reg.MatchString(path)
+	}
+}
+
+// isVendored reports whether the import path denotes a package
+// within a vendor directory.
+func isVendored(path string) bool {
+	return strings.HasPrefix(path, "vendor/") || strings.Contains(path, "/vendor/")
+}
@@ -0,0 +1,399 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines queries that relate source positions, syntax, and
+// the objects of the type checker.
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ObjectAt returns the object denoted by the identifier at pos,
+// whether it is defined or referenced there, and the position of the
+// object's declaration, as reported by Position, or nil and an
+// invalid Position if there is no such identifier.  The path of an
+// import spec denotes the PkgName that the spec declares.
+//
+// It is the core of a "go to definition" query.
+//
+func (prog *Program) ObjectAt(pos token.Pos) (types.Object, token.Position) {
+	info, path, _ := prog.PathEnclosingInterval(pos, pos)
+	if info == nil {
+		return nil, token.Position{}
+	}
+	var obj types.Object
+	if id, ok := path[0].(*ast.Ident); ok {
+		obj = info.ObjectOf(id)
+	} else if spec := enclosingImportSpec(path); spec != nil {
+		if pkgname := importedPkgName(info, spec); pkgname != nil {
+			obj = pkgname
+		}
+	}
+	if obj == nil {
+		return nil, token.Position{}
+	}
+	return obj, prog.Position(obj.Pos())
+}
+
+// enclosingImportSpec returns the import spec that is the innermost
+// or next-to-innermost node of path, or nil.
+func enclosingImportSpec(path []ast.Node) *ast.ImportSpec {
+	if len(path) > 2 {
+		path = path[:2]
+	}
+	for _, n := range path {
+		if spec, ok := n.(*ast.ImportSpec); ok {
+			return spec
+		}
+	}
+	return nil
+}
+
+// PackageOf returns the package and file containing the syntax node n,
+// which must have been obtained from the Program, for example from
+// PathEnclosingInterval or a traversal of PackageInfo.Files, or nil if
+// the node does not belong to any file of the Program.  Nodes are
+// located by position, so n must have a valid position.
+//
+func (prog *Program) PackageOf(n ast.Node) (*PackageInfo, *ast.File) {
+	if fr := prog.fileRangeAt(n.Pos()); fr != nil {
+		return fr.info, fr.file
+	}
+	return nil, nil
+}
+
+// FileOf returns the package, syntax tree, and token.File of the file
+// containing pos, or nils if no file of the Program contains it.
+func (prog *Program) FileOf(pos token.Pos) (*PackageInfo, *ast.File, *token.File) {
+	if fr := prog.fileRangeAt(pos); fr != nil {
+		return fr.info, fr.file, prog.Fset.File(pos)
+	}
+	return nil, nil, nil
+}
+
+// PosOf returns the position in the Program's FileSet of the specified
+// line and column, both 1-based, of the named file, as it would be
+// reported by prog.Position.  The column is measured in bytes.  The
+// file name is interpreted as by PackageForFile; unless
+// Config.PhysicalPositions was set, it may also be a name given by a
+// //line directive, and line and column are then those that the
+// directive assigns.  PosOf returns token.NoPos if there is no such
+// file or position.
+//
+func (prog *Program) PosOf(filename string, line, column int) token.Pos {
+	if line < 1 || column < 1 {
+		return token.NoPos
+	}
+	var files []*token.File
+	if _, f := prog.PackageForFile(filename); f != nil {
+		files = append(files, prog.Fset.File(f.Pos()))
+	}
+	if !prog.physical {
+		files = append(files, prog.lineDirectiveFiles()[filepath.Clean(filename)]...)
+	}
+	for _, tf := range files {
+		if pos := prog.posIn(tf, filename, line, column); pos.IsValid() {
+			return pos
+		}
+	}
+	return token.NoPos
+}
+
+// posIn returns the position within tf of the line and column of the
+// named file, as for PosOf, or token.NoPos.
+func (prog *Program) posIn(tf *token.File, filename string, line, column int) token.Pos {
+	if prog.physical {
+		if line > tf.LineCount() {
+			return token.NoPos
+		}
+		offset := tf.Offset(tf.LineStart(line)) + column - 1
+		if offset > tf.Size() || tf.PositionFor(tf.Pos(offset), false).Line != line {
+			return token.NoPos
+		}
+		return tf.Pos(offset)
+	}
+
+	// Find the physical line on which the logical one starts.
+	// A //line directive without a column makes logical columns
+	// unknown (zero); physical ones are used instead.
+	filename = filepath.Clean(filename)
+	logical := func(pos token.Pos) token.Position {
+		posn := tf.PositionFor(pos, true)
+		if posn.Column == 0 {
+			posn.Column = tf.PositionFor(pos, false).Column
+		}
+		return posn
+	}
+	for l := 1; l <= tf.LineCount(); l++ {
+		start := tf.LineStart(l)
+		posn := logical(start)
+		if posn.Line != line || filepath.Clean(posn.Filename) != filename {
+			continue
+		}
+		offset := tf.Offset(start) + column - posn.Column
+		if offset < tf.Offset(start) || offset > tf.Size() {
+			continue
+		}
+		pos := tf.Pos(offset)
+		if posn := logical(pos); posn.Line == line && posn.Column == column && filepath.Clean(posn.Filename) == filename {
+			return pos
+		}
+	}
+	return token.NoPos
+}
+
+// lineDirectiveFiles returns the index of files by the names given
+// by their //line directives, building it if necessary.  Only
+// directives that take effect at the start of a line are indexed.
+func (prog *Program) lineDirectiveFiles() map[string][]*token.File {
+	prog.lineFilesOnce.Do(func() {
+		index := make(map[string][]*token.File)
+		for _, fr := range prog.fileRanges() {
+			tf := prog.Fset.File(fr.start)
+			seen := map[string]bool{filepath.Clean(tf.Name()): true}
+			for l := 1; l <= tf.LineCount(); l++ {
+				name := filepath.Clean(tf.PositionFor(tf.LineStart(l), true).Filename)
+				if !seen[name] {
+					seen[name] = true
+					index[name] = append(index[name], tf)
+				}
+			}
+		}
+		prog.lineFiles = index
+	})
+	return prog.lineFiles
+}
+
+// Position returns the position of pos, which is logical, that is,
+// adjusted by //line directives, unless Config.PhysicalPositions was
+// set.
+//
+func (prog *Program) Position(pos token.Pos) token.Position {
+	return prog.Fset.PositionFor(pos, !prog.physical)
+}
+
+// Positions returns both the physical position of pos within its file
+// as read and its logical position, adjusted by //line directives.
+// They differ only in files containing such directives.
+//
+func (prog *Program) Positions(pos token.Pos) (physical, logical token.Position) {
+	return prog.Fset.PositionFor(pos, false), prog.Fset.PositionFor(pos, true)
+}
+
+// fileRangeAt returns the first entry of the position index whose file
+// contains pos, or nil.
+func (prog *Program) fileRangeAt(pos token.Pos) *fileRange {
+	index := prog.fileRanges()
+	i := sort.Search(len(index), func(i int) bool { return index[i].end > pos })
+	if i < len(index) && index[i].start <= pos {
+		return &index[i]
+	}
+	return nil
+}
+
+// ReferencesTo returns the identifiers throughout the program that
+// refer to obj, including any that define it, ordered by position.
+// All packages are searched, including those augmented by their tests
+// and external test packages.  If Config.IndexReferences was set, the
+// result is obtained from an index, without a search.
+//
+func (prog *Program) ReferencesTo(obj types.Object) []*ast.Ident {
+	if prog.refs != nil {
+		return append([]*ast.Ident(nil), prog.refs[obj]...)
+	}
+	var refs []*ast.Ident
+	for _, info := range prog.AllPackages {
+		for id, o := range info.Defs {
+			if o == obj {
+				refs = append(refs, id)
+			}
+		}
+		for id, o := range info.Uses {
+			if o == obj {
+				refs = append(refs, id)
+			}
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Pos() < refs[j].Pos() })
+	return refs
+}
+
+// Eval returns the type and, if constant, the value of the expression
+// expr, evaluated in the package pkg as if it appeared at pos.  If pos
+// is within a function of pkg, the expression may refer to the local
+// objects in scope there; if pos is token.NoPos, it is evaluated in the
+// package scope.  See types.Eval for details.
+//
+func (prog *Program) Eval(pkg *PackageInfo, pos token.Pos, expr string) (types.TypeAndValue, error) {
+	return types.Eval(prog.Fset, pkg.Pkg, pos, expr)
+}
+
+// Lookup returns the object denoted by a qualified name such as
+// "net/http.Client", "net/http.Client.Do", or "net/http.Request.URL":
+// a package path, then a package-level object, then optionally a field
+// or method of that object if it is a type.  Fields and methods may be
+// promoted through embedded fields, and include those of the pointer
+// type.  Lookup returns nil if the package is not part of the Program
+// or it has no such object.
+//
+func (prog *Program) Lookup(name string) types.Object {
+	// The package path ends at a dot after its last slash; the last
+	// element of the path may itself contain dots, as in "gopkg.in/yaml.v2".
+	var info *PackageInfo
+	var rest string
+	for i := strings.LastIndex(name, "/") + 1; i < len(name); i++ {
+		if name[i] == '.' {
+			if info = prog.Package(name[:i]); info != nil {
+				rest = name[i+1:]
+				break
+			}
+		}
+	}
+	if info == nil {
+		return nil
+	}
+
+	member, sel := rest, ""
+	if i := strings.Index(rest, "."); i >= 0 {
+		member, sel = rest[:i], rest[i+1:]
+	}
+	obj := info.Pkg.Scope().Lookup(member)
+	if obj == nil || sel == "" {
+		return obj
+	}
+	tname, ok := obj.(*types.TypeName)
+	if !ok || strings.Contains(sel, ".") {
+		return nil
+	}
+	obj, _, _ = types.LookupFieldOrMethod(tname.Type(), true, info.Pkg, sel)
+	return obj
+}
+
+// ForEachObject calls f for each identifier that defines an object,
+// and the object it defines, in every package of the Program (see
+// PackageInfo.Defs).  Packages are visited in the order of
+// SortedPackages, and the identifiers of each package in order of
+// position.  Identifiers that define no object, such as package names
+// in package clauses, are skipped.
+//
+func (prog *Program) ForEachObject(f func(info *PackageInfo, id *ast.Ident, obj types.Object)) {
+	for _, info := range prog.SortedPackages() {
+		ids := make([]*ast.Ident, 0, len(info.Defs))
+		for id, obj := range info.Defs {
+			if obj != nil {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i].Pos() < ids[j].Pos() })
+		for _, id := range ids {
+			f(info, id, info.Defs[id])
+		}
+	}
+}
+
+// DocFor returns the comment that documents obj in the syntax of the
+// Program, or nil.  It covers package-level and local functions,
+// types, variables, and constants, methods, and struct fields and
+// interface methods.  For a constant, variable, type, or field with
+// no doc comment of its own, DocFor returns the doc comment of its
+// ungrouped declaration, or failing that its trailing line comment.
+// For a PkgName, DocFor returns the package comment of the imported
+// package, taken from the first of its files that has one.
+//
+// Config.ParserMode must include parser.ParseComments.
+//
+func (prog *Program) DocFor(obj types.Object) *ast.CommentGroup {
+	if pkgname, ok := obj.(*types.PkgName); ok {
+		if info := prog.AllPackages[pkgname.Imported()]; info != nil {
+			for _, f := range info.Files {
+				if f.Doc != nil {
+					return f.Doc
+				}
+			}
+		}
+		return nil
+	}
+
+	_, path, _ := prog.PathEnclosingInterval(obj.Pos(), obj.Pos())
+	for i, n := range path {
+		if _, ok := n.(ast.Expr); ok {
+			continue // e.g. the identifier, or the type of an embedded field
+		}
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			return n.Doc
+		case *ast.Field:
+			if n.Doc != nil {
+				return n.Doc
+			}
+			return n.Comment
+		case *ast.ValueSpec:
+			return specDoc(n.Doc, n.Comment, path[i+1])
+		case *ast.TypeSpec:
+			return specDoc(n.Doc, n.Comment, path[i+1])
+		}
+		return nil
+	}
+	return nil
+}
+
+// specDoc returns the doc comment of a value or type spec, with the
+// specified doc and line comments, whose parent is the declaration
+// decl.
+func specDoc(doc, comment *ast.CommentGroup, decl ast.Node) *ast.CommentGroup {
+	if doc != nil {
+		return doc
+	}
+	if decl, ok := decl.(*ast.GenDecl); ok && !decl.Lparen.IsValid() && decl.Doc != nil {
+		return decl.Doc
+	}
+	return comment
+}
+
+// UnusedObjects returns the unexported package-level constants,
+// variables, functions, and types of the program's packages that are
+// referred to nowhere in the program, including its tests, ordered
+// by package path and position.  The blank identifier, init
+// functions, and the main function of a main package are excluded.
+//
+// References from within an object's own declaration, such as a
+// recursive call, count as uses, as do the receivers of a type's
+// methods.  Only packages loaded from source are considered.
+//
+func (prog *Program) UnusedObjects() []types.Object {
+	used := make(map[types.Object]bool)
+	for _, info := range prog.AllPackages {
+		for _, obj := range info.Uses {
+			used[obj] = true
+		}
+	}
+	var unused []types.Object
+	for _, info := range prog.SortedPackages() {
+		if len(info.Files) == 0 {
+			continue
+		}
+		scope := info.Pkg.Scope()
+		var objs []types.Object
+		for _, name := range scope.Names() {
+			obj := scope.Lookup(name)
+			if obj.Exported() || used[obj] || name == "_" || name == "init" {
+				continue
+			}
+			if _, ok := obj.(*types.Func); ok && name == "main" && info.Pkg.Name() == "main" {
+				continue
+			}
+			objs = append(objs, obj)
+		}
+		sort.Slice(objs, func(i, j int) bool { return objs[i].Pos() < objs[j].Pos() })
+		unused = append(unused, objs...)
+	}
+	return unused
+}
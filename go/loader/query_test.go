@@ -0,0 +1,560 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+var querySources = map[string]map[string]string{
+	"a": {
+		"a.go": `package a
+
+import "b"
+
+type T struct{ f int }
+
+func (t T) M() int { return t.f + b.B }
+`,
+		"a_test.go": `package a
+
+import bb "b"
+
+var _ = T{}.M() + bb.B
+`,
+	},
+	"b": {"b.go": `package b
+
+const B = 1
+`},
+}
+
+// queryProgram loads querySources for position queries.
+func queryProgram(t *testing.T, index bool) *loader.Program {
+	conf := loader.Config{Build: buildutil.FakeContext(querySources), IndexReferences: index}
+	conf.ImportWithTests("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return prog
+}
+
+// posOf returns the position of the nth occurrence (from 1) of
+// substr in the file "pkg/name" of querySources.
+func posOf(t *testing.T, prog *loader.Program, pkg, name, substr string, n int) token.Pos {
+	src := querySources[pkg][name]
+	offset := -1
+	for i := 0; i < n; i++ {
+		j := strings.Index(src[offset+1:], substr)
+		if j < 0 {
+			t.Fatalf("%s/%s has fewer than %d occurrences of %q", pkg, name, n, substr)
+		}
+		offset += j + 1
+	}
+	_, f := prog.PackageForFile("/go/src/" + pkg + "/" + name)
+	if f == nil {
+		t.Fatalf("no file %s/%s", pkg, name)
+	}
+	return prog.Fset.File(f.Pos()).Pos(offset)
+}
+
+func TestObjectAt(t *testing.T) {
+	prog := queryProgram(t, false)
+	for _, test := range []struct {
+		pkg, name, substr string
+		n                 int
+		want              string // object and declaring position, or "nil"
+	}{
+		{"a", "a.go", "T struct", 1, "type a.T struct{f int} a.go:5:6"},
+		{"a", "a.go", "M()", 1, "func (a.T).M() int a.go:7:12"},
+		{"a", "a.go", "f int", 1, "field f int a.go:5:16"},
+		{"a", "a.go", "f +", 1, "field f int a.go:5:16"},
+		{"a", "a.go", "B }", 1, "const b.B untyped int b.go:3:7"},
+		{"a", "a.go", `"b"`, 1, "package b a.go:3:8"},
+		{"a", "a_test.go", "bb ", 1, "package bb (\"b\") a_test.go:3:8"},
+		{"a", "a_test.go", "M()", 1, "func (a.T).M() int a.go:7:12"},
+		{"a", "a.go", "return", 1, "nil"},
+	} {
+		obj, posn := prog.ObjectAt(posOf(t, prog, test.pkg, test.name, test.substr, test.n))
+		got := "nil"
+		if obj != nil {
+			got = fmt.Sprintf("%s %s:%d:%d", obj, posn.Filename[strings.LastIndex(posn.Filename, "/")+1:], posn.Line, posn.Column)
+		}
+		if got != test.want {
+			t.Errorf("ObjectAt(%s %q) = %s, want %s", test.name, test.substr, got, test.want)
+		}
+	}
+}
+
+func TestReferencesTo(t *testing.T) {
+	testReferencesTo(t, false)
+	testReferencesTo(t, true)
+}
+
+func testReferencesTo(t *testing.T, index bool) {
+	prog := queryProgram(t, index)
+	for _, test := range []struct {
+		pkg, name, substr string
+		want              string // positions of references
+	}{
+		{"a", "a.go", "T struct", "a.go:5:6 a.go:7:9 a_test.go:5:9"},
+		{"a", "a.go", "M()", "a.go:7:12 a_test.go:5:13"},
+		{"a", "a.go", "t T", "a.go:7:7 a.go:7:29"},
+		{"b", "b.go", "B =", "a.go:7:37 b.go:3:7 a_test.go:5:22"},
+	} {
+		obj, _ := prog.ObjectAt(posOf(t, prog, test.pkg, test.name, test.substr, 1))
+		if obj == nil {
+			t.Errorf("no object at %s %q", test.name, test.substr)
+			continue
+		}
+		var got []string
+		for _, id := range prog.ReferencesTo(obj) {
+			posn := prog.Fset.Position(id.Pos())
+			got = append(got, fmt.Sprintf("%s:%d:%d", posn.Filename[strings.LastIndex(posn.Filename, "/")+1:], posn.Line, posn.Column))
+		}
+		if s := strings.Join(got, " "); s != test.want {
+			t.Errorf("ReferencesTo(%s) [index=%t] = %s, want %s", obj, index, s, test.want)
+		}
+	}
+}
+
+func TestPackageOf(t *testing.T) {
+	prog := queryProgram(t, false)
+	for _, info := range prog.AllPackages {
+		for _, f := range info.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				if n == nil || !n.Pos().IsValid() {
+					return true
+				}
+				if gotInfo, gotFile := prog.PackageOf(n); gotInfo != info || gotFile != f {
+					t.Errorf("PackageOf(%T at %s) = %v, %p; want %v, %p",
+						n, prog.Fset.Position(n.Pos()), gotInfo, gotFile, info, f)
+				}
+				return true
+			})
+		}
+	}
+	if info, f := prog.PackageOf(&ast.Ident{}); info != nil || f != nil {
+		t.Errorf("PackageOf(foreign node) = %v, %v; want nil", info, f)
+	}
+}
+
+func TestFileOfAndPosOf(t *testing.T) {
+	prog := queryProgram(t, false)
+	pos := posOf(t, prog, "a", "a_test.go", "bb.B", 1)
+	info, f, tf := prog.FileOf(pos)
+	if info != prog.Imported["a"] || f == nil || tf == nil || tf.Name() != "/go/src/a/a_test.go" || prog.Fset.File(f.Pos()) != tf {
+		t.Fatalf("FileOf = %v, %v, %v", info, f, tf)
+	}
+	if info, f, tf := prog.FileOf(token.NoPos); info != nil || f != nil || tf != nil {
+		t.Errorf("FileOf(NoPos) = %v, %v, %v; want nils", info, f, tf)
+	}
+
+	posn := prog.Fset.Position(pos)
+	if got := prog.PosOf(posn.Filename, posn.Line, posn.Column); got != pos {
+		t.Errorf("PosOf(%s) = %d, want %d", posn, got, pos)
+	}
+	for _, test := range []struct {
+		filename     string
+		line, column int
+		want         string // position, or "-"
+	}{
+		{"/go/src/a/a.go", 1, 1, "/go/src/a/a.go:1:1"},
+		{"/go/src/a/a.go", 7, 6, "/go/src/a/a.go:7:6"},
+		{"/go/src/a/a.go", 7, 40, "/go/src/a/a.go:7:40"}, // newline
+		{"/go/src/a/a.go", 7, 41, "/go/src/a/a.go:7:41"}, // EOF
+		{"/go/src/a/a.go", 7, 42, "-"},
+		{"/go/src/a/a.go", 6, 2, "-"},
+		{"/go/src/a/a.go", 2, 1, "/go/src/a/a.go:2:1"}, // empty line
+		{"/go/src/a/a.go", 2, 2, "-"},
+		{"/go/src/a/a.go", 9, 1, "-"},
+		{"/go/src/a/a.go", 0, 1, "-"},
+		{"/go/src/a/nonesuch.go", 1, 1, "-"},
+	} {
+		got := "-"
+		if pos := prog.PosOf(test.filename, test.line, test.column); pos.IsValid() {
+			got = prog.Fset.Position(pos).String()
+		}
+		if got != test.want {
+			t.Errorf("PosOf(%s, %d, %d) = %s, want %s", test.filename, test.line, test.column, got, test.want)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	prog := queryProgram(t, false)
+	a := prog.Imported["a"]
+	for _, test := range []struct {
+		pos  token.Pos
+		expr string
+		want string // type and value, or "error"
+	}{
+		{token.NoPos, "T{}.M()", "int"},
+		{token.NoPos, "b.B", "error"}, // imports are file-scoped
+		{posOf(t, prog, "a", "a.go", "return", 1), "t.f", "int"},
+		{posOf(t, prog, "a", "a.go", "return", 1), "b.B + 1", "untyped int 2"},
+		{posOf(t, prog, "a", "a_test.go", "bb.B", 1), "bb.B", "untyped int 1"},
+		{posOf(t, prog, "a", "a_test.go", "bb.B", 1), "b.B", "error"},
+		{token.NoPos, "t.f", "error"},
+	} {
+		tv, err := prog.Eval(a, test.pos, test.expr)
+		var got string
+		if err != nil {
+			got = "error"
+		} else {
+			got = tv.Type.String()
+			if tv.Value != nil {
+				got += " " + tv.Value.String()
+			}
+		}
+		if got != test.want {
+			t.Errorf("Eval(%q) = %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a
+type T struct{ U; f int }
+func (*T) M() {}
+type U struct{ g int }
+func (U) N() {}
+var V T`,
+		"b.v2": `package b
+type T struct{}
+func (T) M() {}`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	conf.Import("b.v2")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, test := range []struct {
+		name, want string // want is "nil" for no object
+	}{
+		{"a.T", "type a.T struct{a.U; f int}"},
+		{"a.T.M", "func (*a.T).M()"},
+		{"a.T.N", "func (a.U).N()"},
+		{"a.T.f", "field f int"},
+		{"a.T.g", "field g int"},
+		{"a.V", "var a.V a.T"},
+		{"a.V.f", "nil"},
+		{"a.T.f.x", "nil"},
+		{"a.T.nonesuch", "nil"},
+		{"a.nonesuch", "nil"},
+		{"a", "nil"},
+		{"nonesuch.T", "nil"},
+		{"b.v2.T", "type b.v2.T struct{}"},
+		{"b.v2.T.M", "func (b.v2.T).M()"},
+		{"b.T", "nil"},
+	} {
+		got := "nil"
+		if obj := prog.Lookup(test.name); obj != nil {
+			got = obj.String()
+		}
+		if got != test.want {
+			t.Errorf("Lookup(%q) = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestForEachObject(t *testing.T) {
+	prog := queryProgram(t, false)
+	var got []string
+	prog.ForEachObject(func(info *loader.PackageInfo, id *ast.Ident, obj types.Object) {
+		if info.Defs[id] != obj || id.Name != obj.Name() {
+			t.Errorf("inconsistent callback for %s", id.Name)
+		}
+		posn := prog.Fset.Position(id.Pos())
+		got = append(got, fmt.Sprintf("%s %s:%d", obj.Name(), posn.Filename[strings.LastIndex(posn.Filename, "/")+1:], posn.Line))
+	})
+	want := "T a.go:5 f a.go:5 t a.go:7 M a.go:7 bb a_test.go:3 _ a_test.go:5 B b.go:3"
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("ForEachObject visited %s, want %s", s, want)
+	}
+}
+
+func TestLineDirectives(t *testing.T) {
+	const src = `package g
+
+//line /gen/gen.y:10:1
+var X = 1
+var Y = 2
+`
+	for _, physical := range []bool{false, true} {
+		conf := loader.Config{
+			Build:             buildutil.FakeContext(map[string]map[string]string{"g": {"g.go": src}}),
+			PhysicalPositions: physical,
+		}
+		conf.Import("g")
+		prog, err := conf.Load()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		f := prog.Imported["g"].Files[0]
+		pos := prog.Fset.File(f.Pos()).Pos(strings.Index(src, "Y"))
+
+		phys, logical := prog.Positions(pos)
+		if got := phys.String(); got != "/go/src/g/g.go:5:5" {
+			t.Errorf("physical position = %s", got)
+		}
+		if got := logical.String(); got != "/gen/gen.y:11:5" {
+			t.Errorf("logical position = %s", got)
+		}
+		want, other := logical, phys
+		if physical {
+			want, other = phys, logical
+		}
+		if got := prog.Position(pos); got != want {
+			t.Errorf("Position [physical=%t] = %s, want %s", physical, got, want)
+		}
+		if _, got := prog.ObjectAt(pos); got != want {
+			t.Errorf("ObjectAt [physical=%t] = %s, want %s", physical, got, want)
+		}
+		if got := prog.PosOf(want.Filename, want.Line, want.Column); got != pos {
+			t.Errorf("PosOf(%s) [physical=%t] = %s, want %s", want, physical, prog.Fset.Position(got), want)
+		}
+		if got := prog.PosOf(other.Filename, other.Line, other.Column); got.IsValid() {
+			t.Errorf("PosOf(%s) [physical=%t] = %s, want NoPos", other, physical, prog.Fset.Position(got))
+		}
+		// The logical line, in the file as read, is not a position.
+		if got := prog.PosOf("/go/src/g/g.go", logical.Line, logical.Column); got.IsValid() {
+			t.Errorf("PosOf(g.go:%d:%d) [physical=%t] = %s, want NoPos", logical.Line, logical.Column, physical, prog.Fset.Position(got))
+		}
+	}
+}
+
+func TestLineDirectiveErrors(t *testing.T) {
+	const src = `package g
+
+//line gen.y:100
+var X int = "x"
+`
+	for _, physical := range []bool{false, true} {
+		conf := loader.Config{
+			Build:             buildutil.FakeContext(map[string]map[string]string{"g": {"g.go": src}}),
+			PhysicalPositions: physical,
+			AllowErrors:       true,
+		}
+		conf.Import("g")
+
+		// Capture the errors printed by the default handler.
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		stderr := os.Stderr
+		os.Stderr = w
+		_, err = conf.Load()
+		os.Stderr = stderr
+		w.Close()
+		out, _ := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+
+		want := "/go/src/g/gen.y:100: "
+		if physical {
+			want = "/go/src/g/g.go:4:13: "
+		}
+		if !strings.HasPrefix(string(out), want) {
+			t.Errorf("printed error [physical=%t] = %q, want prefix %q", physical, out, want)
+		}
+	}
+}
+
+func TestDocFor(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `// Package a is documented.
+package a
+
+// F is a function.
+func F() {
+	// x is local.
+	var x int
+	y := x // not documented
+	_ = y
+}
+
+// T is a type.
+type T struct {
+	// f is a field.
+	f int
+	g int // g has a line comment.
+	*S
+}
+
+type S struct{}
+
+// M is a method.
+func (*T) M() {}
+
+// Values are grouped.
+const (
+	// A is documented.
+	A = 1
+	B = 2 // B has a line comment.
+	C = 3
+)
+
+// V is ungrouped.
+var V int
+
+// U is an interface.
+type U interface {
+	// N is an interface method.
+	N()
+}
+`,
+		"b": `package b; import "a"; var _ a.T`,
+	})
+	conf := loader.Config{Build: ctxt, ParserMode: parser.ParseComments}
+	conf.Import("b")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	a := prog.Package("a").Pkg
+	T := a.Scope().Lookup("T").Type()
+	U := a.Scope().Lookup("U").Type()
+	field := func(name string) types.Object {
+		obj, _, _ := types.LookupFieldOrMethod(T, true, a, name)
+		return obj
+	}
+	local := func(name string) types.Object {
+		for id, obj := range prog.Package("a").Defs {
+			if id.Name == name {
+				return obj
+			}
+		}
+		return nil
+	}
+	for _, test := range []struct {
+		obj  types.Object
+		want string // text of the comment, or "nil"
+	}{
+		{a.Scope().Lookup("F"), "F is a function."},
+		{local("x"), "x is local."},
+		{local("y"), "nil"},
+		{a.Scope().Lookup("T"), "T is a type."},
+		{field("f"), "f is a field."},
+		{field("g"), "g has a line comment."},
+		{field("S"), "nil"},
+		{field("M"), "M is a method."},
+		{a.Scope().Lookup("A"), "A is documented."},
+		{a.Scope().Lookup("B"), "B has a line comment."},
+		{a.Scope().Lookup("C"), "nil"},
+		{a.Scope().Lookup("V"), "V is ungrouped."},
+		{types.NewMethodSet(U).At(0).Obj(), "N is an interface method."},
+		{prog.Package("b").Info.Implicits[prog.Package("b").Files[0].Imports[0]], "Package a is documented."},
+	} {
+		got := "nil"
+		if doc := prog.DocFor(test.obj); doc != nil {
+			got = strings.TrimSpace(doc.Text())
+		}
+		if got != test.want {
+			t.Errorf("DocFor(%s) = %q, want %q", test.obj, got, test.want)
+		}
+	}
+}
+
+func TestUnusedObjects(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {
+			"a.go": `package a
+import "b"
+const c, d = 1, 2
+var v = c
+func init() {}
+func f() { f() }
+func g() {}
+type t struct{}
+func (t) m() {}
+type u int
+var Exported = b.B
+`,
+			"a_test.go": `package a
+var _ = g
+func h() {}
+`,
+		},
+		"b":    {"b.go": `package b; const B, b = 1, 2`},
+		"main": {"main.go": `package main; func main() {}; func unused() {}`},
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.ImportWithTests("a")
+	conf.Import("main")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var got []string
+	for _, obj := range prog.UnusedObjects() {
+		got = append(got, obj.Pkg().Path()+"."+obj.Name())
+	}
+	want := "a.d a.v a.u a.h b.b main.unused" // f calls itself
+	if s := strings.Join(got, " "); s != want {
+		t.Errorf("UnusedObjects() = %s, want %s", s, want)
+	}
+}
+
+// TestConcurrentQueries checks that the queries of a fresh Program,
+// some of which build indexes lazily, may be made concurrently.
+// It is most useful with -race.
+func TestConcurrentQueries(t *testing.T) {
+	prog := queryProgram(t, false)
+	pos := posOf(t, prog, "a", "a.go", "f +", 1)
+
+	summary := func() string {
+		var buf bytes.Buffer
+		obj, posn := prog.ObjectAt(pos)
+		fmt.Fprintf(&buf, "%s %s\n", obj, posn)
+		fmt.Fprintf(&buf, "%d refs\n", len(prog.ReferencesTo(obj)))
+		_, path, _ := prog.PathEnclosingInterval(pos, pos)
+		fmt.Fprintf(&buf, "%d enclosing\n", len(path))
+		fmt.Fprintf(&buf, "%d unused\n", len(prog.UnusedObjects()))
+		if err := prog.WriteXRefs(&buf); err != nil {
+			t.Error(err)
+		}
+		return buf.String()
+	}
+
+	const n = 8
+	results := make([]string, n)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = summary()
+		}(i)
+	}
+	wg.Wait()
+
+	want := summary()
+	for i, got := range results {
+		if got != want {
+			t.Errorf("concurrent query %d = %s, want %s", i, got, want)
+		}
+	}
+}
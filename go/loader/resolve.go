@@ -0,0 +1,255 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines Resolve, which locates the packages that Load
+// would process without parsing or type-checking them.
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+// A ResolvedPackage describes a package that Load would process.
+type ResolvedPackage struct {
+	Path       string         // package path; for a created package, as by Load
+	Dir        string         // package directory
+	Initial    bool           // package is an initial package
+	Tests      bool           // tests of the package would be loaded
+	Binary     bool           // package would be imported from export data
+	Files      []string       // names of the package's Go and cgo files
+	TestFiles  []string       // names of in-package test files, if Tests
+	XTestFiles []string       // names of external test files, if Tests
+	Errors     []error        // errors locating the package or its files
+	Build      *build.Package // go/build description; nil for created packages
+}
+
+// Resolve performs only the first phase of Load: it locates the
+// initial packages and their transitive dependencies using go/build,
+// but neither parses nor type-checks them, except that the import
+// declarations of created packages are read.  It is much faster than
+// Load, and useful for validating arguments or for integration with
+// a build system.
+//
+// The result contains the Created packages, one per CreatePkgs entry
+// or, with SplitCreatePkgs, one per part of an entry, in order,
+// followed by all other packages ordered by path.
+// Dependencies of packages imported from export data are not
+// included, since Load does not load them from source.  A package
+// that could not be found has a non-empty Errors field.
+//
+// Unlike Load, Resolve does not modify conf.  It returns an error
+// only if the configuration itself is invalid.
+//
+func (conf *Config) Resolve() ([]*ResolvedPackage, error) {
+	c := *conf // copy
+	imp, err := c.newImporter()
+	if err != nil {
+		return nil, err
+	}
+	ctxt := c.build()
+
+	type edge struct{ path, fromDir string }
+	var queue []edge
+	addImports := func(imports []string, fromDir string) {
+		for _, path := range imports {
+			if path != "C" {
+				queue = append(queue, edge{path, fromDir})
+			}
+		}
+	}
+	join := func(dir string, names []string) []string {
+		var res []string
+		for _, name := range names {
+			if !buildutil.IsAbsPath(ctxt, name) {
+				name = buildutil.JoinPath(ctxt, dir, name)
+			}
+			res = append(res, name)
+		}
+		return res
+	}
+
+	// The files parsed here are recorded in a FileSet of our own;
+	// those of PkgSpec.Files are in c.Fset.
+	fset := token.NewFileSet()
+	parsed := make(map[*ast.File]bool)
+	dirOf := func(f *ast.File) string {
+		if parsed[f] {
+			return fileDir(fset, f)
+		}
+		return fileDir(c.Fset, f)
+	}
+
+	// The sources of a synthetic package have no directory.
+	addSource := func(rp *ResolvedPackage) {
+		src := imp.source(rp.Path)
+		if src == nil {
+			return
+		}
+		var names []string
+		for name := range src {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var files []*ast.File
+		for _, name := range names {
+			f, err := parser.ParseFile(fset, name, src[name], parser.ImportsOnly)
+			if f != nil {
+				files = append(files, f)
+			}
+			if err != nil {
+				rp.Errors = append(rp.Errors, err)
+			}
+		}
+		rp.Files = names
+		var imports []string
+		for path := range scanImports(files) {
+			imports = append(imports, path)
+		}
+		sort.Strings(imports)
+		addImports(imports, "")
+	}
+
+	// Initial packages are always loaded from source,
+	// so identify them all before their dependencies.
+	importPkgs := imp.localizeDirs(imp.expandPatterns(c.ImportPkgs))
+
+	// Created packages.
+	var created []*ResolvedPackage
+	for _, cp := range c.CreatePkgs {
+		filenames, errs := expandFilenames(ctxt, c.Cwd, cp.Filenames)
+		filenames, _ = dedupFilenames(ctxt, c.Cwd, filenames)
+		files, parseErrs := parseFiles(fset, ctxt, nil, c.Cwd, filenames, parser.ImportsOnly, &c.Limits, c.Preprocess, nil)
+		errs = append(errs, parseErrs...)
+		for _, f := range files {
+			parsed[f] = true
+		}
+		files = append(files, cp.Files...)
+
+		parts := [][]*ast.File{files}
+		if c.SplitCreatePkgs && len(files) > 1 {
+			parts = splitFiles(files, dirOf)
+		}
+		for _, files := range parts {
+			rp := &ResolvedPackage{Path: cp.Path, Dir: c.Cwd, Initial: true, Errors: errs}
+			if len(parts) > 1 {
+				for _, f := range files {
+					if parsed[f] {
+						rp.Files = append(rp.Files, fset.File(f.Pos()).Name())
+					}
+				}
+			} else {
+				rp.Files = join(c.Cwd, filenames)
+			}
+			if len(files) > 0 {
+				if dir := dirOf(files[0]); dir != "" {
+					rp.Dir = dir
+				}
+			}
+			if len(parts) > 1 && len(files) > 0 {
+				rp.Path = files[0].Name.Name
+				if cp.Path != "" {
+					rp.Path = cp.Path + "/" + rp.Path
+				}
+				if _, ok := importPkgs[rp.Path]; !ok && imp.splitParts[rp.Path] == nil {
+					// Imports of this path denote the part.
+					imp.splitParts[rp.Path] = &createPart{path: rp.Path, dir: rp.Dir, files: files, importable: true}
+					imp.initial[rp.Path] = true
+				}
+			} else if rp.Path == "" {
+				if len(files) > 0 {
+					rp.Path = files[0].Name.Name
+				} else {
+					rp.Path = "(unnamed)"
+				}
+			}
+			var imports []string
+			for path := range scanImports(files) {
+				imports = append(imports, path)
+			}
+			sort.Strings(imports)
+			addImports(imports, rp.Dir)
+			created = append(created, rp)
+			errs = nil // report I/O and parse errors only once
+		}
+	}
+
+	var paths []string
+	for path := range importPkgs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	resolved := make(map[string]*ResolvedPackage)
+	var initial []*ResolvedPackage
+	for _, path := range paths {
+		// No vendor check on packages imported from the command line.
+		bp, err := imp.findPackage(path, c.Cwd, ignoreVendor)
+		if err != nil {
+			resolved[path] = &ResolvedPackage{Path: path, Initial: true, Errors: []error{err}}
+			continue
+		}
+		rp := resolved[bp.ImportPath]
+		if rp == nil {
+			rp = &ResolvedPackage{Path: bp.ImportPath, Dir: bp.Dir, Initial: true, Build: bp}
+			resolved[bp.ImportPath] = rp
+			initial = append(initial, rp)
+			imp.initial[bp.ImportPath] = true
+		}
+		rp.Tests = rp.Tests || importPkgs[path]
+	}
+	for _, rp := range initial {
+		bp := rp.Build
+		if bp.ImportPath != "unsafe" {
+			rp.Files = append(join(bp.Dir, bp.GoFiles), join(bp.Dir, bp.CgoFiles)...)
+		}
+		addImports(bp.Imports, bp.Dir)
+		addSource(rp)
+		if rp.Tests {
+			rp.TestFiles = join(bp.Dir, bp.TestGoFiles)
+			rp.XTestFiles = join(bp.Dir, bp.XTestGoFiles)
+			addImports(bp.TestImports, bp.Dir)
+			addImports(bp.XTestImports, bp.Dir)
+		}
+	}
+
+	// Dependencies, breadth first.
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+		bp, err := imp.findPackage(e.path, e.fromDir, 0)
+		if err != nil {
+			if resolved[e.path] == nil {
+				resolved[e.path] = &ResolvedPackage{Path: e.path, Errors: []error{err}}
+			}
+			continue
+		}
+		if resolved[bp.ImportPath] != nil || imp.splitParts[bp.ImportPath] != nil {
+			continue // already resolved, or a created package
+		}
+		rp := &ResolvedPackage{Path: bp.ImportPath, Dir: bp.Dir, Build: bp}
+		resolved[bp.ImportPath] = rp
+		if imp.fromBinary(bp) {
+			rp.Binary = true
+			continue
+		}
+		if bp.ImportPath != "unsafe" {
+			rp.Files = append(join(bp.Dir, bp.GoFiles), join(bp.Dir, bp.CgoFiles)...)
+		}
+		addImports(bp.Imports, bp.Dir)
+		addSource(rp)
+	}
+
+	var others []*ResolvedPackage
+	for _, rp := range resolved {
+		others = append(others, rp)
+	}
+	sort.Slice(others, func(i, j int) bool { return others[i].Path < others[j].Path })
+	return append(created, others...), nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/build"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestResolve(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {
+			"a.go":      `package a; import _ "b"`,
+			"a_test.go": `package a; import _ "c"`,
+			"x_test.go": `package a_test; import _ "d"`,
+		},
+		"b": {"b.go": `package b; import _ "e"`},
+		"c": {"c.go": `package c`},
+		"d": {"d.go": `package d; import _ "missing"`},
+		"e": {"e.go": `package e`},
+		"f": {"f.go": `package f; import _ "g"`},
+		"g": {"g.go": `package g`},
+	})
+	conf := loader.Config{
+		Build:            ctxt,
+		Cwd:              "/go/src",
+		ImportFromBinary: func(path string) bool { return path == "b" },
+	}
+	conf.ImportWithTests("a")
+	conf.CreateFromFilenames("", "/go/src/f/*.go")
+	pkgs, err := conf.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, p := range pkgs {
+		fmt.Fprintf(&buf, "%s initial=%t tests=%t binary=%t files=%s tests=%s xtests=%s errors=%d\n",
+			p.Path, p.Initial, p.Tests, p.Binary, p.Files, p.TestFiles, p.XTestFiles, len(p.Errors))
+	}
+	want := `f initial=true tests=false binary=false files=[/go/src/f/f.go] tests=[] xtests=[] errors=0
+a initial=true tests=true binary=false files=[/go/src/a/a.go] tests=[/go/src/a/a_test.go] xtests=[/go/src/a/x_test.go] errors=0
+b initial=false tests=false binary=true files=[] tests=[] xtests=[] errors=0
+c initial=false tests=false binary=false files=[/go/src/c/c.go] tests=[] xtests=[] errors=0
+d initial=false tests=false binary=false files=[/go/src/d/d.go] tests=[] xtests=[] errors=0
+g initial=false tests=false binary=false files=[/go/src/g/g.go] tests=[] xtests=[] errors=0
+missing initial=false tests=false binary=false files=[] tests=[] xtests=[] errors=1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Resolve:\n%s\nwant:\n%s", got, want)
+	}
+	if conf.FindPackage != nil {
+		t.Errorf("Resolve modified the Config")
+	}
+}
+
+func TestResolveExpandTemplate(t *testing.T) {
+	conf := loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {"p.go": `package p; import _ "list/of/string"`},
+			"q": {"q.go": `package q`},
+		}),
+		ExpandTemplate: func(ctxt *build.Context, path string) (map[string]string, error) {
+			if path != "list/of/string" {
+				return nil, nil
+			}
+			return map[string]string{"list.go": `package list; import _ "q"`}, nil
+		},
+	}
+	conf.Import("p")
+	pkgs, err := conf.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, p := range pkgs {
+		fmt.Fprintf(&buf, "%s files=%s errors=%d\n", p.Path, p.Files, len(p.Errors))
+	}
+	want := `list/of/string files=[list.go] errors=0
+p files=[/go/src/p/p.go] errors=0
+q files=[/go/src/q/q.go] errors=0
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Resolve:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestResolveSplitCreatePkgs(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"gen": {
+			"a.go": `package a; import _ "b"`,
+			"b.go": `package b; import _ "c"`,
+		},
+		"c": {"c.go": `package c`},
+	})
+	conf := loader.Config{Build: ctxt, Cwd: "/go/src", SplitCreatePkgs: true}
+	conf.CreateFromFilenames("", "/go/src/gen/a.go", "/go/src/gen/b.go")
+	pkgs, err := conf.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, p := range pkgs {
+		fmt.Fprintf(&buf, "%s initial=%t files=%s errors=%d\n", p.Path, p.Initial, p.Files, len(p.Errors))
+	}
+	want := `a initial=true files=[/go/src/gen/a.go] errors=0
+b initial=true files=[/go/src/gen/b.go] errors=0
+c initial=false files=[/go/src/c/c.go] errors=0
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Resolve:\n%s\nwant:\n%s", got, want)
+	}
+}
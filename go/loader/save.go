@@ -0,0 +1,299 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the serialization of a Program.
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+
+	"golang.org/x/tools/go/gcexportdata"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// savedVersion identifies the format written by Program.Save.
+const savedVersion = "go/loader saved program, version 2"
+
+// The saved form of a Program is a gob-encoded savedProgram.
+type savedProgram struct {
+	Version  string
+	Packages []savedPackage // in dependency order
+}
+
+type savedPackage struct {
+	Path, Name            string
+	Importable            bool
+	Imported              bool // in Program.Imported
+	Created               int  // 1 + index in Program.Created, or 0
+	TransitivelyErrorFree bool
+	Errors                []savedError
+	Imports               []int // indices of imported packages, as by ImportGraph
+	NonTestImports        []int // indices of imported packages, ignoring test files
+	Export                []byte
+	Files                 []savedFile
+}
+
+type savedFile struct {
+	Name string
+	Src  []byte
+}
+
+// A savedError is an error of a package.  Type and syntax errors keep
+// their positions, so that LoadSaved can restore them as such.
+type savedError struct {
+	Text string            // the message of the error, as by Error
+	Kind byte              // 't' for types.Error, 'l' for scanner.ErrorList, 's' for *scanner.Error, or 0
+	Msg  string            // of a types.Error
+	Soft bool              // of a types.Error
+	Posn token.Position    // of a types.Error, unadjusted by //line directives
+	List scanner.ErrorList // of a scanner.ErrorList, or the *scanner.Error
+}
+
+// savedEdges holds the import edges of a package restored by LoadSaved.
+type savedEdges struct {
+	all, nonTest []*PackageInfo
+}
+
+// Save writes to w a compact binary representation of the Program:
+// the type information of each package, in export data form, the
+// import graph, the lists of initial packages, and the errors of each
+// package.  If syntax is set, Save also writes the source of each
+// file, so that LoadSaved can restore the syntax trees.  This requires
+// the source retained by Load if Config.KeepSource is set; files that
+// were not parsed by the loader, such as those of ExtraFiles and
+// cgo files, cannot be saved.
+//
+// The types.Info maps of the packages are not saved, since they refer
+// to syntax; a client that needs them must load the packages again.
+//
+// Save fails if type information cannot be exported, for example
+// because of errors.
+//
+func (prog *Program) Save(w io.Writer, syntax bool) error {
+	order, err := prog.TopoSort()
+	if err != nil {
+		return err
+	}
+	sorted := prog.SortedPackages()
+	index := sortedIndex(sorted)
+	pos := make(map[*PackageInfo]int) // position in order
+	for i, info := range order {
+		pos[info] = i
+	}
+	indices := func(infos []*PackageInfo) []int {
+		res := make([]int, len(infos))
+		for i, info := range infos {
+			res[i] = pos[info]
+		}
+		return res
+	}
+	created := make(map[*PackageInfo]int)
+	for i, info := range prog.Created {
+		created[info] = i + 1
+	}
+
+	saved := savedProgram{Version: savedVersion}
+	for _, info := range order {
+		p := savedPackage{
+			Path:                  info.Pkg.Path(),
+			Name:                  info.Pkg.Name(),
+			Importable:            info.Importable,
+			Imported:              prog.Imported[info.Pkg.Path()] == info,
+			Created:               created[info],
+			TransitivelyErrorFree: info.TransitivelyErrorFree,
+			Imports:               indices(prog.imports(info, index, true)),
+			NonTestImports:        indices(prog.imports(info, index, false)),
+		}
+		for _, err := range info.Errors {
+			p.Errors = append(p.Errors, prog.saveError(err))
+		}
+		var buf bytes.Buffer
+		if err := gcexportdata.Write(&buf, prog.Fset, info.Pkg); err != nil {
+			return fmt.Errorf("saving %s: %v", info, err)
+		}
+		p.Export = buf.Bytes()
+		if syntax {
+			for _, f := range info.Files {
+				name := prog.Fset.File(f.Pos()).Name()
+				src, ok := prog.sources[f]
+				if !ok {
+					return fmt.Errorf("saving %s: source of %s was not retained", info, name)
+				}
+				p.Files = append(p.Files, savedFile{name, src})
+			}
+		}
+		saved.Packages = append(saved.Packages, p)
+	}
+	return gob.NewEncoder(w).Encode(&saved)
+}
+
+// saveError returns the saved form of err.
+func (prog *Program) saveError(err error) savedError {
+	e := savedError{Text: err.Error()}
+	switch err := err.(type) {
+	case types.Error:
+		if err.Fset != nil {
+			e.Kind, e.Msg, e.Soft = 't', err.Msg, err.Soft
+			e.Posn = err.Fset.PositionFor(err.Pos, false)
+		}
+	case scanner.ErrorList:
+		e.Kind, e.List = 'l', err
+	case *scanner.Error:
+		e.Kind, e.List = 's', scanner.ErrorList{err}
+	}
+	return e
+}
+
+// LoadSaved reads a Program written by Program.Save.
+//
+// The restored Program has the same packages, initial packages, and
+// import graph as the saved one, and its packages have the saved type
+// information and errors, but their types.Info maps are empty, as they
+// are not saved.  Syntax errors are restored as scanner errors, and,
+// if syntax was saved, type errors as types.Error values whose
+// positions are within the restored syntax; other errors are restored
+// as messages alone.
+//
+// If syntax was saved, each package has syntax trees, parsed (with
+// comments) from the saved source but not type-checked.  Since the
+// source is that of the original files, the syntax has the same
+// line and column positions as that of the saved Program, and as the
+// objects of the type information, though in a new FileSet.
+//
+func LoadSaved(r io.Reader) (*Program, error) {
+	var saved savedProgram
+	if err := gob.NewDecoder(r).Decode(&saved); err != nil {
+		return nil, fmt.Errorf("reading saved program: %v", err)
+	}
+	if saved.Version != savedVersion {
+		return nil, fmt.Errorf("reading saved program: unknown version %q", saved.Version)
+	}
+
+	prog := &Program{
+		Fset:         token.NewFileSet(),
+		Imported:     make(map[string]*PackageInfo),
+		importMap:    make(map[string]*types.Package),
+		AllPackages:  make(map[*types.Package]*PackageInfo),
+		MethodSets:   new(typeutil.MethodSetCache),
+		savedImports: make(map[*PackageInfo]savedEdges),
+		sources:      make(map[*ast.File][]byte),
+	}
+	imports := make(map[string]*types.Package) // shared by all importable packages
+	infos := make([]*PackageInfo, len(saved.Packages))
+	created := make(map[int]*PackageInfo)
+	for i, p := range saved.Packages {
+		m := imports
+		if !p.Importable {
+			// A created or test package may have the path of
+			// another package; give it its own map.
+			m = make(map[string]*types.Package, len(imports))
+			for path, pkg := range imports {
+				m[path] = pkg
+			}
+			delete(m, p.Path)
+		}
+		pkg, err := gcexportdata.Read(bytes.NewReader(p.Export), prog.Fset, m, p.Path)
+		if err != nil {
+			return nil, fmt.Errorf("reading saved package %s: %v", p.Path, err)
+		}
+		info := &PackageInfo{
+			Pkg:                   pkg,
+			Importable:            p.Importable,
+			TransitivelyErrorFree: p.TransitivelyErrorFree,
+			Info: types.Info{
+				Types:      make(map[ast.Expr]types.TypeAndValue),
+				Defs:       make(map[*ast.Ident]types.Object),
+				Uses:       make(map[*ast.Ident]types.Object),
+				Implicits:  make(map[ast.Node]types.Object),
+				Scopes:     make(map[ast.Node]*types.Scope),
+				Selections: make(map[*ast.SelectorExpr]*types.Selection),
+			},
+		}
+		for _, file := range p.Files {
+			// The saved source may have syntax errors,
+			// which are among the saved errors.
+			f, _ := parser.ParseFile(prog.Fset, file.Name, file.Src, parser.ParseComments)
+			if f == nil {
+				return nil, fmt.Errorf("reading saved file %s: cannot parse", file.Name)
+			}
+			info.Files = append(info.Files, f)
+			prog.sources[f] = file.Src
+		}
+		for _, e := range p.Errors {
+			info.Errors = append(info.Errors, prog.loadError(info, e))
+		}
+		infos[i] = info
+		prog.AllPackages[pkg] = info
+		if p.Importable {
+			prog.importMap[p.Path] = pkg
+		}
+		if p.Imported {
+			prog.Imported[p.Path] = info
+		}
+		if p.Created > 0 {
+			created[p.Created] = info
+		}
+	}
+	for i := 1; i <= len(created); i++ {
+		info, ok := created[i]
+		if !ok {
+			return nil, fmt.Errorf("reading saved program: missing created package #%d", i)
+		}
+		prog.Created = append(prog.Created, info)
+	}
+	edges := func(indices []int) ([]*PackageInfo, error) {
+		var res []*PackageInfo
+		for _, j := range indices {
+			if j < 0 || j >= len(infos) {
+				return nil, fmt.Errorf("reading saved program: invalid package index %d", j)
+			}
+			res = append(res, infos[j])
+		}
+		return res, nil
+	}
+	for i, p := range saved.Packages {
+		all, err := edges(p.Imports)
+		if err != nil {
+			return nil, err
+		}
+		nonTest, err := edges(p.NonTestImports)
+		if err != nil {
+			return nil, err
+		}
+		prog.savedImports[infos[i]] = savedEdges{all, nonTest}
+	}
+	prog.indexFiles()
+	return prog, nil
+}
+
+// loadError returns the error of info saved as e.  A type error is
+// restored as such only if its file is among the restored syntax.
+func (prog *Program) loadError(info *PackageInfo, e savedError) error {
+	switch e.Kind {
+	case 't':
+		for _, f := range info.Files {
+			tf := prog.Fset.File(f.Pos())
+			if tf.Name() == e.Posn.Filename && e.Posn.Offset <= tf.Size() {
+				return types.Error{Fset: prog.Fset, Pos: tf.Pos(e.Posn.Offset), Msg: e.Msg, Soft: e.Soft}
+			}
+		}
+	case 'l':
+		return e.List
+	case 's':
+		if len(e.List) == 1 {
+			return e.List[0]
+		}
+	}
+	return errors.New(e.Text)
+}
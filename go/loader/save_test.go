@@ -0,0 +1,144 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestSaveAndLoadSaved(t *testing.T) {
+	prog := graphProgram(t)
+
+	// describe summarizes the packages and import graph of a program.
+	describe := func(prog *loader.Program) string {
+		var buf bytes.Buffer
+		g := prog.ImportGraph()
+		for _, info := range prog.SortedPackages() {
+			fmt.Fprintf(&buf, "%s importable=%t files=%d imports=%s scope=%s\n",
+				info, info.Importable, len(info.Files), g.Imports[info], info.Pkg.Scope().Names())
+		}
+		order, err := prog.TopoSort()
+		fmt.Fprintf(&buf, "created=%s imported=%d order=%s err=%v\n", prog.Created, len(prog.Imported), order, err)
+		return buf.String()
+	}
+
+	for _, syntax := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := prog.Save(&buf, syntax); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		saved, err := loader.LoadSaved(&buf)
+		if err != nil {
+			t.Fatalf("LoadSaved: %v", err)
+		}
+
+		want := describe(prog)
+		if !syntax {
+			want = strings.Replace(want, "files=2", "files=0", -1)
+			want = strings.Replace(want, "files=1", "files=0", -1)
+		}
+		if got := describe(saved); got != want {
+			t.Errorf("LoadSaved [syntax=%t]:\n%s\nwant:\n%s", syntax, got, want)
+		}
+
+		if d, ok := saved.Package("d").Pkg.Scope().Lookup("D").(*types.Const); !ok || d.Val().String() != "0" {
+			t.Errorf("saved d.D = %v", d)
+		}
+		if syntax {
+			if _, f := saved.PackageForFile("/go/src/a/a_test.go"); f == nil || f.Name.Name != "a" {
+				t.Errorf("PackageForFile(a_test.go) = %v", f)
+			}
+		}
+	}
+
+	if _, err := loader.LoadSaved(strings.NewReader("garbage")); err == nil {
+		t.Errorf("LoadSaved(garbage) succeeded")
+	}
+}
+
+func TestLoadSavedTypeIdentity(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a; type T struct{}; func (*T) M() {}`,
+		"b": `package b; import "a"; var V *a.T`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("b")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := prog.Save(&buf, false); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved, err := loader.LoadSaved(&buf)
+	if err != nil {
+		t.Fatalf("LoadSaved: %v", err)
+	}
+	T := saved.Package("a").Pkg.Scope().Lookup("T").Type()
+	V := saved.Package("b").Pkg.Scope().Lookup("V").Type()
+	if !types.Identical(V, types.NewPointer(T)) {
+		t.Errorf("saved b.V has type %s, not identical to *a.T", V)
+	}
+	if saved.Imported["b"] == nil || len(saved.Created) != 0 {
+		t.Errorf("saved initial packages: Imported=%v Created=%v", saved.Imported, saved.Created)
+	}
+}
+
+func TestSaveSource(t *testing.T) {
+	src := "package p\n\n// Comment.\nvar (\n\tX int\n\tY string = X\n)\n"
+	ctxt := fakeContext(map[string]string{"p": src})
+	conf := loader.Config{
+		Build:       ctxt,
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+	}
+	conf.Import("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := prog.Save(&buf, true); err == nil {
+		t.Errorf("Save of syntax without Config.KeepSource succeeded")
+	}
+
+	conf.KeepSource = true
+	prog, err = conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	buf.Reset()
+	if err := prog.Save(&buf, true); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved, err := loader.LoadSaved(&buf)
+	if err != nil {
+		t.Fatalf("LoadSaved: %v", err)
+	}
+	info := saved.Package("p")
+	if len(info.Files) != 1 || len(info.Errors) != 1 {
+		t.Fatalf("saved p has %d files and errors %v", len(info.Files), info.Errors)
+	}
+	terr, ok := info.Errors[0].(types.Error)
+	if !ok {
+		t.Fatalf("saved error %v is a %T, not a types.Error", info.Errors[0], info.Errors[0])
+	}
+	if got, want := terr.Error(), prog.Package("p").Errors[0].Error(); got != want {
+		t.Errorf("saved error is %q, want %q", got, want)
+	}
+	// The restored syntax and the export data agree on positions.
+	X := info.Pkg.Scope().Lookup("X")
+	if line := saved.Fset.Position(info.Files[0].Decls[0].(*ast.GenDecl).Specs[0].Pos()).Line; line != 5 || saved.Fset.Position(X.Pos()).Line != 5 {
+		t.Errorf("X declared at line %d in syntax, %s in export data; want 5", line, saved.Fset.Position(X.Pos()))
+	}
+}
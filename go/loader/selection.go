@@ -0,0 +1,80 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the explanation of selector expressions.
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// ExplainSelection describes the selector expression e of the package
+// by spelling out what it abbreviates.  The result begins with the kind
+// of the selection: "field", "method value", "method expression", or
+// "qualified identifier" for a reference to a member of an imported
+// package.  Then follows the selection with its implicit steps made
+// explicit, as in the Go specification's section on selectors: each
+// field traversed through embedding is named, each implicit pointer
+// indirection is written (*x), and the implicit address-of operation
+// of a call to a pointer method on an addressable value is written
+// (&x).  For example, if p is a pointer to a struct that embeds a
+// struct U with a pointer method M, then p.M is explained as
+//
+//	method value (&(*p).U).M
+//
+// ExplainSelection returns the empty string if e is not a selector
+// expression of the package.
+//
+func (info *PackageInfo) ExplainSelection(e *ast.SelectorExpr) string {
+	sel := info.Selections[e]
+	if sel == nil {
+		if obj := info.Uses[e.Sel]; obj != nil && obj.Pkg() != nil && obj.Pkg() != info.Pkg {
+			return "qualified identifier " + types.ExprString(e)
+		}
+		return ""
+	}
+
+	var kind string
+	switch sel.Kind() {
+	case types.FieldVal:
+		kind = "field"
+	case types.MethodVal:
+		kind = "method value"
+	case types.MethodExpr:
+		kind = "method expression"
+	}
+
+	x := types.ExprString(e.X)
+	t := sel.Recv()
+	deref := func() {
+		if ptr, ok := t.Underlying().(*types.Pointer); ok {
+			if sel.Kind() != types.MethodExpr {
+				x = "(*" + x + ")"
+			}
+			t = ptr.Elem()
+		}
+	}
+	index := sel.Index()
+	for _, i := range index[:len(index)-1] {
+		deref()
+		f := t.Underlying().(*types.Struct).Field(i)
+		x += "." + f.Name()
+		t = f.Type()
+	}
+
+	if fn, ok := sel.Obj().(*types.Func); ok && sel.Kind() == types.MethodVal {
+		_, ptrRecv := fn.Type().(*types.Signature).Recv().Type().(*types.Pointer)
+		_, ptr := t.Underlying().(*types.Pointer)
+		if ptr && !ptrRecv {
+			deref()
+		} else if !ptr && ptrRecv {
+			x = "(&" + x + ")"
+		}
+	} else {
+		deref()
+	}
+	return kind + " " + x + "." + sel.Obj().Name()
+}
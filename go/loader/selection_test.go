@@ -0,0 +1,87 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/ast"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestExplainSelection(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a
+
+import "b"
+
+type T struct {
+	*U
+	V
+	f int
+}
+
+type U struct{ g int }
+
+func (*U) M() {}
+func (U) N()  {}
+
+type V struct{ I }
+
+type I interface{ O() }
+
+func _(t T, p *T) {
+	_ = t.f
+	_ = p.f
+	_ = p.g
+	_ = t.M
+	_ = p.N
+	_ = t.V.O
+	_ = t.O
+	_ = (*T).M
+	_ = T.N
+	_ = b.B
+	_ = V{}.I
+}
+`,
+		"b": `package b; const B = 0`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	info := prog.Imported["a"]
+	var got []string
+	ast.Inspect(info.Files[0], func(n ast.Node) bool {
+		if e, ok := n.(*ast.SelectorExpr); ok {
+			got = append(got, info.ExplainSelection(e))
+			return false
+		}
+		return true
+	})
+	want := []string{
+		"field t.f",
+		"field (*p).f",
+		"field (*(*p).U).g",
+		"method value t.U.M",
+		"method value (*(*p).U).N",
+		"method value t.V.I.O",
+		"method value t.V.I.O",
+		"method expression (*T).U.M",
+		"method expression T.U.N",
+		"qualified identifier b.B",
+		"field V{}.I",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d selections %q, want %d", len(got), got, len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("ExplainSelection #%d = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
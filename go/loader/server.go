@@ -0,0 +1,232 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines a server that answers queries about a Program,
+// so that clients such as editors need not load it for each query.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// A QueryRequest is a request to a QueryServer.
+type QueryRequest struct {
+	ID int // arbitrary; copied to the response
+
+	// Query is one of:
+	//   "definition": the declaration of the object denoted by the
+	//     identifier at Pos;
+	//   "references": the identifiers that refer to that object;
+	//   "implements": the named types that implement the named
+	//     interface type denoted by the identifier at Pos, or the
+	//     interfaces that the named concrete type implements;
+	//   "enclosing": the syntax nodes that enclose Pos, innermost
+	//     first.
+	Query string
+
+	// Pos is a position of the form "file:line:column", with
+	// 1-based line and byte column, as by Program.PosOf.
+	Pos string
+}
+
+// A QueryResponse is the response of a QueryServer to a QueryRequest.
+type QueryResponse struct {
+	ID      int
+	Error   string        `json:",omitempty"` // non-empty if the query failed
+	Results []QueryResult `json:",omitempty"`
+}
+
+// A QueryResult is an element of the answer to a query: a range of the
+// source and a description of what lies there.
+type QueryResult struct {
+	Range       DiagnosticRange
+	Description string
+}
+
+// A QueryServer answers queries about a Program.  Since the program is
+// loaded only once, each query takes little time.  A QueryServer is
+// safe for concurrent use, but the Program must not change while it is
+// in use.
+type QueryServer struct {
+	prog *Program
+
+	implsOnce sync.Once
+	impls     *Implementations // computed on first "implements" query
+}
+
+// NewQueryServer returns a QueryServer for the specified program.
+func NewQueryServer(prog *Program) *QueryServer {
+	return &QueryServer{prog: prog}
+}
+
+// Serve reads QueryRequests from r and writes a QueryResponse for each
+// to w, until r reaches EOF.  The protocol is JSON lines: each request
+// and each response is a JSON object on a line of its own.  Blank
+// lines are ignored, and a line that is not a valid request gets a
+// response with zero ID whose Error describes the problem.
+//
+// Serve may be used to serve standard input and output, or each
+// connection accepted by a net.Listener, such as one for a Unix
+// domain socket.  It returns an error only if r cannot be read or a
+// response cannot be written.
+//
+func (s *QueryServer) Serve(r io.Reader, w io.Writer) error {
+	in := bufio.NewScanner(r)
+	in.Buffer(nil, maxQueryLine)
+	enc := json.NewEncoder(w)
+	for in.Scan() {
+		line := bytes.TrimSpace(in.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var resp *QueryResponse
+		var req QueryRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp = &QueryResponse{Error: fmt.Sprintf("malformed request: %v", err)}
+		} else {
+			resp = s.Query(&req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+	if err := in.Err(); err != nil {
+		return fmt.Errorf("reading query: %v", err)
+	}
+	return nil
+}
+
+// maxQueryLine is the maximum length of a request line.
+const maxQueryLine = 1 << 20
+
+// Query answers a single query.
+func (s *QueryServer) Query(req *QueryRequest) *QueryResponse {
+	resp := &QueryResponse{ID: req.ID}
+	results, err := s.query(req)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Results = results
+	}
+	return resp
+}
+
+func (s *QueryServer) query(req *QueryRequest) ([]QueryResult, error) {
+	pos, err := s.parsePos(req.Pos)
+	if err != nil {
+		return nil, err
+	}
+	prog := s.prog
+	switch req.Query {
+	case "definition":
+		obj, err := s.objectAt(pos)
+		if err != nil {
+			return nil, err
+		}
+		return []QueryResult{s.objectResult(obj)}, nil
+
+	case "references":
+		obj, err := s.objectAt(pos)
+		if err != nil {
+			return nil, err
+		}
+		var results []QueryResult
+		for _, id := range prog.ReferencesTo(obj) {
+			results = append(results, QueryResult{s.nodeRange(id), id.Name})
+		}
+		return results, nil
+
+	case "implements":
+		obj, err := s.objectAt(pos)
+		if err != nil {
+			return nil, err
+		}
+		named, ok := obj.Type().(*types.Named)
+		if _, isType := obj.(*types.TypeName); !isType || !ok {
+			return nil, fmt.Errorf("%s is not a named type", obj.Name())
+		}
+		s.implsOnce.Do(func() { s.impls = prog.Implements(nil) })
+		var results []QueryResult
+		if types.IsInterface(named) {
+			for _, T := range s.impls.Implementors[named] {
+				results = append(results, s.typeResult(T))
+			}
+		} else {
+			for _, I := range s.impls.Interfaces[named] {
+				results = append(results, s.typeResult(I))
+			}
+		}
+		return results, nil
+
+	case "enclosing":
+		_, path, _ := prog.PathEnclosingInterval(pos, pos)
+		var results []QueryResult
+		for _, n := range path {
+			results = append(results, QueryResult{s.nodeRange(n), astutil.NodeDescription(n)})
+		}
+		return results, nil
+	}
+	return nil, fmt.Errorf("unknown query %q", req.Query)
+}
+
+// parsePos parses a position of the form "file:line:column".
+func (s *QueryServer) parsePos(str string) (token.Pos, error) {
+	var line, col int
+	var err error
+	filename := str
+	if i := strings.LastIndex(filename, ":"); i >= 0 {
+		col, err = strconv.Atoi(filename[i+1:])
+		filename = filename[:i]
+		if j := strings.LastIndex(filename, ":"); err == nil && j >= 0 {
+			line, err = strconv.Atoi(filename[j+1:])
+			filename = filename[:j]
+		}
+	}
+	if err != nil || line == 0 {
+		return token.NoPos, fmt.Errorf("invalid position %q: want file:line:column", str)
+	}
+	pos := s.prog.PosOf(filename, line, col)
+	if pos == token.NoPos {
+		return token.NoPos, fmt.Errorf("no position %s in program", str)
+	}
+	return pos, nil
+}
+
+// objectAt returns the object denoted by the identifier at pos.
+func (s *QueryServer) objectAt(pos token.Pos) (types.Object, error) {
+	obj, _ := s.prog.ObjectAt(pos)
+	if obj == nil {
+		return nil, fmt.Errorf("no identifier here")
+	}
+	return obj, nil
+}
+
+func (s *QueryServer) objectResult(obj types.Object) QueryResult {
+	return QueryResult{s.prog.pointRange(obj.Pos()), types.ObjectString(obj, nil)}
+}
+
+func (s *QueryServer) typeResult(T types.Type) QueryResult {
+	return QueryResult{s.prog.pointRange(deref(T).(*types.Named).Obj().Pos()), T.String()}
+}
+
+// nodeRange returns the range of the source occupied by n.
+func (s *QueryServer) nodeRange(n ast.Node) DiagnosticRange {
+	return DiagnosticRange{
+		Start: positionRange(s.prog.Position(n.Pos())).Start,
+		End:   positionRange(s.prog.Position(n.End())).Start,
+	}
+}
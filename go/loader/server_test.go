@@ -0,0 +1,100 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestQueryServer(t *testing.T) {
+	conf := loader.Config{Build: fakeContext(map[string]string{
+		"a": `package a
+
+type I interface{ M() }
+
+type T int
+
+func (T) M() {}
+
+func f() {
+	var t T
+	t.M()
+}
+`,
+	})}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var in bytes.Buffer
+	for i, q := range []struct{ query, pos string }{
+		{"definition", "/go/src/a/x.go:10:6"}, // t in var t T
+		{"references", "/go/src/a/x.go:5:6"},  // T
+		{"implements", "/go/src/a/x.go:3:6"},  // I
+		{"implements", "/go/src/a/x.go:5:6"},  // T
+		{"enclosing", "/go/src/a/x.go:11:4"},  // M in t.M()
+		{"definition", "/go/src/a/x.go:1:1"},  // package keyword
+		{"definition", "/go/src/a/x.go:99:1"}, // no such line
+		{"frobnicate", "/go/src/a/x.go:5:6"},  // no such query
+		{"definition", "x.go"},                // bad position
+	} {
+		fmt.Fprintf(&in, `{"ID": %d, "Query": %q, "Pos": %q}`+"\n", i, q.query, q.pos)
+	}
+	// A malformed line does not end the session.
+	in.WriteString("\n{\"ID\": \n")
+	fmt.Fprintf(&in, `{"ID": 9, "Query": "definition", "Pos": "/go/src/a/x.go:10:6"}`+"\n")
+	var out bytes.Buffer
+	if err := loader.NewQueryServer(prog).Serve(&in, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	dec := json.NewDecoder(&out)
+	for {
+		var resp loader.QueryResponse
+		if err := dec.Decode(&resp); err != nil {
+			break
+		}
+		var results []string
+		for _, r := range resp.Results {
+			results = append(results, fmt.Sprintf("%d:%d-%d:%d %s",
+				r.Range.Start.Line, r.Range.Start.Column,
+				r.Range.End.Line, r.Range.End.Column, r.Description))
+		}
+		if resp.Error != "" {
+			results = append(results, "error: "+resp.Error)
+		}
+		got = append(got, fmt.Sprintf("%d: %s", resp.ID, strings.Join(results, "; ")))
+	}
+	want := []string{
+		"0: 10:6-10:6 var t a.T",
+		"1: 5:6-5:7 T; 7:7-7:8 T; 10:8-10:9 T",
+		"2: 5:6-5:6 a.T",
+		"3: 3:6-3:6 a.I",
+		"4: 11:4-11:5 identifier; 11:2-11:5 selector; 11:2-11:7 function call; 11:2-11:7 expression statement; 9:10-12:2 block; 9:1-12:2 function declaration; 1:1-12:2 source file",
+		"5: error: no identifier here",
+		"6: error: no position /go/src/a/x.go:99:1 in program",
+		`7: error: unknown query "frobnicate"`,
+		`8: error: invalid position "x.go": want file:line:column`,
+		"0: error: malformed request: unexpected end of JSON input",
+		"9: 10:6-10:6 var t a.T",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d responses, want %d:\n%s", len(got), len(want), strings.Join(got, "\n"))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("response #%d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the state that several Loads may share.
+
+import (
+	"go/token"
+	"go/types"
+	"sync"
+)
+
+// A SharedState holds the state that several Loads may share, perhaps
+// concurrently, through Config.Shared: a FileSet, so that the
+// positions of all their programs are comparable, and a cache of the
+// packages imported from export data, so that each is decoded only
+// once, and its types are identical across programs.
+//
+// Each Load still parses and type-checks the packages it loads from
+// source anew, so the packages of different programs are distinct,
+// except for those imported from export data.  The Loads that share a
+// state must therefore agree on the export data denoted by each import
+// path: they should use the same build context, compiler, and
+// ExportFiles.
+//
+// A SharedState is safe for concurrent use by multiple goroutines.
+type SharedState struct {
+	fset *token.FileSet
+
+	mu     sync.Mutex                // guards binary
+	binary map[string]*types.Package // packages imported from export data
+}
+
+// NewSharedState returns a new SharedState with an empty FileSet and
+// cache.
+func NewSharedState() *SharedState {
+	return &SharedState{
+		fset:   token.NewFileSet(),
+		binary: make(map[string]*types.Package),
+	}
+}
+
+// FileSet returns the FileSet shared by the Loads of the state.
+func (s *SharedState) FileSet() *token.FileSet { return s.fset }
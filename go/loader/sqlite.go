@@ -0,0 +1,153 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the export of a Program to a SQLite database.
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQLiteSchema is the schema of the database written by ExportSQLite.
+// Positions are those of prog.Position; lines and columns are 1-based,
+// and columns are measured in bytes.  Symbols are named as by
+// WriteXRefs.
+const SQLiteSchema = `
+CREATE TABLE IF NOT EXISTS packages (
+	path TEXT NOT NULL,    -- package path
+	name TEXT NOT NULL     -- package name
+);
+CREATE TABLE IF NOT EXISTS files (
+	name    TEXT NOT NULL, -- file name, as in the FileSet
+	package TEXT NOT NULL  -- packages.path
+);
+CREATE TABLE IF NOT EXISTS symbols (
+	symbol  TEXT NOT NULL,    -- symbol name
+	kind    TEXT NOT NULL,    -- as XRef.Kind
+	local   INTEGER NOT NULL, -- 1 if named by position, as XRef.Local
+	package TEXT NOT NULL,    -- packages.path of the definition
+	file    TEXT NOT NULL,    -- files.name of the definition
+	line    INTEGER NOT NULL,
+	col     INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS refs (
+	symbol   TEXT NOT NULL,   -- symbols.symbol
+	package  TEXT NOT NULL,   -- packages.path of the reference
+	file     TEXT NOT NULL,   -- files.name of the reference
+	line     INTEGER NOT NULL,
+	col      INTEGER NOT NULL,
+	end_line INTEGER NOT NULL,
+	end_col  INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS packages_path ON packages(path);
+CREATE INDEX IF NOT EXISTS files_package ON files(package);
+CREATE INDEX IF NOT EXISTS symbols_symbol ON symbols(symbol);
+CREATE INDEX IF NOT EXISTS symbols_package ON symbols(package);
+CREATE INDEX IF NOT EXISTS refs_symbol ON refs(symbol);
+CREATE INDEX IF NOT EXISTS refs_package ON refs(package);
+`
+
+// ExportSQLite stores the packages, files, symbol definitions, and
+// references of the program in db, a SQLite database, creating the
+// tables of SQLiteSchema if necessary.  The rows of each package of
+// the program replace any existing rows for a package of the same
+// path, so a database may be updated incrementally, by exporting
+// successive Programs that load different or changed packages.
+// All changes are made in a single transaction.
+//
+// The loader does not depend on a particular SQLite driver; the client
+// must open db with one.  Only standard SQL with "?" placeholders is
+// used, so other databases may work too.
+//
+func (prog *Program) ExportSQLite(db *sql.DB) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	for _, stmt := range strings.Split(SQLiteSchema, ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			if _, err := tx.Exec(stmt); err != nil {
+				return fmt.Errorf("creating schema: %v", err)
+			}
+		}
+	}
+
+	// Delete the old rows of the packages.
+	sorted := prog.SortedPackages()
+	seen := make(map[string]bool)
+	for _, info := range sorted {
+		path := info.Pkg.Path()
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		for _, table := range []string{"packages", "files", "symbols", "refs"} {
+			column := "package"
+			if table == "packages" {
+				column = "path"
+			}
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE "+column+" = ?", path); err != nil {
+				return err
+			}
+		}
+	}
+
+	insert := func(table string, n int) (*sql.Stmt, error) {
+		return tx.Prepare("INSERT INTO " + table + " VALUES (?" + strings.Repeat(", ?", n-1) + ")")
+	}
+	pkgStmt, err := insert("packages", 2)
+	if err != nil {
+		return err
+	}
+	fileStmt, err := insert("files", 2)
+	if err != nil {
+		return err
+	}
+	symStmt, err := insert("symbols", 7)
+	if err != nil {
+		return err
+	}
+	refStmt, err := insert("refs", 7)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range sorted {
+		if _, err := pkgStmt.Exec(info.Pkg.Path(), info.Pkg.Name()); err != nil {
+			return err
+		}
+		for _, f := range info.Files {
+			if tf := prog.Fset.File(f.Pos()); tf != nil {
+				if _, err := fileStmt.Exec(tf.Name(), info.Pkg.Path()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return prog.forEachXRef(func(x *XRef) error {
+		start, end := x.Range.Start, x.Range.End
+		var err error
+		if x.Role == "definition" {
+			local := 0
+			if x.Local {
+				local = 1
+			}
+			_, err = symStmt.Exec(x.Symbol, x.Kind, local, x.Package, start.Filename, start.Line, start.Column)
+		} else {
+			_, err = refStmt.Exec(x.Symbol, x.Package, start.Filename, start.Line, start.Column, end.Line, end.Column)
+		}
+		return err
+	})
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+// recorder is a database/sql driver that records the statements it
+// executes, since no SQLite driver is available.
+type recorder struct {
+	mu        sync.Mutex
+	stmts     []string // executed statements, with arguments
+	committed bool
+}
+
+func (r *recorder) Open(name string) (driver.Conn, error) { return recorderConn{r}, nil }
+
+type recorderConn struct{ r *recorder }
+
+func (c recorderConn) Prepare(query string) (driver.Stmt, error) {
+	return recorderStmt{c.r, query}, nil
+}
+func (c recorderConn) Close() error              { return nil }
+func (c recorderConn) Begin() (driver.Tx, error) { return recorderTx{c.r}, nil }
+
+type recorderTx struct{ r *recorder }
+
+func (tx recorderTx) Commit() error   { tx.r.committed = true; return nil }
+func (tx recorderTx) Rollback() error { return nil }
+
+type recorderStmt struct {
+	r     *recorder
+	query string
+}
+
+func (s recorderStmt) Close() error  { return nil }
+func (s recorderStmt) NumInput() int { return -1 }
+func (s recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	s.r.stmts = append(s.r.stmts, fmt.Sprintf("%s %v", strings.Join(strings.Fields(s.query), " "), args))
+	return driver.RowsAffected(1), nil
+}
+func (s recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, fmt.Errorf("unsupported")
+}
+
+var (
+	registerRecorder sync.Once
+	theRecorder      = new(recorder)
+)
+
+func TestExportSQLite(t *testing.T) {
+	registerRecorder.Do(func() { sql.Register("loadertest-recorder", theRecorder) })
+	db, err := sql.Open("loadertest-recorder", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conf := loader.Config{Build: fakeContext(map[string]string{
+		"a": `package a; func F() {}`,
+		"b": `package b; import "a"; var _ = a.F`,
+	})}
+	conf.Import("b")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	theRecorder.stmts = nil
+	if err := prog.ExportSQLite(db); err != nil {
+		t.Fatal(err)
+	}
+	if !theRecorder.committed {
+		t.Errorf("transaction was not committed")
+	}
+
+	var got []string
+	for _, stmt := range theRecorder.stmts {
+		if !strings.HasPrefix(stmt, "CREATE") {
+			got = append(got, stmt)
+		}
+	}
+	want := []string{
+		"DELETE FROM packages WHERE path = ? [a]",
+		"DELETE FROM files WHERE package = ? [a]",
+		"DELETE FROM symbols WHERE package = ? [a]",
+		"DELETE FROM refs WHERE package = ? [a]",
+		"DELETE FROM packages WHERE path = ? [b]",
+		"DELETE FROM files WHERE package = ? [b]",
+		"DELETE FROM symbols WHERE package = ? [b]",
+		"DELETE FROM refs WHERE package = ? [b]",
+		"INSERT INTO packages VALUES (?, ?) [a a]",
+		"INSERT INTO files VALUES (?, ?) [/go/src/a/x.go a]",
+		"INSERT INTO packages VALUES (?, ?) [b b]",
+		"INSERT INTO files VALUES (?, ?) [/go/src/b/x.go b]",
+		"INSERT INTO symbols VALUES (?, ?, ?, ?, ?, ?, ?) [a.F func 0 a /go/src/a/x.go 1 17]",
+		"INSERT INTO refs VALUES (?, ?, ?, ?, ?, ?, ?) [a b /go/src/b/x.go 1 32 1 33]",
+		"INSERT INTO refs VALUES (?, ?, ?, ?, ?, ?, ?) [a.F b /go/src/b/x.go 1 34 1 35]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("statements:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
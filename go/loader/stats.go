@@ -0,0 +1,187 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines summary statistics and code metrics of a Program.
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+)
+
+// Stats holds summary statistics of a loaded Program.
+type Stats struct {
+	Packages      int   // number of packages in AllPackages
+	Initial       int   // number of initial packages
+	Binary        int   // number of packages without syntax, e.g. from export data
+	Files         int   // number of files parsed
+	Lines         int   // total number of lines in parsed files
+	Bytes         int64 // total size in bytes of parsed files
+	Errors        int   // total number of errors in PackageInfo.Errors
+	ErrorPackages int   // number of packages with errors
+
+	// Facts is the total number of entries in the maps of all
+	// types.Info structures, a rough measure of the memory
+	// consumed by the results of type checking.
+	Facts int
+}
+
+// Stats returns summary statistics of the program, useful for
+// logging and for checking what was actually loaded.
+func (prog *Program) Stats() Stats {
+	s := Stats{
+		Packages: len(prog.AllPackages),
+		Initial:  len(prog.Created) + len(prog.Imported),
+	}
+	for _, info := range prog.AllPackages {
+		if info.Files == nil {
+			s.Binary++
+		}
+		for _, f := range info.Files {
+			if tf := prog.Fset.File(f.Pos()); tf != nil {
+				s.Files++
+				s.Lines += tf.LineCount()
+				s.Bytes += int64(tf.Size())
+			}
+		}
+		if len(info.Errors) > 0 {
+			s.Errors += len(info.Errors)
+			s.ErrorPackages++
+		}
+		s.Facts += len(info.Types) + len(info.Defs) + len(info.Uses) +
+			len(info.Implicits) + len(info.Selections) + len(info.Scopes)
+	}
+	return s
+}
+
+// String returns a concise one-line summary of the statistics.
+func (s Stats) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d packages (%d initial, %d without syntax), ", s.Packages, s.Initial, s.Binary)
+	fmt.Fprintf(&buf, "%d files, %d lines, %d bytes, %d facts", s.Files, s.Lines, s.Bytes, s.Facts)
+	if s.Errors > 0 {
+		fmt.Fprintf(&buf, ", %d errors in %d packages", s.Errors, s.ErrorPackages)
+	}
+	return buf.String()
+}
+
+// Metrics holds code metrics of a package or, summed, a Program.
+type Metrics struct {
+	Files     int // number of files with syntax
+	Lines     int // number of physical lines
+	CodeLines int // number of lines containing code, not just comments or space
+
+	// GeneratedFiles is the number of files marked as generated by a
+	// "// Code generated ... DO NOT EDIT." comment.  Such comments are
+	// seen only if Config.ParserMode includes parser.ParseComments.
+	GeneratedFiles int
+
+	// Numbers of package-level declarations, by kind.  Each name
+	// declared by a const or var spec counts separately.
+	Consts, Vars, Funcs, Methods, Types int
+}
+
+// Add adds the metrics y to x.
+func (x *Metrics) Add(y Metrics) {
+	x.Files += y.Files
+	x.Lines += y.Lines
+	x.CodeLines += y.CodeLines
+	x.GeneratedFiles += y.GeneratedFiles
+	x.Consts += y.Consts
+	x.Vars += y.Vars
+	x.Funcs += y.Funcs
+	x.Methods += y.Methods
+	x.Types += y.Types
+}
+
+// PackageMetrics returns the code metrics of the files of a package
+// of the Program.
+func (prog *Program) PackageMetrics(info *PackageInfo) Metrics {
+	var m Metrics
+	for _, f := range info.Files {
+		tf := prog.Fset.File(f.Pos())
+		if tf == nil {
+			continue
+		}
+		m.Files++
+		m.Lines += tf.LineCount()
+		if info.Generated[f] || isGenerated(f) {
+			m.GeneratedFiles++
+		}
+
+		// A line contains code if a node starts or ends on it.
+		code := make(map[int]bool)
+		ast.Inspect(f, func(n ast.Node) bool {
+			if n == nil {
+				return false
+			}
+			if _, ok := n.(*ast.CommentGroup); ok {
+				return false
+			}
+			code[tf.PositionFor(n.Pos(), false).Line] = true
+			code[tf.PositionFor(n.End()-1, false).Line] = true
+			return true
+		})
+		m.CodeLines += len(code)
+
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv != nil {
+					m.Methods++
+				} else {
+					m.Funcs++
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.ValueSpec:
+						if decl.Tok == token.CONST {
+							m.Consts += len(spec.Names)
+						} else {
+							m.Vars += len(spec.Names)
+						}
+					case *ast.TypeSpec:
+						m.Types++
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+// Metrics returns the code metrics of all the packages of the
+// Program, summed.
+func (prog *Program) Metrics() Metrics {
+	var m Metrics
+	for _, info := range prog.AllPackages {
+		m.Add(prog.PackageMetrics(info))
+	}
+	return m
+}
+
+// generatedRx matches the comment that marks a file as generated,
+// following the convention of https://golang.org/s/generatedcode.
+var generatedRx = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether f has a comment, before its package
+// clause, that marks it as generated.
+func isGenerated(f *ast.File) bool {
+	for _, group := range f.Comments {
+		if group.Pos() > f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if generatedRx.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/parser"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestStats(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": "package a\n\nimport _ \"b\"\n",
+		"b": "package b\n\nvar x int = \"\"\n",
+	})
+	conf := loader.Config{Build: ctxt, AllowErrors: true}
+	conf.TypeChecker.Error = func(error) {}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	s := prog.Stats()
+	want := loader.Stats{
+		Packages:      2,
+		Initial:       1,
+		Files:         2,
+		Lines:         6,
+		Bytes:         int64(len("package a\n\nimport _ \"b\"\n") + len("package b\n\nvar x int = \"\"\n")),
+		Errors:        1,
+		ErrorPackages: 1,
+		Facts:         s.Facts,
+	}
+	if s != want {
+		t.Errorf("Stats = %+v, want %+v", s, want)
+	}
+	if s.Facts == 0 {
+		t.Errorf("Stats.Facts = 0")
+	}
+	if got, want := s.String(), "2 packages (1 initial, 0 without syntax), 2 files, 6 lines, 50 bytes"; !strings.HasPrefix(got, want) {
+		t.Errorf("Stats.String = %q, want prefix %q", got, want)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"a": {
+			"a.go": `// Package a is documented.
+package a
+
+import "b"
+
+// Comment lines are not code.
+const c, d = 1, b.B
+
+var v = []int{
+	1,
+}
+
+type T int
+
+func (T) M() {}
+
+func f() {
+	/* nor is this */
+}
+`,
+			"gen.go": "// Code generated by hand. DO NOT EDIT.\n\npackage a\n\nvar w int\n",
+		},
+		"b": {"b.go": "package b\n\nconst B = 1\n"},
+	})
+	conf := loader.Config{Build: ctxt, ParserMode: parser.ParseComments}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := loader.Metrics{
+		Files:          2,
+		Lines:          24,
+		CodeLines:      12,
+		GeneratedFiles: 1,
+		Consts:         2,
+		Vars:           2,
+		Funcs:          1,
+		Methods:        1,
+		Types:          1,
+	}
+	if m := prog.PackageMetrics(prog.Imported["a"]); m != want {
+		t.Errorf("PackageMetrics(a) = %+v, want %+v", m, want)
+	}
+	want.Files++
+	want.Lines += 3
+	want.CodeLines += 2
+	want.Consts++
+	if m := prog.Metrics(); m != want {
+		t.Errorf("Metrics() = %+v, want %+v", m, want)
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the generation of API-only stub sources.
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Stubs returns stub source files for package info, which declare its
+// exported API, and whatever unexported declarations the API depends
+// on, but no more; the body of each function is replaced by a call to
+// panic.  The stubs of a large dependency can replace its sources in
+// later loads that need only its API, which are then much faster, or
+// in environments that cannot afford the full sources.
+//
+// The result maps the base name of each non-test file of the package
+// that contributes declarations to the source of its stub; comments
+// other than doc comments of the retained declarations are dropped.
+// Methods are retained for each retained type, so that the stubs
+// satisfy the same interfaces.  Initializers of variables are
+// retained, with the functions they call.
+//
+// Stubs fails if the package has no syntax.
+//
+func (prog *Program) Stubs(info *PackageInfo) (map[string][]byte, error) {
+	var files []*ast.File
+	for _, f := range info.Files {
+		if !isTestFile(prog.Fset, f) {
+			files = append(files, f)
+		}
+	}
+	if files == nil {
+		return nil, fmt.Errorf("package %s has no syntax", info.Pkg.Path())
+	}
+
+	s := stubber{
+		info:    info,
+		decls:   make(map[types.Object]ast.Node),
+		methods: make(map[types.Object][]*ast.FuncDecl),
+		keep:    make(map[ast.Node]bool),
+		needed:  make(map[types.Object]bool),
+	}
+	s.index(files)
+
+	// The roots are the exported package-level objects.
+	scope := info.Pkg.Scope()
+	for _, name := range scope.Names() {
+		if ast.IsExported(name) {
+			s.need(scope.Lookup(name))
+		}
+	}
+
+	stubs := make(map[string][]byte)
+	for _, f := range files {
+		if stub := s.file(f); stub != nil {
+			var buf bytes.Buffer
+			if err := format.Node(&buf, prog.Fset, stub); err != nil {
+				return nil, err
+			}
+			stubs[filepath.Base(prog.Fset.File(f.Pos()).Name())] = buf.Bytes()
+		}
+	}
+	if len(stubs) == 0 {
+		// A package with no API still needs a package clause.
+		f := files[0]
+		stubs[filepath.Base(prog.Fset.File(f.Pos()).Name())] = []byte(fmt.Sprintf("package %s\n", f.Name.Name))
+	}
+	return stubs, nil
+}
+
+// A stubber computes the declarations retained by Stubs.
+type stubber struct {
+	info    *PackageInfo
+	decls   map[types.Object]ast.Node        // declaring FuncDecl, TypeSpec, ValueSpec, or const GenDecl
+	methods map[types.Object][]*ast.FuncDecl // method declarations, by receiver type name
+	keep    map[ast.Node]bool                // retained declarations
+	needed  map[types.Object]bool            // retained package-level objects
+}
+
+// index records the declaration of each package-level object.
+func (s *stubber) index(files []*ast.File) {
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					if obj := s.info.Defs[decl.Name]; obj != nil && decl.Name.Name != "init" {
+						s.decls[obj] = decl
+					}
+				} else if len(decl.Recv.List) == 1 {
+					recv := decl.Recv.List[0].Type
+					if star, ok := recv.(*ast.StarExpr); ok {
+						recv = star.X
+					}
+					if id, ok := astutil.Unparen(recv).(*ast.Ident); ok {
+						if tname := s.info.Uses[id]; tname != nil {
+							s.methods[tname] = append(s.methods[tname], decl)
+						}
+					}
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if obj := s.info.Defs[spec.Name]; obj != nil {
+							s.decls[obj] = spec
+						}
+					case *ast.ValueSpec:
+						// A const spec depends on the others of
+						// its declaration through iota and
+						// implicit repetition, so the whole
+						// declaration is retained.
+						var node ast.Node = spec
+						if decl.Tok == token.CONST {
+							node = decl
+						}
+						for _, id := range spec.Names {
+							if obj := s.info.Defs[id]; obj != nil {
+								s.decls[obj] = node
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// need retains the declaration of the package-level object obj, and
+// those on which it depends.
+func (s *stubber) need(obj types.Object) {
+	if s.needed[obj] {
+		return
+	}
+	s.needed[obj] = true
+	decl := s.decls[obj]
+	if decl == nil || s.keep[decl] {
+		return
+	}
+	s.keep[decl] = true
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		s.scan(decl.Type)
+	default:
+		s.scan(decl)
+	}
+	for _, method := range s.methods[obj] {
+		s.keep[method] = true
+		s.scan(method.Recv)
+		s.scan(method.Type)
+	}
+}
+
+// scan retains the package-level objects referred to within n.
+func (s *stubber) scan(n ast.Node) {
+	pkgScope := s.info.Pkg.Scope()
+	ast.Inspect(n, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok {
+			if obj := s.info.Uses[id]; obj != nil && obj.Parent() == pkgScope {
+				s.need(obj)
+			}
+		}
+		return true
+	})
+}
+
+// file returns the stub of file f, or nil if it retains no declarations.
+func (s *stubber) file(f *ast.File) *ast.File {
+	stub := &ast.File{
+		Doc:     f.Doc,
+		Package: f.Package,
+		Name:    f.Name,
+	}
+	var imports *ast.GenDecl
+	for _, decl := range f.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if s.keep[decl] {
+				fn := *decl // shallow copy
+				if fn.Body != nil {
+					fn.Body = stubBody(fn.Body.Lbrace)
+				}
+				stub.Decls = append(stub.Decls, &fn)
+			}
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				if imports == nil {
+					imports = &ast.GenDecl{TokPos: decl.TokPos, Tok: token.IMPORT, Lparen: decl.Lparen, Rparen: decl.Rparen}
+					stub.Decls = append(stub.Decls, imports) // imports are filtered below
+				}
+				imports.Specs = append(imports.Specs, decl.Specs...)
+				continue
+			}
+			if s.keep[decl] {
+				stub.Decls = append(stub.Decls, decl)
+				continue
+			}
+			gen := *decl // shallow copy
+			gen.Specs = nil
+			for _, spec := range decl.Specs {
+				if s.keep[spec] {
+					gen.Specs = append(gen.Specs, spec)
+				}
+			}
+			if gen.Specs != nil {
+				stub.Decls = append(stub.Decls, &gen)
+			}
+		}
+	}
+	if imports == nil && len(stub.Decls) == 0 || imports != nil && len(stub.Decls) == 1 {
+		return nil
+	}
+
+	// Retain only the imports used by the stub.
+	if imports != nil {
+		used := make(map[*types.Package]bool)
+		for _, decl := range stub.Decls[1:] {
+			ast.Inspect(decl, func(n ast.Node) bool {
+				if id, ok := n.(*ast.Ident); ok {
+					switch obj := s.info.Uses[id].(type) {
+					case *types.PkgName:
+						used[obj.Imported()] = true
+					case nil:
+					default:
+						used[obj.Pkg()] = true // perhaps dot-imported
+					}
+				}
+				return true
+			})
+		}
+		specs := imports.Specs
+		imports.Specs = nil
+		for _, spec := range specs {
+			spec := spec.(*ast.ImportSpec)
+			if pkgname := importedPkgName(s.info, spec); pkgname != nil && pkgname.Name() != "_" && used[pkgname.Imported()] {
+				imports.Specs = append(imports.Specs, spec)
+			}
+		}
+		if imports.Specs == nil {
+			stub.Decls = stub.Decls[1:]
+		} else if len(imports.Specs) > 1 && !imports.Lparen.IsValid() {
+			imports.Lparen = imports.TokPos
+			imports.Rparen = imports.TokPos
+		}
+	}
+
+	// Retain the doc comments of the retained declarations.
+	if f.Doc != nil {
+		stub.Comments = append(stub.Comments, f.Doc)
+	}
+	for _, decl := range stub.Decls {
+		ast.Inspect(decl, func(n ast.Node) bool {
+			var doc *ast.CommentGroup
+			switch n := n.(type) {
+			case *ast.FuncDecl:
+				doc = n.Doc
+			case *ast.GenDecl:
+				doc = n.Doc
+			case *ast.TypeSpec:
+				doc = n.Doc
+			case *ast.ValueSpec:
+				doc = n.Doc
+			case *ast.BlockStmt, *ast.FuncLit:
+				return false
+			}
+			if doc != nil {
+				stub.Comments = append(stub.Comments, doc)
+			}
+			return true
+		})
+	}
+	sort.Slice(stub.Comments, func(i, j int) bool { return stub.Comments[i].Pos() < stub.Comments[j].Pos() })
+	return stub
+}
+
+// stubBody returns the body of a stub function, at pos.
+func stubBody(pos token.Pos) *ast.BlockStmt {
+	return &ast.BlockStmt{
+		Lbrace: pos,
+		List: []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{
+			Fun:  &ast.Ident{NamePos: pos, Name: "panic"},
+			Args: []ast.Expr{&ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: `"stub"`}},
+		}}},
+		Rbrace: pos,
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/parser"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestStubs(t *testing.T) {
+	pkgs := map[string]map[string]string{
+		"a": {
+			"a.go": `// Package a is a test.
+package a
+
+import (
+	"b"
+	"c"
+)
+
+// E is exported.
+type E struct {
+	inner
+	X b.T
+}
+
+type inner struct{ y size }
+
+type size int
+
+type unused struct{}
+
+func (E) M() int { return c.F() }
+
+func (e *E) m() {}
+
+// F calls helper.
+func F(x int) string { return helper(x) }
+
+func helper(int) string { return "" }
+
+const (
+	K0 = iota
+	k1
+	K2
+)
+
+var V = newV()
+
+func newV() *E { return nil }
+
+func init() { c.F() }
+`,
+			"g.go":      `package a; func g() {}`,
+			"a_test.go": `package a; func TestA() {}`,
+		},
+		"b": {"b.go": `package b; type T int`},
+		"c": {"c.go": `package c; func F() int { return 0 }`},
+	}
+	conf := loader.Config{Build: buildutil.FakeContext(pkgs), ParserMode: parser.ParseComments}
+	conf.ImportWithTests("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stubs, err := prog.Stubs(prog.Package("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `// Package a is a test.
+package a
+
+import (
+	"b"
+)
+
+// E is exported.
+type E struct {
+	inner
+	X b.T
+}
+
+type inner struct{ y size }
+
+type size int
+
+func (E) M() int { panic("stub") }
+
+func (e *E) m() { panic("stub") }
+
+// F calls helper.
+func F(x int) string { panic("stub") }
+
+const (
+	K0 = iota
+	k1
+	K2
+)
+
+var V = newV()
+
+func newV() *E { panic("stub") }
+`
+	if len(stubs) != 1 || string(stubs["a.go"]) != want {
+		for name, src := range stubs {
+			t.Errorf("stub %s:\n%s", name, src)
+		}
+		t.Fatalf("want one stub a.go:\n%s", want)
+	}
+
+	// The stub declares the same API as the original.
+	stubPkgs := map[string]map[string]string{"b": pkgs["b"], "a": {}}
+	for name, src := range stubs {
+		stubPkgs["a"][name] = string(src)
+	}
+	conf = loader.Config{Build: buildutil.FakeContext(stubPkgs)}
+	conf.Import("a")
+	stubProg, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	api := func(info *loader.PackageInfo) []string {
+		var res []string
+		for _, e := range info.API() {
+			if e.Name == "TestA" {
+				continue // tests have no stubs
+			}
+			res = append(res, strings.Join([]string{e.Kind, e.Name, e.Type, e.Value}, " "))
+		}
+		return res
+	}
+	if got, want := api(stubProg.Package("a")), api(prog.Package("a")); !reflect.DeepEqual(got, want) {
+		t.Errorf("API of stub = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the tags files of a Program, for editor navigation.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"sort"
+)
+
+// A tag is an entry of a tags file.
+type tag struct {
+	name   string
+	posn   token.Position
+	kind   byte     // as in WriteCtags
+	fields []string // extension fields, such as "access:public"
+}
+
+// WriteCtags writes to w a tags file, in the extended format of
+// Exuberant Ctags, for the declarations of the packages of the program
+// that have syntax.  Each line of the file has the form
+//
+//	name<TAB>file<TAB>line;"<TAB>kind<TAB>fields...
+//
+// and the lines are sorted by name.  The kind is one of:
+//   p  package clause
+//   c  constant
+//   v  variable
+//   f  function
+//   t  type other than an interface
+//   n  interface type
+//   m  method, of a named type or an interface
+//   w  field of a struct type
+//   e  embedded field of a struct type
+//
+// The extension fields are "access:public" or "access:private",
+// according to whether the name is exported, and, for methods and
+// fields, "type:T", where T is the name of the type that declares them.
+// Kinds are determined from type information, so that, for example,
+// interface types and methods are classified correctly.
+//
+func (prog *Program) WriteCtags(w io.Writer) error {
+	tags := prog.tags()
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].name < tags[j].name })
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "!_TAG_FILE_FORMAT\t2\t/extended format/")
+	fmt.Fprintln(bw, "!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/")
+	for _, t := range tags {
+		fmt.Fprintf(bw, "%s\t%s\t%d;\"\t%c", t.name, t.posn.Filename, t.posn.Line, t.kind)
+		for _, field := range t.fields {
+			fmt.Fprintf(bw, "\t%s", field)
+		}
+		fmt.Fprintln(bw)
+	}
+	return bw.Flush()
+}
+
+// WriteEtags writes to w a tags file in the format of Emacs etags for
+// the same declarations as WriteCtags.  Each entry gives the name of
+// the declaration explicitly, and its line and byte offset.
+func (prog *Program) WriteEtags(w io.Writer) error {
+	tags := prog.tags()
+
+	// Group the tags by file, in order of first appearance.
+	var files []string
+	byFile := make(map[string][]tag)
+	for _, t := range tags {
+		if _, ok := byFile[t.posn.Filename]; !ok {
+			files = append(files, t.posn.Filename)
+		}
+		byFile[t.posn.Filename] = append(byFile[t.posn.Filename], t)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, file := range files {
+		var section bytes.Buffer
+		for _, t := range byFile[file] {
+			fmt.Fprintf(&section, "%s\x7f%s\x01%d,%d\n", t.name, t.name, t.posn.Line, t.posn.Offset)
+		}
+		fmt.Fprintf(bw, "\f\n%s,%d\n", file, section.Len())
+		section.WriteTo(bw)
+	}
+	return bw.Flush()
+}
+
+// tags returns the tags of the program, ordered by package, as by
+// SortedPackages, then by file and position.
+func (prog *Program) tags() []tag {
+	var tags []tag
+	add := func(name string, pos token.Pos, kind byte, fields ...string) {
+		access := "access:private"
+		if ast.IsExported(name) {
+			access = "access:public"
+		}
+		tags = append(tags, tag{name, prog.Position(pos), kind, append([]string{access}, fields...)})
+	}
+	for _, info := range prog.SortedPackages() {
+		for _, f := range info.Files {
+			add(f.Name.Name, f.Name.Pos(), 'p')
+			for _, decl := range f.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					fn, ok := info.Defs[decl.Name].(*types.Func)
+					if !ok {
+						continue
+					}
+					if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+						if named, ok := deref(recv.Type()).(*types.Named); ok {
+							add(fn.Name(), fn.Pos(), 'm', "type:"+named.Obj().Name())
+						}
+					} else {
+						add(fn.Name(), fn.Pos(), 'f')
+					}
+
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						switch spec := spec.(type) {
+						case *ast.ValueSpec:
+							for _, id := range spec.Names {
+								switch info.Defs[id].(type) {
+								case *types.Const:
+									add(id.Name, id.Pos(), 'c')
+								case *types.Var:
+									add(id.Name, id.Pos(), 'v')
+								}
+							}
+						case *ast.TypeSpec:
+							if tname, ok := info.Defs[spec.Name].(*types.TypeName); ok {
+								prog.typeTags(tname, add)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// typeTags adds the tags of type tname and, unless it is an alias, its
+// fields or interface methods.
+func (prog *Program) typeTags(tname *types.TypeName, add func(name string, pos token.Pos, kind byte, fields ...string)) {
+	T := tname.Type().Underlying()
+	if _, ok := T.(*types.Interface); ok {
+		add(tname.Name(), tname.Pos(), 'n')
+	} else {
+		add(tname.Name(), tname.Pos(), 't')
+	}
+	if tname.IsAlias() {
+		return
+	}
+	typ := "type:" + tname.Name()
+	switch T := T.(type) {
+	case *types.Struct:
+		for i := 0; i < T.NumFields(); i++ {
+			if f := T.Field(i); f.Anonymous() {
+				add(f.Name(), f.Pos(), 'e', typ)
+			} else {
+				add(f.Name(), f.Pos(), 'w', typ)
+			}
+		}
+	case *types.Interface:
+		for i := 0; i < T.NumExplicitMethods(); i++ {
+			m := T.ExplicitMethod(i)
+			add(m.Name(), m.Pos(), 'm', typ)
+		}
+	}
+}
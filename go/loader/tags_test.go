@@ -0,0 +1,86 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func tagsProgram(t *testing.T) *loader.Program {
+	conf := loader.Config{Build: fakeContext(map[string]string{
+		"a": `package a
+
+const C = 1
+
+var v int
+
+type I interface {
+	M()
+}
+
+type S struct {
+	I
+	f int
+}
+
+func (S) M() {}
+
+func F() {}
+`,
+	})}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog
+}
+
+func TestWriteCtags(t *testing.T) {
+	var buf bytes.Buffer
+	if err := tagsProgram(t).WriteCtags(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "!_TAG_FILE_FORMAT\t2\t/extended format/\n" +
+		"!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n" +
+		"C\t/go/src/a/x.go\t3;\"\tc\taccess:public\n" +
+		"F\t/go/src/a/x.go\t18;\"\tf\taccess:public\n" +
+		"I\t/go/src/a/x.go\t7;\"\tn\taccess:public\n" +
+		"I\t/go/src/a/x.go\t12;\"\te\taccess:public\ttype:S\n" +
+		"M\t/go/src/a/x.go\t8;\"\tm\taccess:public\ttype:I\n" +
+		"M\t/go/src/a/x.go\t16;\"\tm\taccess:public\ttype:S\n" +
+		"S\t/go/src/a/x.go\t11;\"\tt\taccess:public\n" +
+		"a\t/go/src/a/x.go\t1;\"\tp\taccess:private\n" +
+		"f\t/go/src/a/x.go\t13;\"\tw\taccess:private\ttype:S\n" +
+		"v\t/go/src/a/x.go\t5;\"\tv\taccess:private\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestWriteEtags(t *testing.T) {
+	var buf bytes.Buffer
+	if err := tagsProgram(t).WriteEtags(&buf); err != nil {
+		t.Fatal(err)
+	}
+	section := "a\x7fa\x011,8\n" +
+		"C\x7fC\x013,17\n" +
+		"v\x7fv\x015,28\n" +
+		"I\x7fI\x017,40\n" +
+		"M\x7fM\x018,55\n" +
+		"S\x7fS\x0111,67\n" +
+		"I\x7fI\x0112,79\n" +
+		"f\x7ff\x0113,82\n" +
+		"M\x7fM\x0116,100\n" +
+		"F\x7fF\x0118,113\n"
+	want := "\f\n/go/src/a/x.go," + strconv.Itoa(len(section)) + "\n" + section
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
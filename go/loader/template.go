@@ -0,0 +1,62 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the expansion of template packages during loading.
+
+// An expansion is the result of Config.ExpandTemplate for a path.
+type expansion struct {
+	ready chan struct{} // closed to broadcast readiness
+	files map[string]string
+	err   error
+}
+
+// expand returns the source files of the expansion of the template
+// package denoted by path, or nil if path does not denote one.  It
+// calls Config.ExpandTemplate at most once for each path.
+func (imp *importer) expand(path string) (map[string]string, error) {
+	if imp.conf.ExpandTemplate == nil {
+		return nil, nil
+	}
+	if _, ok := imp.conf.SourcePkgs[path]; ok {
+		return nil, nil // SourcePkgs takes precedence
+	}
+
+	// We use the same duplicate-suppressing cache as findPackage.
+	imp.templatesMu.Lock()
+	e, ok := imp.templates[path]
+	if ok {
+		imp.templatesMu.Unlock()
+		<-e.ready
+	} else {
+		e = &expansion{ready: make(chan struct{})}
+		imp.templates[path] = e
+		imp.templatesMu.Unlock()
+
+		e.files, e.err = imp.conf.ExpandTemplate(imp.conf.build(), path)
+		if e.err == nil && e.files != nil {
+			imp.logf("expand template %q: %d files", path, len(e.files))
+		}
+		close(e.ready)
+	}
+	return e.files, e.err
+}
+
+// source returns the source files of the synthetic package denoted by
+// path, from Config.SourcePkgs or the expansion of a template, or nil
+// if it is an ordinary package.
+func (imp *importer) source(path string) map[string]string {
+	if files, ok := imp.conf.SourcePkgs[path]; ok {
+		return files
+	}
+	imp.templatesMu.Lock()
+	e := imp.templates[path]
+	imp.templatesMu.Unlock()
+	if e == nil {
+		return nil
+	}
+	<-e.ready
+	return e.files
+}
@@ -0,0 +1,145 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the graph of relations among named types.
+
+import (
+	"go/ast"
+	"go/types"
+
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+// A TypeGraph describes the relations among the package-level named
+// types of a Program.
+type TypeGraph struct {
+	// Types holds the package-level named types of all packages,
+	// ordered by package path and name.
+	Types []*types.Named
+
+	// DefinedFrom maps each named type T declared as "type T U",
+	// where U is a named type, to U, whose underlying type T shares.
+	// It is derived from syntax, so it omits the types of packages
+	// loaded from export data.
+	DefinedFrom map[*types.Named]*types.Named
+
+	// Embeds maps each named struct type to the named types of its
+	// embedded fields, with any pointer removed, and each named
+	// interface type to the named interfaces it embeds, in order
+	// of declaration.
+	Embeds map[*types.Named][]*types.Named
+
+	// Promoted maps each named type T to the methods promoted to T
+	// or *T from its embedded fields, in the order of the method set.
+	Promoted map[*types.Named][]Promotion
+}
+
+// A Promotion describes a method promoted through embedding.
+type Promotion struct {
+	Method *types.Func  // the promoted method
+	From   *types.Named // the named type that declares the method, or the interface that has it
+	Path   []*types.Var // the embedded fields traversed to reach From
+}
+
+// TypeGraph returns the graph of the package-level named types of the
+// Program.  It uses prog.MethodSets to compute promoted methods.
+func (prog *Program) TypeGraph() *TypeGraph {
+	g := &TypeGraph{
+		DefinedFrom: make(map[*types.Named]*types.Named),
+		Embeds:      make(map[*types.Named][]*types.Named),
+		Promoted:    make(map[*types.Named][]Promotion),
+	}
+	msets := prog.MethodSets
+	if msets == nil {
+		msets = new(typeutil.MethodSetCache)
+	}
+
+	seen := make(map[*types.Package]bool)
+	for _, info := range prog.SortedPackages() {
+		if seen[info.Pkg] {
+			continue
+		}
+		seen[info.Pkg] = true
+
+		scope := info.Pkg.Scope()
+		for _, name := range scope.Names() {
+			if tname, ok := scope.Lookup(name).(*types.TypeName); ok {
+				if T, ok := tname.Type().(*types.Named); ok && T.Obj() == tname {
+					g.Types = append(g.Types, T)
+				}
+			}
+		}
+
+		for _, f := range info.Files {
+			for _, decl := range f.Decls {
+				decl, ok := decl.(*ast.GenDecl)
+				if !ok {
+					continue
+				}
+				for _, spec := range decl.Specs {
+					spec, ok := spec.(*ast.TypeSpec)
+					if !ok || spec.Assign.IsValid() {
+						continue
+					}
+					T, _ := info.TypeOf(spec.Name).(*types.Named)
+					U, _ := info.TypeOf(spec.Type).(*types.Named)
+					if T != nil && U != nil {
+						g.DefinedFrom[T] = U
+					}
+				}
+			}
+		}
+	}
+
+	for _, T := range g.Types {
+		switch u := T.Underlying().(type) {
+		case *types.Struct:
+			for i := 0; i < u.NumFields(); i++ {
+				if f := u.Field(i); f.Anonymous() {
+					if E, ok := deref(f.Type()).(*types.Named); ok {
+						g.Embeds[T] = append(g.Embeds[T], E)
+					}
+				}
+			}
+		case *types.Interface:
+			for i := 0; i < u.NumEmbeddeds(); i++ {
+				if E, ok := u.EmbeddedType(i).(*types.Named); ok {
+					g.Embeds[T] = append(g.Embeds[T], E)
+				}
+			}
+			continue // interface methods are not promoted
+		}
+
+		mset := msets.MethodSet(types.NewPointer(T))
+		for i := 0; i < mset.Len(); i++ {
+			sel := mset.At(i)
+			index := sel.Index()
+			if len(index) < 2 {
+				continue // declared by T
+			}
+			var path []*types.Var
+			t := types.Type(T)
+			for _, j := range index[:len(index)-1] {
+				f := deref(t).Underlying().(*types.Struct).Field(j)
+				path = append(path, f)
+				t = f.Type()
+			}
+			fn := sel.Obj().(*types.Func)
+			from, _ := deref(fn.Type().(*types.Signature).Recv().Type()).(*types.Named)
+			g.Promoted[T] = append(g.Promoted[T], Promotion{Method: fn, From: from, Path: path})
+		}
+	}
+
+	return g
+}
+
+// deref returns the element type of a pointer type t, or t itself.
+func deref(t types.Type) types.Type {
+	if ptr, ok := t.Underlying().(*types.Pointer); ok {
+		return ptr.Elem()
+	}
+	return t
+}
@@ -0,0 +1,70 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestTypeGraph(t *testing.T) {
+	ctxt := fakeContext(map[string]string{
+		"a": `package a
+import "b"
+type T struct {
+	*b.U
+	V
+	x int
+}
+type V struct{ I }
+type I interface { b.J; M() }
+type D T
+type A = T
+`,
+		"b": `package b
+type U struct{}
+func (*U) P() {}
+func (U) Q() {}
+type J interface{ R() }`,
+	})
+	conf := loader.Config{Build: ctxt}
+	conf.Import("a")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	g := prog.TypeGraph()
+	var buf bytes.Buffer
+	for _, T := range g.Types {
+		fmt.Fprintf(&buf, "%s", T)
+		if U := g.DefinedFrom[T]; U != nil {
+			fmt.Fprintf(&buf, " from %s", U)
+		}
+		if Es := g.Embeds[T]; Es != nil {
+			fmt.Fprintf(&buf, " embeds %s", Es)
+		}
+		for _, p := range g.Promoted[T] {
+			fmt.Fprintf(&buf, " %s via", p.Method.Name())
+			for _, f := range p.Path {
+				fmt.Fprintf(&buf, " %s", f.Name())
+			}
+			fmt.Fprintf(&buf, " from %s;", p.From)
+		}
+		fmt.Fprintln(&buf)
+	}
+	want := `a.D from a.T embeds [b.U a.V] M via V I from a.I; P via U from b.U; Q via U from b.U; R via V I from b.J;
+a.I embeds [b.J]
+a.T embeds [b.U a.V] M via V I from a.I; P via U from b.U; Q via U from b.U; R via V I from b.J;
+a.V embeds [a.I] M via I from a.I; R via I from b.J;
+b.J
+b.U
+`
+	if got := buf.String(); got != want {
+		t.Errorf("TypeGraph:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the whole-program report of unused imports, as
+// needed by tools that clean up import declarations.
+
+import (
+	"go/ast"
+	"go/types"
+	"sort"
+)
+
+// UnusedImports records the unused imports of a file.
+type UnusedImports struct {
+	Info  *PackageInfo      // the package containing File
+	File  *ast.File         // the file
+	Specs []*ast.ImportSpec // the unused imports, in order
+}
+
+// UnusedImports returns, for each file of each package loaded from
+// source, including in-package and external test files, the imports
+// that the file does not use, in order of file position.  Files whose
+// imports are all used are omitted.
+//
+// An import is used if the file refers to its package name, or, for a
+// dot import, to any object of the imported package other than
+// through a qualified identifier.  Blank imports, which are imported
+// for their side effects, and imports of "C" or of packages that
+// could not be imported, are never reported.
+//
+func (prog *Program) UnusedImports() []UnusedImports {
+	var res []UnusedImports
+	for _, info := range prog.AllPackages {
+		for _, f := range info.Files {
+			if specs := unusedImports(info, f); specs != nil {
+				res = append(res, UnusedImports{info, f, specs})
+			}
+		}
+	}
+	name := func(f *ast.File) string {
+		if tf := prog.Fset.File(f.Pos()); tf != nil {
+			return tf.Name()
+		}
+		return ""
+	}
+	sort.Slice(res, func(i, j int) bool { return name(res[i].File) < name(res[j].File) })
+	return res
+}
+
+// unusedImports returns the unused imports of file f of package info.
+func unusedImports(info *PackageInfo, f *ast.File) []*ast.ImportSpec {
+	if len(f.Imports) == 0 {
+		return nil
+	}
+
+	// pkgName returns the package name declared by an import.
+	pkgName := func(spec *ast.ImportSpec) *types.PkgName {
+		var obj types.Object
+		if spec.Name != nil {
+			obj = info.Defs[spec.Name]
+		} else {
+			obj = info.Implicits[spec]
+		}
+		pkgname, _ := obj.(*types.PkgName)
+		if pkgname == nil || !pkgname.Imported().Complete() {
+			return nil // import failed
+		}
+		return pkgname
+	}
+	dot := make(map[*types.Package]*types.PkgName) // dot imports by imported package
+	for _, spec := range f.Imports {
+		if spec.Name != nil && spec.Name.Name == "." {
+			if pkgname := pkgName(spec); pkgname != nil {
+				dot[pkgname.Imported()] = pkgname
+			}
+		}
+	}
+
+	used := make(map[*types.PkgName]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			// A qualified identifier uses its package name only.
+			if id, ok := n.X.(*ast.Ident); ok {
+				if pkgname, ok := info.Uses[id].(*types.PkgName); ok {
+					used[pkgname] = true
+					return false
+				}
+			}
+		case *ast.Ident:
+			switch obj := info.Uses[n].(type) {
+			case nil:
+			case *types.PkgName:
+				used[obj] = true
+			default:
+				if pkgname := dot[obj.Pkg()]; pkgname != nil {
+					used[pkgname] = true
+				}
+			}
+		}
+		return true
+	})
+
+	var unused []*ast.ImportSpec
+	for _, spec := range f.Imports {
+		if spec.Name != nil && spec.Name.Name == "_" {
+			continue
+		}
+		if pkgname := pkgName(spec); pkgname != nil && !used[pkgname] {
+			unused = append(unused, spec)
+		}
+	}
+	return unused
+}
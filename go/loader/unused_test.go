@@ -0,0 +1,56 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
+)
+
+func TestUnusedImports(t *testing.T) {
+	conf := loader.Config{
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"p": {
+				"a.go":      `package p; import ("q"; "r"; _ "s"; . "t"; "missing"); var X = q.V + New()`,
+				"b.go":      `package p; import (. "r"; qq "q"; "s"); var _ = qq.V + s.V + V`,
+				"c.go":      `package p; import (. "s"; "t"); var _ = t.New`,
+				"p_test.go": `package p; import "q"; var _ = q.V`,
+				"x_test.go": `package p_test; import ("p"; "q"); var _ = p.X`,
+			},
+			"q": {"x.go": `package q; var V int`},
+			"r": {"x.go": `package r; var V int`},
+			"s": {"x.go": `package s; var V int`},
+			"t": {"x.go": `package t; func New() int { return 0 }`},
+		}),
+	}
+	conf.ImportWithTests("p")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, u := range prog.UnusedImports() {
+		var paths []string
+		for _, spec := range u.Specs {
+			paths = append(paths, spec.Path.Value)
+		}
+		got = append(got, fmt.Sprintf("%s %s: %s", u.Info, prog.Fset.File(u.File.Pos()).Name(), strings.Join(paths, " ")))
+	}
+	want := []string{
+		`p /go/src/p/a.go: "r"`,
+		`p /go/src/p/c.go: "s"`,
+		`p_test /go/src/p/x_test.go: "q"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("UnusedImports:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -5,13 +5,19 @@
 package loader
 
 import (
+	"bytes"
+	"fmt"
 	"go/ast"
 	"go/build"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 
 	"golang.org/x/tools/go/buildutil"
@@ -21,20 +27,46 @@ import (
 // the number of parallel I/O calls per process.
 var ioLimit = make(chan bool, 10)
 
+// readSource returns the contents of the named file, reading no more
+// than one byte beyond limits.MaxFileSize, so that checkSource can
+// report the excess.
+func readSource(ctxt *build.Context, file string, limits *Limits) ([]byte, error) {
+	var rd io.ReadCloser
+	var err error
+	if ctxt.OpenFile != nil {
+		rd, err = ctxt.OpenFile(file)
+	} else {
+		rd, err = os.Open(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rd.Close()
+	var r io.Reader = rd
+	if limits != nil && limits.MaxFileSize > 0 {
+		r = io.LimitReader(rd, limits.MaxFileSize+1) // +1 to detect excess
+	}
+	return ioutil.ReadAll(r)
+}
+
 // parseFiles parses the Go source files within directory dir and
 // returns the ASTs of the ones that could be at least partially parsed,
 // along with a list of I/O and parse errors encountered.
 //
 // I/O is done via ctxt, which may specify a virtual file system.
 // displayPath is used to transform the filenames attached to the ASTs.
+// If preprocess is non-nil, it is called concurrently to transform the
+// source of each file before parsing, as for Config.Preprocess.
+// If parsed is non-nil, it is called concurrently with each AST and
+// the source from which it was parsed.
 //
-func parseFiles(fset *token.FileSet, ctxt *build.Context, displayPath func(string) string, dir string, files []string, mode parser.Mode) ([]*ast.File, []error) {
+func parseFiles(fset *token.FileSet, ctxt *build.Context, displayPath func(string) string, dir string, files []string, mode parser.Mode, limits *Limits, preprocess func(string, []byte) ([]byte, []int, error), parsed func(*ast.File, []byte)) ([]*ast.File, []error) {
 	if displayPath == nil {
 		displayPath = func(path string) string { return path }
 	}
 	var wg sync.WaitGroup
 	n := len(files)
-	parsed := make([]*ast.File, n)
+	asts := make([]*ast.File, n)
 	errors := make([]error, n)
 	for i, file := range files {
 		if !buildutil.IsAbsPath(ctxt, file) {
@@ -47,34 +79,59 @@ func parseFiles(fset *token.FileSet, ctxt *build.Context, displayPath func(strin
 				wg.Done()
 				<-ioLimit // signal
 			}()
-			var rd io.ReadCloser
-			var err error
-			if ctxt.OpenFile != nil {
-				rd, err = ctxt.OpenFile(file)
-			} else {
-				rd, err = os.Open(file)
-			}
+			src, err := readSource(ctxt, file, limits)
 			if err != nil {
-				errors[i] = err // open failed
+				errors[i] = err // open or read failed
 				return
 			}
 
+			name := displayPath(file)
+			if limits != nil {
+				if err := limits.checkSource(name, src); err != nil {
+					errors[i] = err
+					return
+				}
+			}
+			if preprocess != nil {
+				out, lines, err := preprocess(file, src)
+				if err != nil {
+					errors[i] = fmt.Errorf("preprocessing %s: %v", name, err)
+					return
+				}
+				src = lineDirectives(name, out, lines)
+				if limits != nil {
+					if err := limits.checkSource(name, src); err != nil {
+						errors[i] = err
+						return
+					}
+				}
+			}
+
+			if limits != nil {
+				if err := limits.checkFileSet(fset, name, len(src)); err != nil {
+					errors[i] = err
+					return
+				}
+			}
+
 			// ParseFile may return both an AST and an error.
-			parsed[i], errors[i] = parser.ParseFile(fset, displayPath(file), rd, mode)
-			rd.Close()
+			asts[i], errors[i] = parser.ParseFile(fset, name, src, mode)
+			if asts[i] != nil && parsed != nil {
+				parsed(asts[i], src)
+			}
 		}(i, file)
 	}
 	wg.Wait()
 
 	// Eliminate nils, preserving order.
 	var o int
-	for _, f := range parsed {
+	for _, f := range asts {
 		if f != nil {
-			parsed[o] = f
+			asts[o] = f
 			o++
 		}
 	}
-	parsed = parsed[:o]
+	asts = asts[:o]
 
 	o = 0
 	for _, err := range errors {
@@ -85,7 +142,38 @@ func parseFiles(fset *token.FileSet, ctxt *build.Context, displayPath func(strin
 	}
 	errors = errors[:o]
 
-	return parsed, errors
+	return asts, errors
+}
+
+// lineDirectives returns src, the output of a preprocessor, with
+// //line directives inserted before each line whose number in the
+// original file, as given by lines, does not follow that of the line
+// before it, so that the positions of the result refer to the
+// original file, name.  A line numbered 0, or beyond the end of lines,
+// has no counterpart in the original, and is numbered as if it
+// followed the line before it.
+func lineDirectives(name string, src []byte, lines []int) []byte {
+	if lines == nil {
+		return src
+	}
+	var buf bytes.Buffer
+	prev := 0
+	for i := 0; len(src) > 0; i++ {
+		line := src
+		if j := bytes.IndexByte(line, '\n'); j >= 0 {
+			line, src = line[:j+1], src[j+1:]
+		} else {
+			src = src[len(src):]
+		}
+		n := prev + 1
+		if i < len(lines) && lines[i] > 0 && lines[i] != n {
+			n = lines[i]
+			fmt.Fprintf(&buf, "//line %s:%d\n", name, n)
+		}
+		buf.Write(line)
+		prev = n
+	}
+	return buf.Bytes()
 }
 
 // scanImports returns the set of all import paths from all
@@ -114,11 +202,196 @@ func scanImports(files []*ast.File) map[string]bool {
 	return imports
 }
 
-// ---------- Internal helpers ----------
+// majorityName returns the files of an ad hoc package whose package
+// clauses declare the name that most of them declare, or, in case of
+// a tie, the first such name, and an error for each other file, at
+// the position of its package name.  The type checker would instead
+// report each file whose name differs from that of the first file.
+func majorityName(fset *token.FileSet, files []*ast.File) ([]*ast.File, []error) {
+	counts := make(map[string]int)
+	max := 0
+	for _, f := range files {
+		counts[f.Name.Name]++
+		if n := counts[f.Name.Name]; n > max {
+			max = n
+		}
+	}
+	if len(counts) < 2 {
+		return files, nil
+	}
+	var majority string
+	for _, f := range files {
+		if counts[f.Name.Name] == max {
+			majority = f.Name.Name // the first name with the most files
+			break
+		}
+	}
+
+	var kept []*ast.File
+	var errs []error
+	for _, f := range files {
+		if f.Name.Name == majority {
+			kept = append(kept, f)
+			continue
+		}
+		errs = append(errs, types.Error{
+			Fset: fset,
+			Pos:  f.Name.Pos(),
+			Msg: fmt.Sprintf("package %s; expected %s, as declared by %d of %d files",
+				f.Name.Name, majority, counts[majority], len(files)),
+		})
+	}
+	return kept, errs
+}
 
-// TODO(adonovan): make this a method: func (*token.File) Contains(token.Pos)
-func tokenFileContainsPos(f *token.File, pos token.Pos) bool {
-	p := int(pos)
-	base := f.Base()
-	return base <= p && p < base+f.Size()
+// splitFiles partitions files by directory and package name,
+// preserving their order, for Config.SplitCreatePkgs.
+// dir returns the directory of a file, or "" if it has none.
+func splitFiles(files []*ast.File, dir func(*ast.File) string) [][]*ast.File {
+	type key struct{ dir, name string }
+	var parts [][]*ast.File
+	index := make(map[key]int)
+	for _, f := range files {
+		k := key{dir(f), f.Name.Name}
+		i, ok := index[k]
+		if !ok {
+			i = len(parts)
+			index[k] = i
+			parts = append(parts, nil)
+		}
+		parts[i] = append(parts[i], f)
+	}
+	return parts
+}
+
+// fileDir returns the directory of the file f, or "" if f has no
+// position information in fset.
+func fileDir(fset *token.FileSet, f *ast.File) string {
+	if !f.Pos().IsValid() {
+		return ""
+	}
+	tf := fset.File(f.Pos())
+	if tf == nil {
+		return ""
+	}
+	return filepath.Dir(tf.Name())
+}
+
+// buildConstraints returns the build constraints of the Go source
+// file src, as interpreted by go/build: the expression of its
+// "//go:build" line, if any, among the comments before the first
+// non-comment text; otherwise the expressions of its "// +build"
+// lines, among the leading line comments that are followed by a blank
+// line.
+func buildConstraints(src []byte) []string {
+	var (
+		plusBuild   []string // of the lines before the last blank one
+		pending     []string // of the lines since the last blank one
+		goBuild     string
+		hasGoBuild  bool
+		ended       bool // seen a line other than a blank or // comment
+		inSlashStar bool
+	)
+Lines:
+	for len(src) > 0 {
+		line := src
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, src = line[:i], src[i+1:]
+		} else {
+			src = src[len(src):]
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 && !ended {
+			plusBuild = append(plusBuild, pending...)
+			pending = nil
+			continue
+		}
+		if !bytes.HasPrefix(line, slashSlash) {
+			ended = true
+		}
+		if !inSlashStar {
+			if expr, ok := constraintLine(line, "go:build"); ok && !hasGoBuild {
+				goBuild, hasGoBuild = expr, true
+			}
+			if expr, ok := constraintLine(line, "+build"); ok && !ended {
+				pending = append(pending, expr)
+			}
+		}
+
+		// Skip the comments of the line, if any.
+		for len(line) > 0 {
+			if inSlashStar {
+				if i := bytes.Index(line, starSlash); i >= 0 {
+					inSlashStar = false
+					line = bytes.TrimSpace(line[i+len(starSlash):])
+					continue
+				}
+				continue Lines
+			}
+			if bytes.HasPrefix(line, slashSlash) {
+				continue Lines
+			}
+			if bytes.HasPrefix(line, slashStar) {
+				inSlashStar = true
+				line = bytes.TrimSpace(line[len(slashStar):])
+				continue
+			}
+			break Lines // non-comment text
+		}
+	}
+	if hasGoBuild {
+		return []string{goBuild}
+	}
+	return plusBuild
+}
+
+// constraintLine reports whether line is a "//go:build" or "// +build"
+// comment, according to directive, and if so returns its expression,
+// with spaces normalized.  As with go/build, a "//go:build" directive
+// must immediately follow the slashes.
+func constraintLine(line []byte, directive string) (string, bool) {
+	if !bytes.HasPrefix(line, slashSlash) {
+		return "", false
+	}
+	line = line[len(slashSlash):]
+	if directive == "go:build" && !bytes.HasPrefix(line, []byte(directive)) {
+		return "", false
+	}
+	f := strings.Fields(string(line))
+	if len(f) < 2 || f[0] != directive {
+		return "", false
+	}
+	return strings.Join(f[1:], " "), true
+}
+
+var (
+	slashStar = []byte("/*")
+	starSlash = []byte("*/")
+)
+
+var slashSlash = []byte("//")
+
+// isGeneratedSource reports whether the Go source src has a line
+// comment, among those before its package clause, that marks the file
+// as generated.
+func isGeneratedSource(src []byte) bool {
+	for len(src) > 0 {
+		line := src
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line, src = line[:i], src[i+1:]
+		} else {
+			src = src[len(src):]
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if !bytes.HasPrefix(line, slashSlash) {
+			break // end of leading comments
+		}
+		if generatedRx.Match(line) {
+			return true
+		}
+	}
+	return false
 }
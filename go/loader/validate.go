@@ -0,0 +1,130 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines Config.Validate, which checks a Config for
+// misconfigurations before loading.
+
+import (
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/buildutil"
+)
+
+// Validate checks the configuration for inconsistencies that would
+// cause Load to fail, or to behave surprisingly, and returns all of
+// them, in a deterministic order.  It neither loads any packages nor
+// modifies conf.  A nil result means no problems were found.
+//
+// Validate reports:
+//  - a CreatePkgs entry with parsed files but a nil Fset;
+//  - a CreatePkgs entry with neither Files nor Filenames;
+//  - an empty key in ImportPkgs;
+//  - an ImportPkgs key that is not a pattern yet is excluded by
+//    Exclude, which affects only the expansion of patterns;
+//  - more than one ImportPkgs key, such as "a" and "./a", that
+//    denotes the same package augmented by its tests, which Load
+//    would augment twice;
+//  - a nonexistent Cwd or GOPATH directory, or a GOROOT without
+//    sources, including those of the build context;
+//  - an unsupported Compiler when ImportFromBinary is set;
+//  - a negative Parallelism.
+//
+func (conf *Config) Validate() []error {
+	var errs []error
+	errorf := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	for i, cp := range conf.CreatePkgs {
+		if cp.Files != nil && conf.Fset == nil {
+			errorf("CreatePkgs[%d] has parsed files but Fset is nil", i)
+		}
+		if cp.Files == nil && cp.Filenames == nil {
+			errorf("CreatePkgs[%d] has no files", i)
+		}
+	}
+
+	ctxt := conf.build()
+	cwd := conf.Cwd
+	if cwd == "" {
+		cwd, _ = os.Getwd()
+	}
+
+	var paths []string
+	for path := range conf.ImportPkgs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	augmented := make(map[string]string) // maps import path to ImportPkgs key
+	for _, path := range paths {
+		if path == "" {
+			errorf("ImportPkgs contains an empty import path")
+			continue
+		}
+		if isPattern(path) {
+			continue
+		}
+		if conf.excluded(path) {
+			errorf("initial package %q matches Exclude, which applies only to patterns", path)
+		}
+		if conf.ImportPkgs[path] {
+			canon := initialImportPath(ctxt, cwd, path)
+			if prev, ok := augmented[canon]; ok {
+				errorf("package %s is augmented by its tests more than once, as %q and %q", canon, prev, path)
+			} else {
+				augmented[canon] = path
+			}
+		}
+	}
+
+	if conf.Cwd != "" && !buildutil.IsDir(ctxt, conf.Cwd) {
+		errorf("Cwd directory %s does not exist", conf.Cwd)
+	}
+	if ctxt.GOROOT != "" && !buildutil.IsDir(ctxt, buildutil.JoinPath(ctxt, ctxt.GOROOT, "src")) {
+		errorf("GOROOT directory %s has no src subdirectory", ctxt.GOROOT)
+	}
+	for _, dir := range buildutil.SplitPathList(ctxt, ctxt.GOPATH) {
+		if !buildutil.IsDir(ctxt, dir) {
+			errorf("GOPATH directory %s does not exist", dir)
+		}
+	}
+
+	if conf.ImportFromBinary != nil {
+		switch compiler := ctxt.Compiler; compiler {
+		case "gc", "gccgo":
+		default:
+			errorf("can't import from binary: unsupported compiler %q", compiler)
+		}
+	}
+	if conf.Parallelism < 0 {
+		errorf("negative Parallelism %d", conf.Parallelism)
+	}
+	return errs
+}
+
+// initialImportPath returns the import path of the initial package
+// denoted by path, a directory name or import path, relative to cwd.
+// If the path of a directory cannot be determined, path is returned.
+func initialImportPath(ctxt *build.Context, cwd, path string) string {
+	if buildutil.IsAbsPath(ctxt, path) {
+		rel, err := filepath.Rel(cwd, path)
+		if err != nil {
+			return path
+		}
+		path = "./" + filepath.ToSlash(rel)
+	}
+	if build.IsLocalImport(path) {
+		if abs, _, err := absPattern(ctxt, cwd, path); err == nil && abs != "" {
+			return strings.TrimSuffix(abs, "/")
+		}
+	}
+	return path
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"go/ast"
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestValidate(t *testing.T) {
+	ctxt := fakeContext(map[string]string{"a": `package a`})
+	ctxt.GOPATH = "/nonexistent"
+	ctxt.Compiler = "tcc"
+	conf := loader.Config{
+		Build:            ctxt,
+		Cwd:              "/go/src/missing",
+		Exclude:          func(path string) bool { return path == "a" },
+		ImportFromBinary: func(string) bool { return true },
+		Parallelism:      -1,
+	}
+	conf.Import("a")
+	conf.Import("a/...")
+	conf.Import("")
+	conf.CreateFromFiles("p", &ast.File{Name: ast.NewIdent("p")})
+	conf.CreateFromFilenames("q")
+
+	var got []string
+	for _, err := range conf.Validate() {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		"CreatePkgs[0] has parsed files but Fset is nil",
+		"CreatePkgs[1] has no files",
+		"ImportPkgs contains an empty import path",
+		`initial package "a" matches Exclude, which applies only to patterns`,
+		"Cwd directory /go/src/missing does not exist",
+		"GOPATH directory /nonexistent does not exist",
+		`can't import from binary: unsupported compiler "tcc"`,
+		"negative Parallelism -1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate:\n%q\nwant:\n%q", got, want)
+	}
+
+	conf = loader.Config{Build: fakeContext(map[string]string{"a": `package a`}), Cwd: "/go/src"}
+	conf.ImportWithTests("a")
+	conf.ImportWithTests("./a")
+	conf.ImportWithTests("/go/src/a")
+	conf.Import("./a/")
+	got = nil
+	for _, err := range conf.Validate() {
+		got = append(got, err.Error())
+	}
+	want = []string{
+		`package a is augmented by its tests more than once, as "./a" and "/go/src/a"`,
+		`package a is augmented by its tests more than once, as "./a" and "a"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Validate:\n%q\nwant:\n%q", got, want)
+	}
+
+	conf = loader.Config{Build: fakeContext(nil), Cwd: "/go/src"}
+	conf.Import("a")
+	if errs := conf.Validate(); errs != nil {
+		t.Errorf("Validate of valid Config = %v", errs)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader
+
+// This file defines the cross-reference index of a Program.
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/types"
+	"io"
+)
+
+// An XRef is a record of the cross-reference index written by
+// WriteXRefs: an occurrence of a symbol in the source.
+type XRef struct {
+	Package string          // path of the package containing the occurrence
+	Range   DiagnosticRange // extent of the identifier
+	Symbol  string          // name of the symbol; see WriteXRefs
+	Kind    string          // "package", "const", "var", "func", "type", "field", "method", or "label"
+	Role    string          // "definition" or "reference"
+	Local   bool            `json:",omitempty"` // the symbol is named by position, such as a local variable
+}
+
+// WriteXRefs writes to w the cross-reference index of the program, a
+// newline-delimited sequence of JSON-encoded XRef records, one for
+// each definition of or reference to a symbol, suitable for indexing
+// by code-search and hover services.  The records are ordered by
+// package, as by SortedPackages, then by file and position.
+// Predeclared objects, such as int, and blank identifiers are omitted.
+//
+// Symbols are named as follows:
+//   an imported package:                its path ("fmt");
+//   a package-level object:             path.Name ("fmt.Println");
+//   a method of a package-level type:   path.Type.Method ("bytes.Buffer.Len");
+//   a field of a package-level struct:  path.Type.Field ("go/ast.File.Name");
+//   any other object, such as a local:  the position of its definition
+//                                       ("/src/p/p.go:12:3"), and Local is set.
+//
+// An identifier that both defines and refers, such as an embedded
+// field, yields both a definition and a reference.
+//
+func (prog *Program) WriteXRefs(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return prog.forEachXRef(func(x *XRef) error { return enc.Encode(x) })
+}
+
+// forEachXRef calls f for each record of the cross-reference index, in
+// the order of WriteXRefs, until f returns an error.
+func (prog *Program) forEachXRef(f func(x *XRef) error) error {
+	names := make(xrefNames)
+	for _, info := range prog.SortedPackages() {
+		for _, file := range info.Files {
+			var err error
+			ast.Inspect(file, func(n ast.Node) bool {
+				id, ok := n.(*ast.Ident)
+				if !ok || err != nil {
+					return err == nil
+				}
+				if obj := info.Defs[id]; obj != nil {
+					err = prog.xref(f, info, id, obj, "definition", names)
+				}
+				if obj := info.Uses[id]; obj != nil && err == nil {
+					err = prog.xref(f, info, id, obj, "reference", names)
+				}
+				return true
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (prog *Program) xref(f func(x *XRef) error, info *PackageInfo, id *ast.Ident, obj types.Object, role string, names xrefNames) error {
+	if obj.Pkg() == nil || obj.Name() == "_" {
+		return nil // predeclared or blank
+	}
+	x := XRef{
+		Package: info.Pkg.Path(),
+		Range: DiagnosticRange{
+			Start: positionRange(prog.Position(id.Pos())).Start,
+			End:   positionRange(prog.Position(id.End())).Start,
+		},
+		Kind: xrefKind(obj),
+		Role: role,
+	}
+	x.Symbol, x.Local = prog.xrefSymbol(obj, names)
+	return f(&x)
+}
+
+// xrefSymbol returns the symbol name of obj, and whether it is local.
+func (prog *Program) xrefSymbol(obj types.Object, names xrefNames) (string, bool) {
+	if pkgname, ok := obj.(*types.PkgName); ok {
+		return pkgname.Imported().Path(), false
+	}
+	if name, ok := names.field(obj); ok {
+		return name, false
+	}
+	if obj.Parent() == obj.Pkg().Scope() {
+		return obj.Pkg().Path() + "." + obj.Name(), false
+	}
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			if named, ok := deref(recv.Type()).(*types.Named); ok && named.Obj().Parent() == named.Obj().Pkg().Scope() {
+				return named.Obj().Pkg().Path() + "." + named.Obj().Name() + "." + fn.Name(), false
+			}
+		}
+	}
+	return prog.Position(obj.Pos()).String(), true
+}
+
+// xrefNames holds the symbol names of the fields of the package-level
+// struct types of each package, computed as needed.
+type xrefNames map[*types.Package]map[types.Object]string
+
+// field returns the symbol name of obj, if it is such a field.
+func (names xrefNames) field(obj types.Object) (string, bool) {
+	if v, ok := obj.(*types.Var); !ok || !v.IsField() {
+		return "", false
+	}
+	m, ok := names[obj.Pkg()]
+	if !ok {
+		m = xrefFieldNames(obj.Pkg())
+		names[obj.Pkg()] = m
+	}
+	name, ok := m[obj]
+	return name, ok
+}
+
+// xrefFieldNames returns the symbol names of the fields of the
+// package-level struct types of pkg.
+func xrefFieldNames(pkg *types.Package) map[types.Object]string {
+	names := make(map[types.Object]string)
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		if tname, ok := scope.Lookup(name).(*types.TypeName); ok && !tname.IsAlias() {
+			if s, ok := tname.Type().Underlying().(*types.Struct); ok {
+				for i := 0; i < s.NumFields(); i++ {
+					if f := s.Field(i); f.Pkg() == pkg {
+						names[f] = pkg.Path() + "." + name + "." + f.Name()
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// xrefKind returns the kind of symbol obj.
+func xrefKind(obj types.Object) string {
+	switch obj := obj.(type) {
+	case *types.PkgName:
+		return "package"
+	case *types.Const:
+		return "const"
+	case *types.TypeName:
+		return "type"
+	case *types.Label:
+		return "label"
+	case *types.Func:
+		if obj.Type().(*types.Signature).Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.Var:
+		if obj.IsField() {
+			return "field"
+		}
+	}
+	return "var"
+}
@@ -0,0 +1,74 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loader_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/loader"
+)
+
+func TestWriteXRefs(t *testing.T) {
+	conf := loader.Config{Build: fakeContext(map[string]string{
+		"a": `package a; type T struct{ F int }; func (T) M() {}`,
+		"b": `package b
+
+import "a"
+
+func f(t a.T) int {
+L:
+	t.M()
+	goto L
+	return t.F
+}
+`,
+	})}
+	conf.Import("b")
+	prog, err := conf.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := prog.WriteXRefs(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var x loader.XRef
+		if err := dec.Decode(&x); err != nil {
+			t.Fatal(err)
+		}
+		local := ""
+		if x.Local {
+			local = " (local)"
+		}
+		got = append(got, fmt.Sprintf("%s %d:%d-%d %s %s %s%s",
+			x.Package, x.Range.Start.Line, x.Range.Start.Column, x.Range.End.Column,
+			x.Role, x.Kind, x.Symbol, local))
+	}
+	want := `a 1:17-18 definition type a.T
+a 1:27-28 definition field a.T.F
+a 1:42-43 reference type a.T
+a 1:45-46 definition method a.T.M
+b 5:6-7 definition func b.f
+b 5:8-9 definition var /go/src/b/x.go:5:8 (local)
+b 5:10-11 reference package a
+b 5:12-13 reference type a.T
+b 6:1-2 definition label /go/src/b/x.go:6:1 (local)
+b 7:2-3 reference var /go/src/b/x.go:5:8 (local)
+b 7:4-5 reference method a.T.M
+b 8:7-8 reference label /go/src/b/x.go:6:1 (local)
+b 9:9-10 reference var /go/src/b/x.go:5:8 (local)
+b 9:11-12 reference field a.T.F`
+	if got := strings.Join(got, "\n"); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
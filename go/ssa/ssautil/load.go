@@ -7,6 +7,7 @@ package ssautil
 // This file defines utility functions for constructing programs in SSA form.
 
 import (
+	"fmt"
 	"go/ast"
 	"go/token"
 	"go/types"
@@ -116,6 +117,81 @@ func CreateProgram(lprog *loader.Program, mode ssa.BuilderMode) *ssa.Program {
 	return prog
 }
 
+// LoadProgram loads the program specified by conf, creates an SSA
+// program for it as if by CreateProgram, and builds the code of all
+// its functions.  It returns both the loaded program and the SSA
+// program.
+//
+// Loading fails unless every package is free of errors, or
+// conf.AllowErrors is set, in which case no SSA package is created
+// for a package that is not transitively error-free; use
+// ssaprog.Package(info.Pkg) to find which packages have one.
+//
+func LoadProgram(conf *loader.Config, mode ssa.BuilderMode) (*loader.Program, *ssa.Program, error) {
+	lprog, err := conf.Load()
+	if err != nil {
+		return nil, nil, err
+	}
+	prog := CreateProgram(lprog, mode)
+	prog.Build()
+	return lprog, prog, nil
+}
+
+// LoadWholeProgram loads and builds a program for whole-program
+// analysis, such as pointer analysis, which requires complete and
+// well-typed SSA code for every package and at least one main
+// package.  It is like LoadProgram, except that it:
+//
+// - loads the tests of each package named by conf.Import, as if by
+//   conf.ImportWithTests, so that test packages may be analyzed;
+// - rejects a Config that would load an incomplete program, one whose
+//   TypeCheckFuncBodies predicate may skip function bodies or that
+//   allows errors;
+// - returns the main packages of the program: each initial package
+//   named "main" that defines a main function, and, for each other
+//   initial package that has tests, a synthetic testmain package
+//   created by CreateTestMainPackage.
+//
+// It fails if the program has no main package, so the result is
+// suitable for use as pointer.Config.Mains.
+//
+// LoadWholeProgram modifies conf.ImportPkgs.
+//
+func LoadWholeProgram(conf *loader.Config, mode ssa.BuilderMode) (*loader.Program, *ssa.Program, []*ssa.Package, error) {
+	if conf.TypeCheckFuncBodies != nil {
+		return nil, nil, nil, fmt.Errorf("whole-program analysis requires all function bodies, but Config.TypeCheckFuncBodies is set")
+	}
+	if conf.AllowErrors {
+		return nil, nil, nil, fmt.Errorf("whole-program analysis requires a well-typed program, but Config.AllowErrors is set")
+	}
+	for path := range conf.ImportPkgs {
+		conf.ImportWithTests(path)
+	}
+
+	lprog, err := conf.Load()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	prog := CreateProgram(lprog, mode)
+
+	// Create the testmain packages before building, so that
+	// Build builds them too.
+	var mains []*ssa.Package
+	for _, info := range lprog.InitialPackages() {
+		p := prog.Package(info.Pkg)
+		if p.Pkg.Name() == "main" && p.Func("main") != nil {
+			mains = append(mains, p)
+		} else if main := prog.CreateTestMainPackage(p); main != nil {
+			mains = append(mains, main)
+		}
+	}
+	if mains == nil {
+		return nil, nil, nil, fmt.Errorf("program has no main package and no tests")
+	}
+	prog.Build()
+	return lprog, prog, mains, nil
+}
+
 // BuildPackage builds an SSA program with IR for a single package.
 //
 // It populates pkg by type-checking the specified file ASTs.  All
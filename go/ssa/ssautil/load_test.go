@@ -15,6 +15,8 @@ import (
 	"strings"
 	"testing"
 
+	"golang.org/x/tools/go/buildutil"
+	"golang.org/x/tools/go/loader"
 	"golang.org/x/tools/go/packages"
 	"golang.org/x/tools/go/ssa/ssautil"
 )
@@ -105,6 +107,83 @@ func TestBuildPackage_MissingImport(t *testing.T) {
 	}
 }
 
+func TestLoadProgram(t *testing.T) {
+	conf := loader.Config{
+		Build: buildutil.FakeContext(map[string]map[string]string{
+			"a":   {"a.go": `package a; func F() int { return 1 }`},
+			"b":   {"b.go": `package b; import "a"; var X = a.F()`},
+			"bad": {"bad.go": `package bad; var Y int = "y"`},
+		}),
+		AllowErrors: true,
+		TypeChecker: types.Config{Error: func(error) {}},
+	}
+	conf.Import("b")
+	conf.Import("bad")
+	lprog, prog, err := ssautil.LoadProgram(&conf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := prog.Package(lprog.Package("b").Pkg)
+	if b == nil {
+		t.Fatal("no SSA package for b")
+	}
+	if init := b.Func("init"); init == nil || len(init.Blocks) == 0 {
+		t.Errorf("b.init was not built")
+	}
+	if prog.Package(lprog.Package("a").Pkg) == nil {
+		t.Errorf("no SSA package for a")
+	}
+	if prog.Package(lprog.Package("bad").Pkg) != nil {
+		t.Errorf("SSA package created for bad, which has errors")
+	}
+
+	// Without AllowErrors, loading fails.
+	conf.AllowErrors = false
+	if _, _, err := ssautil.LoadProgram(&conf, 0); err == nil {
+		t.Errorf("LoadProgram succeeded despite errors")
+	}
+}
+
+func TestLoadWholeProgram(t *testing.T) {
+	ctxt := buildutil.FakeContext(map[string]map[string]string{
+		"lib":  {"lib.go": `package lib; func F() int { return 1 }`},
+		"main": {"main.go": `package main; import "lib"; func main() { println(lib.F()) }`},
+	})
+
+	conf := loader.Config{Build: ctxt}
+	conf.Import("main")
+	_, prog, mains, err := ssautil.LoadWholeProgram(&conf, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mains) != 1 || mains[0].Pkg.Path() != "main" {
+		t.Fatalf("mains = %v, want [main]", mains)
+	}
+	if main := mains[0].Func("main"); len(main.Blocks) == 0 {
+		t.Errorf("main was not built")
+	}
+	if !conf.ImportPkgs["main"] {
+		t.Errorf("tests of main were not imported")
+	}
+	if len(prog.AllPackages()) != 2 {
+		t.Errorf("got %d SSA packages, want 2", len(prog.AllPackages()))
+	}
+
+	// A library without tests has no main package.
+	conf = loader.Config{Build: ctxt}
+	conf.Import("lib")
+	if _, _, _, err := ssautil.LoadWholeProgram(&conf, 0); err == nil || !strings.Contains(err.Error(), "no main package") {
+		t.Errorf("LoadWholeProgram(lib) returned error %v, want 'no main package'", err)
+	}
+
+	// An incomplete configuration is rejected.
+	conf = loader.Config{Build: ctxt, TypeCheckFuncBodies: func(string) bool { return false }}
+	conf.Import("main")
+	if _, _, _, err := ssautil.LoadWholeProgram(&conf, 0); err == nil || !strings.Contains(err.Error(), "TypeCheckFuncBodies") {
+		t.Errorf("LoadWholeProgram returned error %v, want complaint about TypeCheckFuncBodies", err)
+	}
+}
+
 func TestIssue28106(t *testing.T) {
 	// In go1.10, go/packages loads all packages from source, not
 	// export data, but does not type check function bodies of